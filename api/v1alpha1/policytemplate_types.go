@@ -0,0 +1,108 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// PolicyTemplateConditionApproved is true once the current spec of the template was approved
+	PolicyTemplateConditionApproved = "Approved"
+)
+
+// PolicyTemplateParameter is a value that NetworkPolicies instantiating the template may choose
+type PolicyTemplateParameter struct {
+	// Name is referenced as {{name}} in the template
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z_][a-zA-Z0-9_]*$`
+	Name string `json:"name"`
+	// Description tells approvers and users what the parameter is for
+	// +optional
+	Description string `json:"description,omitempty"`
+	// Pattern is a regular expression the whole value has to match, any non-empty value if unset
+	// +optional
+	Pattern string `json:"pattern,omitempty"`
+	// Values lists the allowed values, any value matching Pattern if unset
+	// +optional
+	Values []string `json:"values,omitempty"`
+}
+
+// PolicyTemplateSpec defines a parameterized NetworkPolicy spec
+type PolicyTemplateSpec struct {
+	// Description tells approvers what the template allows
+	// +optional
+	Description string `json:"description,omitempty"`
+	// Namespaces restricts the namespaces whose NetworkPolicies may use the template, all if unset
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Parameters may be referenced in string values of Template
+	// +optional
+	Parameters []PolicyTemplateParameter `json:"parameters,omitempty"`
+	// Template is a NetworkPolicy spec where string values may contain {{parameter}} placeholders.
+	// A placeholder that is the whole value also matches numbers, e.g. port: "{{port}}"
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Template runtime.RawExtension `json:"template"`
+}
+
+// PolicyTemplateStatus defines the observed state of PolicyTemplate
+type PolicyTemplateStatus struct {
+	// Hash of the spec that was approved. The template is only used while it matches the current spec
+	// +optional
+	ApprovedHash string `json:"approvedHash,omitempty"`
+	// ApprovedAt is when the spec was approved
+	// +optional
+	ApprovedAt *metav1.Time `json:"approvedAt,omitempty"`
+	// CSRName is the CertificateSigningRequest administrators approve the template with
+	// +optional
+	CSRName string `json:"csrName,omitempty"`
+	// Conditions represent the latest available observations of the template's state
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Approved",type=string,JSONPath=`.status.conditions[?(@.type=="Approved")].status`
+// +kubebuilder:printcolumn:name="CSR",type=string,JSONPath=`.status.csrName`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// PolicyTemplate is a parameterized NetworkPolicy that administrators approve once.
+// NetworkPolicies matching an approved template are admitted without a request of their own
+type PolicyTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PolicyTemplateSpec   `json:"spec,omitempty"`
+	Status PolicyTemplateStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// PolicyTemplateList contains a list of PolicyTemplate
+type PolicyTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PolicyTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PolicyTemplate{}, &PolicyTemplateList{})
+}
@@ -0,0 +1,587 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// approvectl checks NetworkPolicy manifests against their approvals before they are applied, e.g. in CI, and
+// backs up the approvals of a cluster.
+//
+//	approvectl hash [-n namespace] <file or directory>...
+//	approvectl check [-n namespace] [--approvals file] [--trusted-keys file] <file or directory>...
+//	approvectl export [-n namespace] [--key private.pem] [-o yaml|json] > approvals.yaml
+//	approvectl import --public-key public.pem [--allow-unsigned] [--overwrite] [--dry-run] approvals.yaml
+//
+// check reads the approvals from the cluster of the kubeconfig, or from --approvals holding an approval archive
+// or an export of the approval Secrets (kubectl get secrets -A -l networkpolicy.webhook.io/approval -o yaml).
+// It exits 1 listing the NetworkPolicies that are not approved, so their approval can be requested before they
+// are applied.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	approvalv1alpha1 "github.com/hadi2f244/approve-controller/api/v1alpha1"
+	"github.com/hadi2f244/approve-controller/internal/pkg/approval"
+	"github.com/hadi2f244/approve-controller/internal/pkg/backup"
+	"github.com/hadi2f244/approve-controller/internal/pkg/signature"
+	"github.com/hadi2f244/approve-controller/internal/pkg/templates"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+func main() {
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "Usage: %s [--kubeconfig file] <command> [flags] <file or directory>...\n\n", os.Args[0])
+		fmt.Fprintln(out, "Commands:")
+		fmt.Fprintln(out, "  hash [-n namespace]                 Print the approval hash of every NetworkPolicy")
+		fmt.Fprintln(out, "  check [-n namespace] [--approvals file] [--trusted-keys file]")
+		fmt.Fprintln(out, "                                      Check that every NetworkPolicy is approved, exit 1 listing the others")
+		fmt.Fprintln(out, "  export [-n namespace] [--key file] [-o yaml|json]")
+		fmt.Fprintln(out, "                                      Write a signed archive of the approvals of the cluster")
+		fmt.Fprintln(out, "  import --public-key file [--allow-unsigned] [--overwrite] [--dry-run] <file>")
+		fmt.Fprintln(out, "                                      Restore the approvals of an archive after re-validating their hashes")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Files may contain several YAML documents and Lists, - reads standard input.")
+		fmt.Fprintln(out)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	unapproved, err := run(context.Background(), flag.Arg(0), flag.Args()[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	if len(unapproved) > 0 {
+		fmt.Fprintf(os.Stderr, "\n%d NetworkPolicies are not approved:\n  %s\n", len(unapproved), strings.Join(unapproved, "\n  "))
+		os.Exit(1)
+	}
+}
+
+// run executes the command and returns the NetworkPolicies that are not approved
+func run(ctx context.Context, command string, args []string) ([]string, error) {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	var namespace, approvalsPath, trustedKeysPath, keyPath, output string
+	var overwrite, dryRun, allowUnsigned bool
+	switch command {
+	case "hash":
+		flags.StringVar(&namespace, "n", "default", "Namespace of NetworkPolicies whose manifest has none")
+	case "check":
+		flags.StringVar(&namespace, "n", "default", "Namespace of NetworkPolicies whose manifest has none")
+		flags.StringVar(&approvalsPath, "approvals", "", "Approval archive or export of the approval Secrets to check against instead of the cluster")
+		flags.StringVar(&trustedKeysPath, "trusted-keys", "", "YAML list of the trusted signing keys of the operator configuration "+
+			"(operator.signatures.trustedKeys), signed NetworkPolicies are only verified with it")
+	case "export":
+		flags.StringVar(&namespace, "n", "", "Only export the approvals of this namespace")
+		flags.StringVar(&keyPath, "key", "", "PEM private key (Ed25519, ECDSA or RSA) signing the archive, it is not signed without")
+		flags.StringVar(&output, "o", "yaml", "Output format, yaml or json")
+	case "import":
+		flags.StringVar(&keyPath, "public-key", "", "PEM public key or certificate verifying the signature of the archive")
+		flags.BoolVar(&allowUnsigned, "allow-unsigned", false, "Import an archive without verifying its signature")
+		flags.BoolVar(&overwrite, "overwrite", false, "Replace approvals of the cluster that differ from the archived ones")
+		flags.BoolVar(&dryRun, "dry-run", false, "Only report what would be imported")
+	default:
+		flag.Usage()
+		return nil, fmt.Errorf("unknown command %q", command)
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	switch command {
+	case "export":
+		return nil, exportApprovals(ctx, os.Stdout, namespace, keyPath, output)
+	case "import":
+		if flags.NArg() != 1 {
+			return nil, errors.New("import requires one approval archive")
+		}
+		return nil, importApprovals(ctx, os.Stdout, flags.Arg(0), keyPath, allowUnsigned, backup.ImportOptions{Overwrite: overwrite, DryRun: dryRun})
+	}
+	if flags.NArg() == 0 {
+		return nil, fmt.Errorf("%s requires NetworkPolicy manifests", command)
+	}
+
+	policies, err := readPolicies(flags.Args(), namespace)
+	if err != nil {
+		return nil, err
+	}
+	if command == "hash" {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "NAMESPACE\tNETWORKPOLICY\tHASH")
+		for _, p := range policies {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", p.np.Namespace, p.np.Name, p.hash)
+		}
+		return nil, w.Flush()
+	}
+
+	c := &checker{now: time.Now()}
+	if trustedKeysPath != "" {
+		if c.signatures, err = readTrustedKeys(trustedKeysPath); err != nil {
+			return nil, err
+		}
+	}
+	if approvalsPath != "" {
+		if c.secrets, err = readApprovals(approvalsPath); err != nil {
+			return nil, err
+		}
+	} else {
+		if c.client, err = newClient(); err != nil {
+			return nil, err
+		}
+	}
+	return check(ctx, c, os.Stdout, policies)
+}
+
+// policy is a NetworkPolicy read from a manifest
+type policy struct {
+	np   *networkingv1.NetworkPolicy
+	hash string
+}
+
+// readPolicies reads the NetworkPolicies of the files and the YAML and JSON files in the directories, other
+// kinds are skipped
+func readPolicies(paths []string, namespace string) ([]policy, error) {
+	policies := []policy{}
+	seen := map[types.NamespacedName]string{}
+	for _, path := range paths {
+		objects, err := readManifests(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range objects {
+			if object.kind != "NetworkPolicy" || object.apiVersion != networkingv1.SchemeGroupVersion.String() {
+				continue
+			}
+			np := &networkingv1.NetworkPolicy{}
+			if err := json.Unmarshal(object.data, np); err != nil {
+				return nil, fmt.Errorf("%s: invalid NetworkPolicy: %w", object.source, err)
+			}
+			if np.Namespace == "" {
+				np.Namespace = namespace
+			}
+			key := types.NamespacedName{Namespace: np.Namespace, Name: np.Name}
+			if previous, ok := seen[key]; ok {
+				return nil, fmt.Errorf("%s: NetworkPolicy %s is also defined in %s", object.source, key, previous)
+			}
+			seen[key] = object.source
+			// The webhook hashes the NetworkPolicy after the API server defaulted it
+			approval.SetDefaults(np)
+			hash, err := approval.GenerateNetworkPolicyHash(np)
+			if err != nil {
+				return nil, err
+			}
+			policies = append(policies, policy{np: np, hash: hash})
+		}
+	}
+	return policies, nil
+}
+
+// object is a Kubernetes object read from a manifest
+type object struct {
+	source     string
+	apiVersion string
+	kind       string
+	data       json.RawMessage
+}
+
+// readManifests reads the objects of a file, of the YAML and JSON files below a directory, or of standard input
+func readManifests(path string) ([]object, error) {
+	if path == "-" {
+		return decodeObjects("<stdin>", os.Stdin)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return readFile(path)
+	}
+	objects := []object{}
+	err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		switch filepath.Ext(file) {
+		case ".yaml", ".yml", ".json":
+			read, err := readFile(file)
+			objects = append(objects, read...)
+			return err
+		}
+		return nil
+	})
+	return objects, err
+}
+
+func readFile(path string) ([]object, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return decodeObjects(path, file)
+}
+
+// decodeObjects decodes every document of a YAML or JSON stream, Lists are flattened into their items
+func decodeObjects(source string, r io.Reader) ([]object, error) {
+	objects := []object{}
+	decoder := utilyaml.NewYAMLOrJSONDecoder(r, 4096)
+	for {
+		data := json.RawMessage{}
+		if err := decoder.Decode(&data); err != nil {
+			if errors.Is(err, io.EOF) {
+				return objects, nil
+			}
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+		items, err := flatten(source, data)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, items...)
+	}
+}
+
+func flatten(source string, data json.RawMessage) ([]object, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+	header := struct {
+		APIVersion string            `json:"apiVersion"`
+		Kind       string            `json:"kind"`
+		Items      []json.RawMessage `json:"items"`
+	}{}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("%s: not a Kubernetes object: %w", source, err)
+	}
+	if !strings.HasSuffix(header.Kind, "List") {
+		return []object{{source: source, apiVersion: header.APIVersion, kind: header.Kind, data: data}}, nil
+	}
+	objects := []object{}
+	for _, item := range header.Items {
+		flattened, err := flatten(source, item)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, flattened...)
+	}
+	return objects, nil
+}
+
+// readApprovals reads the approval Secrets of an export or of approval archives
+func readApprovals(path string) (map[types.NamespacedName]*corev1.Secret, error) {
+	objects, err := readManifests(path)
+	if err != nil {
+		return nil, err
+	}
+	secrets := map[types.NamespacedName]*corev1.Secret{}
+	for _, object := range objects {
+		if object.kind == backup.Kind {
+			archive, err := backup.Decode(object.data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", object.source, err)
+			}
+			for _, entry := range archive.Approvals {
+				secret := entry.Secret()
+				secrets[types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}] = secret
+			}
+			continue
+		}
+		if object.kind != "Secret" {
+			continue
+		}
+		secret := &corev1.Secret{}
+		if err := json.Unmarshal(object.data, secret); err != nil {
+			return nil, fmt.Errorf("%s: invalid Secret: %w", object.source, err)
+		}
+		if secret.Type == approval.SecretTypeNetworkPolicyApproval {
+			secrets[types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}] = secret
+		}
+	}
+	return secrets, nil
+}
+
+// readTrustedKeys reads the trusted signing keys, as a list or as the operator configuration they are part of
+func readTrustedKeys(path string) (*signature.Verifier, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys := []signature.TrustedKey{}
+	if err := yaml.Unmarshal(data, &keys); err != nil {
+		config := struct {
+			Operator struct {
+				Signatures struct {
+					TrustedKeys []signature.TrustedKey `json:"trustedKeys"`
+				} `json:"signatures"`
+			} `json:"operator"`
+		}{}
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("%s: expected a list of trusted keys or an operator configuration: %w", path, err)
+		}
+		keys = config.Operator.Signatures.TrustedKeys
+	}
+	return signature.NewVerifier(keys)
+}
+
+// exportApprovals writes an archive of the approvals in namespace, signed with the private key if one is given
+func exportApprovals(ctx context.Context, out io.Writer, namespace, keyPath, output string) error {
+	if output != "yaml" && output != "json" {
+		return fmt.Errorf("unsupported output format %q, expected yaml or json", output)
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	archive, err := backup.Export(ctx, c, namespace, time.Now())
+	if err != nil {
+		return err
+	}
+	if keyPath != "" {
+		key, err := os.ReadFile(keyPath)
+		if err != nil {
+			return err
+		}
+		if err := archive.Sign(key); err != nil {
+			return fmt.Errorf("failed to sign the archive: %w", err)
+		}
+	} else {
+		fmt.Fprintln(os.Stderr, "warning: the archive is not signed, pass --key to sign it")
+	}
+
+	var data []byte
+	if output == "json" {
+		data, err = json.MarshalIndent(archive, "", "  ")
+		data = append(data, '\n')
+	} else {
+		data, err = yaml.Marshal(archive)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	fmt.Fprintf(os.Stderr, "exported %d approvals\n", len(archive.Approvals))
+	return err
+}
+
+// importApprovals verifies the signature of an archive and restores its approvals into the cluster
+func importApprovals(ctx context.Context, out io.Writer, path, publicKeyPath string, allowUnsigned bool, options backup.ImportOptions) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	archive, err := backup.Decode(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	switch {
+	case publicKeyPath != "":
+		publicKey, err := os.ReadFile(publicKeyPath)
+		if err != nil {
+			return err
+		}
+		verifier, err := signature.NewVerifier([]signature.TrustedKey{{Name: publicKeyPath, PublicKey: string(publicKey)}})
+		if err != nil {
+			return err
+		}
+		if _, err := archive.Verify(verifier); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		fmt.Fprintf(out, "verified the signature of the archive exported at %s\n", archive.ExportedAt.Format(time.RFC3339))
+	case !allowUnsigned:
+		return errors.New("import requires --public-key to verify the signature of the archive, or --allow-unsigned")
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	return backup.Import(ctx, c, archive, options, out)
+}
+
+func newClient() (client.Client, error) {
+	cfg, err := ctrl.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	if err := approvalv1alpha1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	return c, nil
+}
+
+// checker looks up whether NetworkPolicies are approved the way the webhook does
+type checker struct {
+	// client reads approvals, templates and requests from the cluster, nil when checking against secrets
+	client client.Client
+	// secrets are the exported approval Secrets
+	secrets map[types.NamespacedName]*corev1.Secret
+	// signatures verify signed NetworkPolicies, nil if no trusted keys were given
+	signatures *signature.Verifier
+	now        time.Time
+}
+
+// check prints the status of every NetworkPolicy and returns the ones that are not approved
+func check(ctx context.Context, c *checker, out io.Writer, policies []policy) ([]string, error) {
+	unapproved := []string{}
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tNETWORKPOLICY\tHASH\tSTATUS")
+	for _, p := range policies {
+		status, approved, err := c.status(ctx, p)
+		if err != nil {
+			return nil, fmt.Errorf("NetworkPolicy %s/%s: %w", p.np.Namespace, p.np.Name, err)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", p.np.Namespace, p.np.Name, p.hash, status)
+		if !approved {
+			unapproved = append(unapproved, fmt.Sprintf("%s/%s (%s)", p.np.Namespace, p.np.Name, status))
+		}
+	}
+	return unapproved, w.Flush()
+}
+
+// status describes the approval of a NetworkPolicy and reports whether the webhook admits it
+func (c *checker) status(ctx context.Context, p policy) (string, bool, error) {
+	secret, err := c.secret(ctx, p.np.Namespace, p.np.Name)
+	if err != nil {
+		return "", false, err
+	}
+	status, approved := c.secretStatus(secret, p.hash)
+	if approved || status != "" {
+		return status, approved, nil
+	}
+
+	if c.client != nil {
+		template, _, err := templates.Find(ctx, c.client, p.np)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to match PolicyTemplates: %w", err)
+		}
+		if template != nil {
+			return "approved by PolicyTemplate " + template.Name, true, nil
+		}
+	}
+
+	if sig, ok := p.np.Annotations[approval.AnnotationSignature]; ok {
+		if c.signatures == nil {
+			return "signed, pass --trusted-keys to verify the signature", false, nil
+		}
+		key, err := c.signatures.Verify(p.np.Namespace, p.hash, sig)
+		if err != nil {
+			return "signature does not verify: " + err.Error(), false, nil
+		}
+		return "pre-approved by signature of trusted key " + key, true, nil
+	}
+
+	if c.client != nil {
+		csr := &certificatesv1.CertificateSigningRequest{}
+		err := c.client.Get(ctx, types.NamespacedName{Name: approval.Name(p.np.Namespace, p.np.Name)}, csr)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return "", false, fmt.Errorf("failed to get approval request: %w", err)
+		}
+		if err == nil && csr.Annotations[approval.AnnotationApprovalHash] == p.hash {
+			for _, condition := range csr.Status.Conditions {
+				switch condition.Type {
+				case certificatesv1.CertificateDenied:
+					return "denied in request " + csr.Name, false, nil
+				case certificatesv1.CertificateApproved:
+					return "approved in request " + csr.Name + ", not recorded by the controller yet", false, nil
+				}
+			}
+			return "pending in request " + csr.Name, false, nil
+		}
+	}
+	return "not approved", false, nil
+}
+
+// secret returns the approval Secret of a NetworkPolicy, nil if there is none
+func (c *checker) secret(ctx context.Context, namespace, name string) (*corev1.Secret, error) {
+	key := types.NamespacedName{Namespace: namespace, Name: approval.Name(namespace, name)}
+	if c.client == nil {
+		return c.secrets[key], nil
+	}
+	secret := &corev1.Secret{}
+	if err := c.client.Get(ctx, key, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get approval secret: %w", err)
+	}
+	if secret.Type != approval.SecretTypeNetworkPolicyApproval {
+		return nil, nil
+	}
+	return secret, nil
+}
+
+// secretStatus describes the approval of hash in secret, an empty status if secret does not approve hash
+func (c *checker) secretStatus(secret *corev1.Secret, hash string) (string, bool) {
+	if secret == nil {
+		return "", false
+	}
+	if string(secret.Data[approval.SecretKeyHash]) == hash {
+		if notAfter, ok := approval.CertificateNotAfter(secret.Data[approval.SecretKeyCertificate]); ok && notAfter.Before(c.now) {
+			return "approval certificate expired at " + notAfter.UTC().Format(time.RFC3339), false
+		}
+		window, err := approval.AnnotatedWindow(secret.Annotations)
+		if err != nil {
+			return "invalid approval window: " + err.Error(), false
+		}
+		notBefore, notAfter := window.Format()
+		switch {
+		case window.Pending(c.now):
+			return "approved from " + notBefore, false
+		case window.Ended(c.now):
+			return "approval ended at " + notAfter, false
+		}
+		return "approved", true
+	}
+	if string(secret.Data[approval.SecretKeyPendingPrefix+approval.SecretKeyHash]) == hash {
+		window, err := approval.PendingWindow(secret.Data)
+		if err != nil {
+			return "invalid approval window: " + err.Error(), false
+		}
+		notBefore, _ := window.Format()
+		return "approved from " + notBefore, false
+	}
+	return "", false
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// audit-verify checks that a NetworkPolicy approval audit trail has not been tampered with.
+//
+//	audit-verify /var/log/approve-controller/audit.jsonl
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/hadi2f244/approve-controller/internal/pkg/audit"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s <audit-file>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, path := range flag.Args() {
+		if err := verifyFile(path); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: TAMPERED: %v\n", path, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func verifyFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	last, err := audit.Verify(file)
+	if err != nil {
+		return err
+	}
+	if last == nil {
+		fmt.Printf("%s: OK (empty)\n", path)
+		return nil
+	}
+	fmt.Printf("%s: OK, %d records, head %s\n", path, last.Sequence, last.RecordHash)
+	return nil
+}
@@ -0,0 +1,618 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-npapprove is a kubectl plugin for reviewing NetworkPolicy approval requests.
+//
+//	kubectl npapprove list [-n namespace]
+//	kubectl npapprove show <namespace>/<name>
+//	kubectl npapprove approve <namespace>/<name> --reason "reviewed in TICKET-42"
+//	kubectl npapprove deny <namespace>/<name> --reason "opens the database to every namespace"
+//	kubectl npapprove approve --change-set <namespace>/<change-id> --reason "release 1.4"
+//	kubectl npapprove revoke <namespace>/<name> --reason "INC-7 opened the database"
+//	kubectl npapprove history <namespace>/<name> [--hash <hash>]
+//	kubectl npapprove rollback <namespace>/<name> --to <hash> --incident INC-7
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hadi2f244/approve-controller/internal/pkg/analyzer"
+	"github.com/hadi2f244/approve-controller/internal/pkg/approval"
+	decisions "github.com/hadi2f244/approve-controller/internal/pkg/decision"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/duration"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// conditionReason is set on the CSR conditions written by this plugin
+const conditionReason = "NPApprove"
+
+func main() {
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "Usage: %s [--kubeconfig file] <command> [flags]\n\n", os.Args[0])
+		fmt.Fprintln(out, "Commands:")
+		fmt.Fprintln(out, "  list [-n namespace]                      List pending NetworkPolicy approval requests")
+		fmt.Fprintln(out, "  show <namespace>/<name>                  Show the requested policy and its diff against the approved one")
+		fmt.Fprintln(out, "  approve <namespace>/<name> --reason ...  Approve a request, optionally from --not-before until --not-after")
+		fmt.Fprintln(out, "  deny <namespace>/<name> --reason ...     Deny a request")
+		fmt.Fprintln(out, "  revoke <namespace>/<name> --reason ...   Revoke the approval of a NetworkPolicy")
+		fmt.Fprintln(out, "  history <namespace>/<name>               List the approved versions of a NetworkPolicy, newest first")
+		fmt.Fprintln(out, "  rollback <namespace>/<name> --to <hash>  Restore an approved version for an --incident without a new approval")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "show, approve and deny take a change-set as <namespace>/<change-id> with --change-set.")
+		fmt.Fprintln(out)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(context.Background(), flag.Arg(0), flag.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, command string, args []string) error {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	var namespace, reason, notBefore, notAfter, hash, incident string
+	var changeSet bool
+	switch command {
+	case "list":
+		flags.StringVar(&namespace, "n", "", "Only list requests of this namespace")
+	case "show":
+		flags.BoolVar(&changeSet, "change-set", false, "Show the change-set given as <namespace>/<change-id> and all of its requests")
+	case "revoke":
+		flags.StringVar(&reason, "reason", "", "Reason for the revocation, recorded in the audit trail (required)")
+	case "history":
+		flags.StringVar(&hash, "hash", "", "Show the NetworkPolicy of the version whose hash starts with this")
+	case "rollback":
+		flags.StringVar(&hash, "to", "", "Hash, or its prefix, of the approved version to restore (required)")
+		flags.StringVar(&incident, "incident", "", "Incident the rollback is made for, recorded in the audit trail and Events (required)")
+	case "approve", "deny":
+		flags.BoolVar(&changeSet, "change-set", false, "Decide the change-set given as <namespace>/<change-id> and with it all of its requests")
+		flags.StringVar(&reason, "reason", "", "Reason for the decision, recorded on the CSR and in the audit trail (required)")
+		if command == "approve" {
+			flags.StringVar(&notBefore, "not-before", "", "RFC3339 time the approval takes effect, the controller applies the policy then")
+			flags.StringVar(&notAfter, "not-after", "", "RFC3339 time after which the approval no longer admits the policy")
+		}
+	default:
+		flag.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := ctrl.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	c, err := client.New(cfg, client.Options{Scheme: clientgoscheme.Scheme})
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+
+	if command == "list" {
+		return list(ctx, c, os.Stdout, namespace)
+	}
+
+	// Flags may follow the NetworkPolicy, e.g. "approve default/allow-dns --reason ..."
+	target := flags.Arg(0)
+	if flags.NArg() > 1 {
+		if err := flags.Parse(flags.Args()[1:]); err != nil {
+			return err
+		}
+	}
+	if target == "" {
+		return fmt.Errorf("%s requires a NetworkPolicy as <namespace>/<name>", command)
+	}
+	switch command {
+	case "revoke":
+		return revoke(ctx, c, os.Stdout, target, reason)
+	case "history":
+		return history(ctx, c, os.Stdout, target, hash)
+	case "rollback":
+		return rollback(ctx, c, os.Stdout, target, hash, incident)
+	}
+	get := getRequest
+	if changeSet {
+		get = getChangeSet
+	}
+	csr, err := get(ctx, c, target)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "show":
+		if changeSet {
+			return showChangeSet(ctx, c, os.Stdout, csr)
+		}
+		return show(ctx, c, os.Stdout, csr)
+	case "approve":
+		if changeSet && (notBefore != "" || notAfter != "") {
+			return errors.New("--not-before and --not-after cannot be used for change-sets, their requests are approved right away")
+		}
+		window, err := approval.ParseWindow(notBefore, notAfter)
+		if err != nil {
+			return err
+		}
+		return decide(ctx, c, csr, certificatesv1.CertificateApproved, reason, window)
+	default:
+		return decide(ctx, c, csr, certificatesv1.CertificateDenied, reason, approval.Window{})
+	}
+}
+
+// getRequest returns the approval CSR of the NetworkPolicy given as <namespace>/<name>
+func getRequest(ctx context.Context, c client.Client, target string) (*certificatesv1.CertificateSigningRequest, error) {
+	namespace, name, ok := strings.Cut(target, "/")
+	if !ok || namespace == "" || name == "" {
+		return nil, fmt.Errorf("expected <namespace>/<name> but got %q", target)
+	}
+
+	csr := &certificatesv1.CertificateSigningRequest{}
+	if err := c.Get(ctx, types.NamespacedName{Name: approval.Name(namespace, name)}, csr); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("no approval request found for NetworkPolicy %s", target)
+		}
+		return nil, fmt.Errorf("failed to get approval request: %w", err)
+	}
+	if _, ok := csr.Labels[approval.LabelNetworkPolicyApproval]; !ok {
+		return nil, fmt.Errorf("CSR %s is not a NetworkPolicy approval request", csr.Name)
+	}
+	return csr, nil
+}
+
+// getChangeSet returns the change-set given as <namespace>/<change-id>
+func getChangeSet(ctx context.Context, c client.Client, target string) (*certificatesv1.CertificateSigningRequest, error) {
+	namespace, changeID, ok := strings.Cut(target, "/")
+	if !ok || namespace == "" || approval.ChangeSetID(changeID) == "" {
+		return nil, fmt.Errorf("expected <namespace>/<change-id> but got %q", target)
+	}
+
+	csr := &certificatesv1.CertificateSigningRequest{}
+	if err := c.Get(ctx, types.NamespacedName{Name: approval.ChangeSetName(namespace, approval.ChangeSetID(changeID))}, csr); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("no change-set %s found", target)
+		}
+		return nil, fmt.Errorf("failed to get change-set: %w", err)
+	}
+	if csr.Labels[approval.LabelNetworkPolicyApproval] != approval.LabelValueChangeSet {
+		return nil, fmt.Errorf("CSR %s is not a change-set", csr.Name)
+	}
+	return csr, nil
+}
+
+// list prints the pending approval requests, oldest first
+func list(ctx context.Context, c client.Client, out io.Writer, namespace string) error {
+	csrList := &certificatesv1.CertificateSigningRequestList{}
+	if err := c.List(ctx, csrList, client.MatchingLabels{approval.LabelNetworkPolicyApproval: "true"}); err != nil {
+		return fmt.Errorf("failed to list approval requests: %w", err)
+	}
+
+	pending := []certificatesv1.CertificateSigningRequest{}
+	for _, csr := range csrList.Items {
+		if len(csr.Status.Conditions) > 0 {
+			continue
+		}
+		if namespace != "" && csr.Annotations[approval.AnnotationNamespace] != namespace {
+			continue
+		}
+		pending = append(pending, csr)
+	}
+	if len(pending) == 0 {
+		fmt.Fprintln(out, "No pending NetworkPolicy approval requests")
+		return nil
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].CreationTimestamp.Before(&pending[j].CreationTimestamp)
+	})
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tNETWORKPOLICY\tREQUESTER\tRISK\tAGE\tCHANGE-SET\tCSR")
+	for _, csr := range pending {
+		changeSet := csr.Annotations[approval.AnnotationChangeSet]
+		if changeSet == "" {
+			changeSet = "<none>"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			csr.Annotations[approval.AnnotationNamespace],
+			csr.Annotations[approval.AnnotationName],
+			valueOrUnknown(csr.Annotations[approval.AnnotationRequester]),
+			valueOrUnknown(csr.Annotations[approval.AnnotationRiskScore]),
+			duration.HumanDuration(time.Since(csr.CreationTimestamp.Time)),
+			changeSet,
+			csr.Name)
+	}
+	return w.Flush()
+}
+
+// show prints the request, the requested NetworkPolicy and its diff against the approved version
+func show(ctx context.Context, c client.Client, out io.Writer, csr *certificatesv1.CertificateSigningRequest) error {
+	namespace := csr.Annotations[approval.AnnotationNamespace]
+	name := csr.Annotations[approval.AnnotationName]
+
+	fmt.Fprintf(out, "CSR:        %s\n", csr.Name)
+	fmt.Fprintf(out, "Requester:  %s\n", valueOrUnknown(csr.Annotations[approval.AnnotationRequester]))
+	fmt.Fprintf(out, "Age:        %s\n", duration.HumanDuration(time.Since(csr.CreationTimestamp.Time)))
+	fmt.Fprintf(out, "Hash:       %s\n", csr.Annotations[approval.AnnotationApprovalHash])
+	fmt.Fprintf(out, "Status:     %s\n", decisions.Status(csr))
+	if groups := approval.ApproverGroups(csr.Annotations); len(groups) > 0 {
+		fmt.Fprintf(out, "Freeze:     %s, approvers have to be in one of %s\n",
+			csr.Annotations[approval.AnnotationFreeze], strings.Join(groups, ", "))
+	}
+	if expires, ok := approval.BreakGlassExpiry(csr.Annotations); ok {
+		fmt.Fprintf(out, "Break-glass: %s, approve by %s or the change is rolled back\n",
+			csr.Annotations[approval.AnnotationBreakGlass], expires.Local().Format(time.RFC3339))
+	}
+	if notBefore, notAfter := csr.Annotations[approval.AnnotationNotBefore], csr.Annotations[approval.AnnotationNotAfter]; notBefore != "" || notAfter != "" {
+		window := "approved from " + notBefore
+		if notBefore == "" {
+			window = "approved"
+		}
+		if notAfter != "" {
+			window += " until " + notAfter
+		}
+		fmt.Fprintf(out, "Window:     %s\n", window)
+	}
+	if required := approval.RequiredApprovers(csr.Annotations); required > 1 {
+		fmt.Fprintf(out, "Approvers:  %d/%d %s\n", len(approval.Approvers(csr.Annotations)), required,
+			strings.Join(approval.Approvers(csr.Annotations), ", "))
+	}
+
+	if affected := approval.AffectedNamespaces(csr.Annotations); len(affected) > 0 {
+		approvals := approval.NamespaceApprovals(csr.Annotations)
+		entries := make([]string, 0, len(affected))
+		for _, namespace := range affected {
+			if approver, ok := approvals[namespace]; ok {
+				entries = append(entries, fmt.Sprintf("%s (approved by %s)", namespace, approver))
+			} else {
+				entries = append(entries, fmt.Sprintf("%s (pending)", namespace))
+			}
+		}
+		fmt.Fprintf(out, "Affects:    %s\n", strings.Join(entries, ", "))
+	}
+
+	if score, ok := csr.Annotations[approval.AnnotationRiskScore]; ok {
+		fmt.Fprintf(out, "Risk score: %s/%d\n", score, analyzer.MaxScore)
+		findings := []analyzer.Finding{}
+		if err := json.Unmarshal([]byte(csr.Annotations[approval.AnnotationRiskFindings]), &findings); err != nil {
+			return fmt.Errorf("failed to parse risk findings: %w", err)
+		}
+		for _, finding := range findings {
+			fmt.Fprintf(out, "  [%s] %s: %s\n", finding.Severity, finding.Path, finding.Message)
+		}
+	}
+
+	specData, ok := csr.Annotations[approval.AnnotationSpec]
+	if !ok {
+		fmt.Fprintln(out, "\nThe request does not contain the requested spec, it was filed by an older webhook")
+		return nil
+	}
+	requested, err := approval.DecodeSpec([]byte(specData))
+	if err != nil {
+		return err
+	}
+	rendered, err := approval.RenderPolicy(namespace, name, requested)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "\nRequested NetworkPolicy:\n%s", rendered)
+
+	approved, err := approvedSpec(ctx, c, namespace, name)
+	if err != nil {
+		return err
+	}
+	if approved == nil {
+		fmt.Fprintln(out, "\nNo approved version exists, the whole policy is new:")
+	} else {
+		fmt.Fprintln(out, "\nDiff against the approved version:")
+	}
+	fmt.Fprint(out, approval.DiffSpecs(approved, requested))
+	return nil
+}
+
+// showChangeSet prints the change-set and each of its requests
+func showChangeSet(ctx context.Context, c client.Client, out io.Writer, changeSet *certificatesv1.CertificateSigningRequest) error {
+	namespace := changeSet.Annotations[approval.AnnotationNamespace]
+	members := approval.ChangeSetMembers(changeSet.Annotations)
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(out, "Change-set: %s\n", changeSet.Name)
+	if changeID := changeSet.Annotations[approval.AnnotationChangeID]; changeID != "" {
+		fmt.Fprintf(out, "Change-id:  %s\n", changeID)
+	}
+	fmt.Fprintf(out, "Requester:  %s\n", valueOrUnknown(changeSet.Annotations[approval.AnnotationRequester]))
+	fmt.Fprintf(out, "Age:        %s\n", duration.HumanDuration(time.Since(changeSet.CreationTimestamp.Time)))
+	fmt.Fprintf(out, "Status:     %s\n", decisions.Status(changeSet))
+	if groups := approval.ApproverGroups(changeSet.Annotations); len(groups) > 0 {
+		fmt.Fprintf(out, "Freeze:     %s, approvers have to be in one of %s\n",
+			changeSet.Annotations[approval.AnnotationFreeze], strings.Join(groups, ", "))
+	}
+	fmt.Fprintf(out, "Members:    %d NetworkPolicies in namespace %s\n", len(names), namespace)
+
+	for _, name := range names {
+		fmt.Fprintf(out, "\n--- %s/%s\n", namespace, name)
+		csr, err := getRequest(ctx, c, namespace+"/"+name)
+		if err != nil {
+			fmt.Fprintf(out, "%v\n", err)
+			continue
+		}
+		if csr.Annotations[approval.AnnotationApprovalHash] != members[name] {
+			fmt.Fprintln(out, "The NetworkPolicy changed since it joined the change-set, approving the change-set does not admit it")
+			continue
+		}
+		if err := show(ctx, c, out, csr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// approvedSpec returns the spec stored in the approval Secret, nil if there is no approved version
+func approvedSpec(ctx context.Context, c client.Client, namespace, name string) (*networkingv1.NetworkPolicySpec, error) {
+	secret := &corev1.Secret{}
+	err := c.Get(ctx, types.NamespacedName{Name: approval.Name(namespace, name), Namespace: namespace}, secret)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get approval secret: %w", err)
+	}
+	specData, ok := secret.Data[approval.SecretKeySpec]
+	if secret.Type != approval.SecretTypeNetworkPolicyApproval || !ok {
+		return nil, nil
+	}
+	return approval.DecodeSpec(specData)
+}
+
+// decide approves or denies a pending request with the given reason, an approval only admits the policy within window
+func decide(ctx context.Context, c client.Client, csr *certificatesv1.CertificateSigningRequest,
+	decision certificatesv1.RequestConditionType, reason string, window approval.Window) error {
+	if strings.TrimSpace(reason) == "" {
+		return errors.New("--reason is required")
+	}
+	if len(csr.Status.Conditions) > 0 {
+		return fmt.Errorf("request %s is already %s", csr.Name, decisions.Status(csr))
+	}
+
+	if decision == certificatesv1.CertificateApproved {
+		if err := scheduleApproval(ctx, c, csr, window); err != nil {
+			return err
+		}
+	}
+	_, err := decisions.Decide(ctx, c, csr, decision, reason, currentUser(ctx, c), conditionReason, decisions.SelfCanApprove(c), os.Stdout)
+	return err
+}
+
+// revoke deletes the approval of the NetworkPolicy given as <namespace>/<name>, the controller records the
+// revocation with the reason
+func revoke(ctx context.Context, c client.Client, out io.Writer, target, reason string) error {
+	if strings.TrimSpace(reason) == "" {
+		return errors.New("--reason is required")
+	}
+	secret, err := getApproval(ctx, c, target)
+	if err != nil {
+		return err
+	}
+
+	if user := currentUser(ctx, c); user != "" {
+		reason = fmt.Sprintf("%s (by %s)", reason, user)
+	}
+	patch := client.MergeFrom(secret.DeepCopy())
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[approval.AnnotationRevocationReason] = reason
+	if err := c.Patch(ctx, secret, patch); err != nil {
+		return fmt.Errorf("failed to record the revocation reason: %w", err)
+	}
+	if err := c.Delete(ctx, secret); err != nil {
+		return fmt.Errorf("failed to revoke approval: %w", err)
+	}
+	fmt.Fprintf(out, "revoked the approval of %s (hash %s)\n", target, secret.Data[approval.SecretKeyHash])
+	return nil
+}
+
+// history prints the approved versions of the NetworkPolicy given as <namespace>/<name>, newest first, or the
+// NetworkPolicy of the version whose hash starts with hash
+func history(ctx context.Context, c client.Client, out io.Writer, target, hash string) error {
+	secret, err := getApproval(ctx, c, target)
+	if err != nil {
+		return err
+	}
+	versions, err := approval.History(secret.Data)
+	if err != nil {
+		return err
+	}
+	if hash != "" {
+		version, ok := approval.FindVersion(versions, hash)
+		if !ok {
+			return fmt.Errorf("no approved version of %s has hash %s", target, hash)
+		}
+		spec, err := approval.DecodeSpec([]byte(version.Spec))
+		if err != nil {
+			return err
+		}
+		namespace, name, _ := strings.Cut(target, "/")
+		rendered, err := approval.RenderPolicy(namespace, name, spec)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "# hash %s approved at %s by %s: %s\n%s", version.Hash, version.ApprovedAt.Local().Format(time.RFC3339),
+			valueOrUnknown(version.Approver), version.Reason, rendered)
+		return nil
+	}
+	if len(versions) == 0 {
+		fmt.Fprintf(out, "No approved versions of %s are recorded\n", target)
+		return nil
+	}
+
+	current := string(secret.Data[approval.SecretKeyHash])
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "HASH\tAPPROVED\tAPPROVER\tRESTORED\tREASON")
+	for i := len(versions) - 1; i >= 0; i-- {
+		version := versions[i]
+		shortHash := version.Hash[:min(len(version.Hash), 12)]
+		if version.Hash == current && i == len(versions)-1 {
+			shortHash += " (current)"
+		}
+		restored := "-"
+		if version.RestoredAt != nil {
+			restored = duration.HumanDuration(time.Since(*version.RestoredAt)) + " ago"
+		}
+		fmt.Fprintf(w, "%s\t%s ago\t%s\t%s\t%s\n", shortHash, duration.HumanDuration(time.Since(version.ApprovedAt)),
+			valueOrUnknown(version.Approver), restored, version.Reason)
+	}
+	return w.Flush()
+}
+
+// rollback sets the NetworkPolicy given as <namespace>/<name> to the approved version whose hash starts with hash,
+// the webhook admits it because the version is in the approval history. The controller then makes the version the
+// current approval and records the rollback for incident
+func rollback(ctx context.Context, c client.Client, out io.Writer, target, hash, incident string) error {
+	if hash == "" {
+		return errors.New("--to is required")
+	}
+	incident = strings.TrimSpace(incident)
+	if incident == "" {
+		return errors.New("--incident is required")
+	}
+	secret, err := getApproval(ctx, c, target)
+	if err != nil {
+		return err
+	}
+	versions, err := approval.History(secret.Data)
+	if err != nil {
+		return err
+	}
+	version, ok := approval.FindVersion(versions, hash)
+	if !ok {
+		return fmt.Errorf("no approved version of %s has hash %s, see kubectl npapprove history %s", target, hash, target)
+	}
+	spec, err := approval.DecodeSpec([]byte(version.Spec))
+	if err != nil {
+		return err
+	}
+
+	namespace, name, _ := strings.Cut(target, "/")
+	key := types.NamespacedName{Name: name, Namespace: namespace}
+	np := &networkingv1.NetworkPolicy{}
+	err = c.Get(ctx, key, np)
+	switch {
+	case apierrors.IsNotFound(err):
+		np.Name, np.Namespace = key.Name, key.Namespace
+		np.Annotations = map[string]string{approval.AnnotationRollbackTo: version.Hash, approval.AnnotationIncident: incident}
+		np.Spec = *spec
+		err = c.Create(ctx, np)
+	case err == nil:
+		patch := client.MergeFrom(np.DeepCopy())
+		if np.Annotations == nil {
+			np.Annotations = map[string]string{}
+		}
+		np.Annotations[approval.AnnotationRollbackTo] = version.Hash
+		np.Annotations[approval.AnnotationIncident] = incident
+		np.Spec = *spec
+		err = c.Patch(ctx, np, patch)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to roll back NetworkPolicy %s: %w", target, err)
+	}
+	fmt.Fprintf(out, "rolled back %s to the version approved at %s (hash %s) for incident %s\n", target,
+		version.ApprovedAt.Local().Format(time.RFC3339), version.Hash, incident)
+	return nil
+}
+
+// getApproval returns the approval Secret of the NetworkPolicy given as <namespace>/<name>
+func getApproval(ctx context.Context, c client.Client, target string) (*corev1.Secret, error) {
+	namespace, name, ok := strings.Cut(target, "/")
+	if !ok || namespace == "" || name == "" {
+		return nil, fmt.Errorf("expected <namespace>/<name> but got %q", target)
+	}
+
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: approval.Name(namespace, name), Namespace: namespace}, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("NetworkPolicy %s has no approval", target)
+		}
+		return nil, fmt.Errorf("failed to get approval: %w", err)
+	}
+	if secret.Type != approval.SecretTypeNetworkPolicyApproval {
+		return nil, fmt.Errorf("secret %s is not a NetworkPolicy approval", secret.Name)
+	}
+	return secret, nil
+}
+
+// scheduleApproval records the window of the approval on the request
+func scheduleApproval(ctx context.Context, c client.Client, csr *certificatesv1.CertificateSigningRequest, window approval.Window) error {
+	notBefore, notAfter := window.Format()
+	if csr.Annotations[approval.AnnotationNotBefore] == notBefore && csr.Annotations[approval.AnnotationNotAfter] == notAfter {
+		return nil
+	}
+	patch := client.MergeFrom(csr.DeepCopy())
+	for key, value := range map[string]string{approval.AnnotationNotBefore: notBefore, approval.AnnotationNotAfter: notAfter} {
+		if value == "" {
+			delete(csr.Annotations, key)
+		} else {
+			csr.Annotations[key] = value
+		}
+	}
+	if err := c.Patch(ctx, csr, patch); err != nil {
+		return fmt.Errorf("failed to record the approval window: %w", err)
+	}
+	return nil
+}
+
+// currentUser returns the user of the kubeconfig, empty if the cluster cannot tell
+func currentUser(ctx context.Context, c client.Client) string {
+	review := &authenticationv1.SelfSubjectReview{}
+	if err := c.Create(ctx, review); err != nil {
+		return ""
+	}
+	return review.Status.UserInfo.Username
+}
+
+func valueOrUnknown(value string) string {
+	if value == "" {
+		return "<unknown>"
+	}
+	return value
+}
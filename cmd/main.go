@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"github.com/hadi2f244/approve-controller/internal/pkg/log"
@@ -38,7 +39,21 @@ import (
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
+	approvalv1alpha1 "github.com/hadi2f244/approve-controller/api/v1alpha1"
 	"github.com/hadi2f244/approve-controller/internal/controller"
+	"github.com/hadi2f244/approve-controller/internal/pkg/audit"
+	"github.com/hadi2f244/approve-controller/internal/pkg/authz"
+	"github.com/hadi2f244/approve-controller/internal/pkg/autoapprove"
+	"github.com/hadi2f244/approve-controller/internal/pkg/breakglass"
+	"github.com/hadi2f244/approve-controller/internal/pkg/callback"
+	"github.com/hadi2f244/approve-controller/internal/pkg/celrules"
+	"github.com/hadi2f244/approve-controller/internal/pkg/consts"
+	"github.com/hadi2f244/approve-controller/internal/pkg/dashboard"
+	"github.com/hadi2f244/approve-controller/internal/pkg/events"
+	"github.com/hadi2f244/approve-controller/internal/pkg/freeze"
+	"github.com/hadi2f244/approve-controller/internal/pkg/httpserver"
+	"github.com/hadi2f244/approve-controller/internal/pkg/notify"
+	"github.com/hadi2f244/approve-controller/internal/pkg/signature"
 	webhooknetworkingv1 "github.com/hadi2f244/approve-controller/internal/webhook/v1"
 	// +kubebuilder:scaffold:imports
 )
@@ -51,6 +66,7 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
+	utilruntime.Must(approvalv1alpha1.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
@@ -207,12 +223,203 @@ func main() {
 		os.Exit(1)
 	}
 
+	config, err := consts.NewConfiguration()
+	if err != nil {
+		setupLog.Error(err, "unable to load operator configuration")
+		os.Exit(1)
+	}
+	driftRemediation, err := config.GetDriftRemediation()
+	if err != nil {
+		setupLog.Error(err, "invalid operator configuration")
+		os.Exit(1)
+	}
+
+	var auditSink audit.Sink = audit.NopSink{}
+	if auditFilePath := config.GetAuditFilePath(); auditFilePath != "" {
+		fileSink, err := audit.NewFileSink(auditFilePath)
+		if err != nil {
+			setupLog.Error(err, "unable to open audit trail", "path", auditFilePath)
+			os.Exit(1)
+		}
+		defer fileSink.Close()
+		auditSink = fileSink
+	}
+
+	autoApprovalRules, err := config.GetAutoApprovalRules()
+	if err != nil {
+		setupLog.Error(err, "invalid operator configuration")
+		os.Exit(1)
+	}
+	autoApproval := autoapprove.NewEngine(autoApprovalRules)
+	celRules, err := config.GetCELRules()
+	if err != nil {
+		setupLog.Error(err, "invalid operator configuration")
+		os.Exit(1)
+	}
+	celEvaluator, err := celrules.NewEvaluator(celRules)
+	if err != nil {
+		setupLog.Error(err, "invalid operator configuration")
+		os.Exit(1)
+	}
+	freezeWindows, err := config.GetFreezeWindows()
+	if err != nil {
+		setupLog.Error(err, "invalid operator configuration")
+		os.Exit(1)
+	}
+	freezes, err := freeze.NewCalendar(freezeWindows)
+	if err != nil {
+		setupLog.Error(err, "invalid operator configuration")
+		os.Exit(1)
+	}
+	breakGlass := breakglass.NewPolicy(config.GetBreakGlassGroups(), config.GetBreakGlassDuration())
+	trustedKeys, err := config.GetTrustedKeys()
+	if err != nil {
+		setupLog.Error(err, "invalid operator configuration")
+		os.Exit(1)
+	}
+	signatures, err := signature.NewVerifier(trustedKeys)
+	if err != nil {
+		setupLog.Error(err, "invalid operator configuration")
+		os.Exit(1)
+	}
+	notificationSinks, err := config.GetNotificationSinks()
+	if err != nil {
+		setupLog.Error(err, "invalid operator configuration")
+		os.Exit(1)
+	}
+	notificationOptions := config.GetNotificationOptions()
+	if deadLetterFilePath := config.GetNotificationDeadLetterFilePath(); deadLetterFilePath != "" {
+		deadLetters, err := notify.NewDeadLetterFile(deadLetterFilePath)
+		if err != nil {
+			setupLog.Error(err, "unable to open dead letter file", "path", deadLetterFilePath)
+			os.Exit(1)
+		}
+		defer deadLetters.Close()
+		notificationOptions.DeadLetters = deadLetters
+	}
+	callbackConfig, err := config.GetCallback()
+	if err != nil {
+		setupLog.Error(err, "invalid operator configuration")
+		os.Exit(1)
+	}
+	// callbackDelegate records the decisions of callback approvers, empty unless callbacks are enabled
+	callbackDelegate := ""
+	if callbackConfig.BindAddress != "" {
+		callbackDelegate, err = callback.Delegate(context.Background(), mgr.GetConfig(), mgr.GetScheme())
+		if err != nil {
+			setupLog.Error(err, "unable to set up approval callbacks")
+			os.Exit(1)
+		}
+		signer := callback.NewSigner(callbackConfig.Key, callbackConfig.TokenTTL)
+		notificationOptions.Links = &callback.LinkIssuer{BaseURL: callbackConfig.BaseURL, Signer: signer}
+		if err := mgr.Add(&httpserver.Server{
+			Name:    "approval callbacks",
+			Address: callbackConfig.BindAddress,
+			Handler: callback.Mux(&callback.Handler{
+				Client:     mgr.GetClient(),
+				Authorizer: authz.NewAuthorizer(mgr.GetClient()),
+				Signer:     signer,
+			}),
+		}); err != nil {
+			setupLog.Error(err, "unable to add callback server")
+			os.Exit(1)
+		}
+	}
+	if dashboardAddress := config.GetDashboardBindAddress(); dashboardAddress != "" {
+		dashboardAuthenticator, dashboardAuthorizer, err := dashboard.NewDelegatingAuth(mgr.GetConfig(), mgr.GetHTTPClient())
+		if err != nil {
+			setupLog.Error(err, "unable to set up dashboard authentication")
+			os.Exit(1)
+		}
+		if err := mgr.Add(&httpserver.Server{
+			Name:    "dashboard",
+			Address: dashboardAddress,
+			Handler: dashboard.Mux(&dashboard.Handler{
+				Store: &dashboard.Store{
+					Client:        mgr.GetClient(),
+					AuditFilePath: config.GetAuditFilePath(),
+					HistoryLimit:  config.GetDashboardHistoryLimit(),
+				},
+				Authenticator: dashboardAuthenticator,
+				Authorizer:    dashboardAuthorizer,
+			}),
+		}); err != nil {
+			setupLog.Error(err, "unable to add dashboard server")
+			os.Exit(1)
+		}
+	}
+	notifier, err := notify.NewDispatcher(notificationSinks, notificationOptions)
+	if err != nil {
+		setupLog.Error(err, "invalid operator configuration")
+		os.Exit(1)
+	}
+	if err := mgr.Add(notifier); err != nil {
+		setupLog.Error(err, "unable to add notification dispatcher")
+		os.Exit(1)
+	}
+	config.OnChange(func() {
+		breakGlass.Set(config.GetBreakGlassGroups(), config.GetBreakGlassDuration())
+		rules, err := config.GetAutoApprovalRules()
+		if err != nil {
+			setupLog.Error(err, "keeping the previous auto-approval rules, the reloaded ones are invalid")
+		} else {
+			autoApproval.SetRules(rules)
+		}
+		celRules, err := config.GetCELRules()
+		if err == nil {
+			err = celEvaluator.SetRules(celRules)
+		}
+		if err != nil {
+			setupLog.Error(err, "keeping the previous CEL rules, the reloaded ones are invalid")
+		}
+		freezeWindows, err := config.GetFreezeWindows()
+		if err == nil {
+			err = freezes.SetWindows(freezeWindows)
+		}
+		if err != nil {
+			setupLog.Error(err, "keeping the previous freeze windows, the reloaded ones are invalid")
+		}
+		trustedKeys, err := config.GetTrustedKeys()
+		if err == nil {
+			err = signatures.SetKeys(trustedKeys)
+		}
+		if err != nil {
+			setupLog.Error(err, "keeping the previous trusted signing keys, the reloaded ones are invalid")
+		}
+		notificationSinks, err := config.GetNotificationSinks()
+		if err == nil {
+			err = notifier.SetSinks(notificationSinks)
+		}
+		if err != nil {
+			setupLog.Error(err, "keeping the previous notification sinks, the reloaded ones are invalid")
+		}
+	})
+
+	approvalEvents := events.NewEmitter(mgr.GetClient(), mgr.GetEventRecorderFor("networkpolicy-approval"))
+	approvalEvents.Notifier = notifier
+
 	// nolint:goconst
 	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
-		if err = webhooknetworkingv1.SetupNetworkPolicyWebhookWithManager(mgr); err != nil {
+		if err = webhooknetworkingv1.SetupNetworkPolicyWebhookWithManager(mgr, &webhooknetworkingv1.NetworkPolicyCustomValidator{
+			Audit:        auditSink,
+			Events:       approvalEvents,
+			AutoApproval: autoApproval,
+			CELRules:     celEvaluator,
+			BreakGlass:   breakGlass,
+			Freezes:      freezes,
+			Signatures:   signatures,
+			// Read once, changing them requires a restart
+			AutoApproveTightening: config.GetAutoApproveTightening(),
+			ChangeSetWindow:       config.GetChangeSetWindow(),
+		}); err != nil {
 			setupLog.Error(err, "unable to create webhook", "webhook", "NetworkPolicy")
 			os.Exit(1)
 		}
+		if err = webhooknetworkingv1.SetupCertificateSigningRequestWebhookWithManager(mgr,
+			&webhooknetworkingv1.CertificateSigningRequestCustomValidator{Delegate: callbackDelegate}); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "CertificateSigningRequest")
+			os.Exit(1)
+		}
 	}
 	if err = (&controller.CertificateSigningRequestReconciler{
 		SharedReconciler: controller.NewSharedReconciler(
@@ -222,10 +429,46 @@ func main() {
 			log.Log.WithName("NS2IPQuickNetworkPolicy"),
 			mgr.GetEventRecorderFor("NS2IPQuickNetworkPolicy"),
 		),
+		Audit:        auditSink,
+		Events:       approvalEvents,
+		HistoryLimit: config.GetApprovalHistoryLimit(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "CertificateSigningRequest")
 		os.Exit(1)
 	}
+	if err = (&controller.NetworkPolicyReconciler{
+		SharedReconciler: controller.NewSharedReconciler(
+			mgr.GetClient(),
+			mgr.GetScheme(),
+			mgr.GetAPIReader(),
+			log.Log.WithName("NetworkPolicy"),
+			mgr.GetEventRecorderFor("networkpolicy-drift"),
+		),
+		ResyncPeriod:       config.GetDriftResyncPeriod(),
+		Remediation:        driftRemediation,
+		ExcludedNamespaces: config.GetOperatorCalicoNetworkPolicyExcludedList(),
+		Events:             approvalEvents,
+		Audit:              auditSink,
+		ExpiryWarning:      config.GetNotificationExpiryWarning(),
+		Signatures:         signatures,
+		OrphanRetention:    config.GetApprovalOrphanRetention(),
+		HistoryLimit:       config.GetApprovalHistoryLimit(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "NetworkPolicy")
+		os.Exit(1)
+	}
+	if err = (&controller.PolicyTemplateReconciler{
+		SharedReconciler: controller.NewSharedReconciler(
+			mgr.GetClient(),
+			mgr.GetScheme(),
+			mgr.GetAPIReader(),
+			log.Log.WithName("PolicyTemplate"),
+			mgr.GetEventRecorderFor("policytemplate"),
+		),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PolicyTemplate")
+		os.Exit(1)
+	}
 	// +kubebuilder:scaffold:builder
 
 	if metricsCertWatcher != nil {
@@ -19,6 +19,10 @@ package controller
 import (
 	"context"
 	"fmt"
+	"github.com/hadi2f244/approve-controller/internal/pkg/approval"
+	"github.com/hadi2f244/approve-controller/internal/pkg/audit"
+	"github.com/hadi2f244/approve-controller/internal/pkg/events"
+	"github.com/hadi2f244/approve-controller/internal/pkg/metrics"
 	certificatesv1 "k8s.io/api/certificates/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -26,15 +30,23 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sort"
+	"strings"
+	"time"
 )
 
 // CertificateSigningRequestReconciler reconciles a CertificateSigningRequest object
 // Note: CertificateSigningRequest is a cluster-scoped resource, not namespace-scoped
 type CertificateSigningRequestReconciler struct {
 	*SharedReconciler
+	// Audit receives a record for every approval, denial and revocation, if set
+	Audit audit.Sink
+	// Events reports approvals, denials and revocations on the NetworkPolicy, if set
+	Events *events.Emitter
+	// HistoryLimit is how many approved versions the approval Secret keeps for rollbacks
+	HistoryLimit int
 }
 
 // +kubebuilder:rbac:groups=certificates.k8s.io,resources=certificatesigningrequests,verbs=get;list;watch;create;update;patch;delete
@@ -46,56 +58,6 @@ type CertificateSigningRequestReconciler struct {
 // +kubebuilder:rbac:groups="",resources=secrets/finalizers,verbs=update
 // Note: CSRs are cluster-scoped resources, while Secrets are namespace-scoped
 
-// cleanupOrphanedSecrets removes secrets that no longer have a corresponding CSR
-func (r *CertificateSigningRequestReconciler) cleanupOrphanedSecrets(ctx context.Context) error {
-	log := logf.FromContext(ctx)
-
-	// List all secrets with our type
-	secretList := &corev1.SecretList{}
-	if err := r.Client().List(ctx, secretList, client.MatchingFields{"type": "networkpolicy.webhook.io/approval"}); err != nil {
-		return fmt.Errorf("failed to list secrets: %w", err)
-	}
-
-	// Check each secret to see if its CSR still exists
-	for i := range secretList.Items {
-		secret := &secretList.Items[i]
-		csrName, ok := secret.Annotations["networkpolicy.webhook.io/csr-name"]
-		if !ok {
-			continue
-		}
-
-		// Check if CSR exists
-		csr := &certificatesv1.CertificateSigningRequest{}
-		exists, err := r.GetResource(ctx, types.NamespacedName{Name: csrName}, csr)
-		if err != nil && !errors.IsNotFound(err) {
-			log.Error(err, "Failed to check if CSR exists", "csr", csrName)
-			continue
-		}
-
-		if !exists {
-			// CSR doesn't exist, but secret still does - remove finalizer and delete
-			log.Info("Found orphaned secret without CSR, cleaning up", "secret", secret.Name, "namespace", secret.Namespace)
-
-			// First remove finalizer if it exists
-			if controllerutil.ContainsFinalizer(secret, "networkpolicy-approval-protection") {
-				toContinue, err := r.RemoveFinalizer(ctx, types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}, secret, "networkpolicy-approval-protection")
-				if !toContinue || err != nil {
-					log.Error(err, "Failed to remove finalizer from orphaned secret")
-					continue
-				}
-			}
-
-			// Delete the secret
-			_, err = r.DeleteResource(ctx, secret)
-			if err != nil {
-				log.Error(err, "Failed to delete orphaned secret")
-			}
-		}
-	}
-
-	return nil
-}
-
 func (r *CertificateSigningRequestReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := logf.FromContext(ctx).WithValues("csr", req.Name)
 	log.Info("Reconciling CSR")
@@ -118,13 +80,28 @@ func (r *CertificateSigningRequestReconciler) Reconcile(ctx context.Context, req
 		return ctrl.Result{}, nil
 	}
 
+	if err := r.updatePendingMetrics(ctx); err != nil {
+		log.Error(err, "Failed to update pending request metrics")
+	}
+
+	if csr.Labels[approval.LabelNetworkPolicyApproval] == approval.LabelValueChangeSet {
+		return ctrl.Result{}, r.reconcileChangeSet(ctx, csr)
+	}
+
 	// Check if CSR has been approved
 	isApproved := false
+	var approvedAt time.Time
+	var approvalMessage string
 	for _, condition := range csr.Status.Conditions {
 		if condition.Type == certificatesv1.CertificateApproved {
 			isApproved = true
+			approvedAt = condition.LastUpdateTime.Time
+			approvalMessage = condition.Message
 			break
 		}
+		if condition.Type == certificatesv1.CertificateDenied {
+			return ctrl.Result{}, r.handleDenial(ctx, csr, condition)
+		}
 	}
 
 	if !isApproved {
@@ -132,6 +109,22 @@ func (r *CertificateSigningRequestReconciler) Reconcile(ctx context.Context, req
 		return ctrl.Result{}, nil
 	}
 
+	// A rule may require several approvers, the CSR condition alone is not enough then
+	if required, approvers := approval.RequiredApprovers(csr.Annotations), approval.Approvers(csr.Annotations); required > 1 && len(approvers) < required {
+		log.Info("CSR is approved but needs more approvers", "required", required, "approvers", approvers)
+		return ctrl.Result{}, nil
+	}
+	// A NetworkPolicy selecting peers in other namespaces needs an approval for each of them
+	if pending := approval.PendingNamespaces(csr.Annotations); len(pending) > 0 {
+		log.Info("CSR is approved but needs approvals for the affected namespaces", "namespaces", pending)
+		return ctrl.Result{}, nil
+	}
+
+	if reason, ok := csr.Annotations[approval.AnnotationRevocationReason]; ok {
+		log.Info("CSR is approved but its approval was revoked", "reason", reason)
+		return ctrl.Result{}, nil
+	}
+
 	// Get NetworkPolicy details from CSR annotations
 	npName, hasNPName := csr.Annotations["networkpolicy.webhook.io/name"]
 	npNamespace, hasNPNamespace := csr.Annotations["networkpolicy.webhook.io/namespace"]
@@ -163,19 +156,94 @@ func (r *CertificateSigningRequestReconciler) Reconcile(ctx context.Context, req
 		return ctrl.Result{}, err
 	}
 
+	// An approver may schedule the approval, e.g. for a maintenance window
+	window, err := approval.AnnotatedWindow(csr.Annotations)
+	if err != nil {
+		// The webhook validates the window, an invalid one can only be set while it is not running
+		log.Error(err, "CSR has an invalid approval window")
+		return ctrl.Result{}, nil
+	}
+	scheduled := window.Pending(time.Now())
+	if !scheduled && exists && string(secret.Data[approval.SecretKeyPendingPrefix+approval.SecretKeyHash]) == approvalHash {
+		// The NetworkPolicy controller activates the scheduled approval and applies its spec
+		return ctrl.Result{}, nil
+	}
+
 	// Prepare secret data - use only valid keys (alphanumeric, -, _ or .)
 	secretData := map[string][]byte{
 		"hash":     []byte(approvalHash),
 		"tls-crt":  csr.Status.Certificate,
 		"csr-name": []byte(csr.Name),
+		// The CSR is garbage collected, the Secret keeps what the approval was given for
+		approval.SecretKeyApprovalMessage: []byte(approvalMessage),
+	}
+	if approver := approval.ApprovedBy(csr.Annotations, approvalMessage); approver != "" {
+		secretData[approval.SecretKeyApprover] = []byte(approver)
+	}
+	if requester, ok := csr.Annotations[approval.AnnotationRequester]; ok {
+		secretData[approval.SecretKeyRequester] = []byte(requester)
+	}
+	if !approvedAt.IsZero() {
+		secretData[approval.SecretKeyApprovedAt] = []byte(approvedAt.UTC().Format(time.RFC3339))
+	}
+	// Keep the approved spec so drift remediation can restore it
+	if spec, ok := csr.Annotations[approval.AnnotationSpec]; ok {
+		secretData[approval.SecretKeySpec] = []byte(spec)
+	}
+	hashKey := approval.SecretKeyHash
+	if scheduled {
+		// The current approval stays in effect until the NetworkPolicy controller activates this one at notBefore
+		secretData = pendingApprovalData(secret.Data, secretData, window)
+		hashKey = approval.SecretKeyPendingPrefix + approval.SecretKeyHash
+	} else {
+		// Every approved version is kept so the NetworkPolicy can be rolled back to it
+		if history, ok := secret.Data[approval.SecretKeyHistory]; exists && ok {
+			secretData[approval.SecretKeyHistory] = history
+		}
+		if err := approval.RecordVersion(secretData, approval.CurrentVersion(secretData), r.HistoryLimit); err != nil {
+			log.Error(err, "Failed to record the approved version")
+			return ctrl.Result{}, err
+		}
+	}
+
+	newApproval := !exists || string(secret.Data[hashKey]) != approvalHash
+	r.observeApproval(csr, npNamespace, npName, approvedAt, newApproval)
+	if newApproval {
+		message := approvalMessage
+		if scheduled {
+			message = fmt.Sprintf("%s (scheduled for %s)", approvalMessage, window.NotBefore.UTC().Format(time.RFC3339))
+		}
+		r.recordAudit(ctx, audit.Record{
+			Action:     audit.ActionApproval,
+			Namespace:  npNamespace,
+			Name:       npName,
+			CSRName:    csr.Name,
+			Requester:  csr.Annotations[approval.AnnotationRequester],
+			PolicyHash: approvalHash,
+			Message:    message,
+		})
+		if scheduled {
+			r.Events.Scheduled(ctx, npNamespace, npName, csr.Name, window.NotBefore)
+		} else {
+			r.Events.Approved(ctx, npNamespace, npName, csr.Name)
+		}
 	}
 
 	// Create metadata for annotations - will go in secret's metadata not data
 	annotations := map[string]string{
-		"networkpolicy.webhook.io/csr-name":      csr.Name,
-		"networkpolicy.webhook.io/approval-hash": approvalHash,
-		"networkpolicy.webhook.io/np-name":       npName,
-		"networkpolicy.webhook.io/np-namespace":  npNamespace,
+		"networkpolicy.webhook.io/np-name":      npName,
+		"networkpolicy.webhook.io/np-namespace": npNamespace,
+	}
+	if !scheduled || !exists {
+		annotations["networkpolicy.webhook.io/csr-name"] = csr.Name
+	}
+	if !scheduled {
+		annotations["networkpolicy.webhook.io/approval-hash"] = approvalHash
+		for _, key := range approvalAnnotations {
+			if value, ok := csr.Annotations[key]; ok {
+				annotations[key] = value
+			}
+		}
 	}
 
 	if !exists {
@@ -212,6 +280,17 @@ func (r *CertificateSigningRequestReconciler) Reconcile(ctx context.Context, req
 	} else {
 		// Update existing secret
 		secret.Data = secretData
+		if secret.Annotations == nil {
+			secret.Annotations = map[string]string{}
+		}
+		if !scheduled {
+			for _, key := range approvalAnnotations {
+				delete(secret.Annotations, key)
+			}
+		}
+		for key, value := range annotations {
+			secret.Annotations[key] = value
+		}
 
 		// Update the secret
 		toContinue, err := r.UpdateResource(ctx, secretNamespacedName, secret)
@@ -233,6 +312,154 @@ func (r *CertificateSigningRequestReconciler) Reconcile(ctx context.Context, req
 	return ctrl.Result{}, nil
 }
 
+// approvalAnnotations describe how a request was approved, they are copied from the CSR to the approval Secret
+var approvalAnnotations = []string{
+	approval.AnnotationAutoApprovedBy,
+	approval.AnnotationNamespaceApprovals,
+	approval.AnnotationNotBefore,
+	approval.AnnotationNotAfter,
+}
+
+// pendingApprovalData keeps the current approval in data and adds approved under the pending keys with its window
+func pendingApprovalData(data, approved map[string][]byte, window approval.Window) map[string][]byte {
+	merged := map[string][]byte{}
+	for key, value := range data {
+		if !strings.HasPrefix(key, approval.SecretKeyPendingPrefix) {
+			merged[key] = value
+		}
+	}
+	for key, value := range approved {
+		merged[approval.SecretKeyPendingPrefix+key] = value
+	}
+	notBefore, notAfter := window.Format()
+	merged[approval.SecretKeyPendingNotBefore] = []byte(notBefore)
+	if notAfter != "" {
+		merged[approval.SecretKeyPendingNotAfter] = []byte(notAfter)
+	}
+	return merged
+}
+
+// handleDenial reports the denial of a CSR to the audit trail and as an Event once and marks the CSR as recorded
+func (r *CertificateSigningRequestReconciler) handleDenial(ctx context.Context, csr *certificatesv1.CertificateSigningRequest, condition certificatesv1.CertificateSigningRequestCondition) error {
+	if csr.Annotations[approval.AnnotationDenialRecorded] == "true" {
+		return nil
+	}
+	r.Events.Denied(ctx, csr.Annotations[approval.AnnotationNamespace], csr.Annotations[approval.AnnotationName], csr.Name, condition.Message)
+	r.recordAudit(ctx, audit.Record{
+		Action:     audit.ActionDenial,
+		Namespace:  csr.Annotations[approval.AnnotationNamespace],
+		Name:       csr.Annotations[approval.AnnotationName],
+		CSRName:    csr.Name,
+		Requester:  csr.Annotations[approval.AnnotationRequester],
+		PolicyHash: csr.Annotations[approval.AnnotationApprovalHash],
+		Message:    condition.Message,
+	})
+	if csr.Annotations == nil {
+		csr.Annotations = map[string]string{}
+	}
+	csr.Annotations[approval.AnnotationDenialRecorded] = "true"
+	_, err := r.UpdateResource(ctx, types.NamespacedName{Name: csr.Name}, csr)
+	return err
+}
+
+// recordAudit writes a record to the audit trail, if one is configured
+func (r *CertificateSigningRequestReconciler) recordAudit(ctx context.Context, record audit.Record) {
+	if r.Audit == nil {
+		return
+	}
+	if err := r.Audit.Write(ctx, record); err != nil {
+		logf.FromContext(ctx).Error(err, "Failed to write audit record", "action", record.Action, "networkpolicy", record.Name, "namespace", record.Namespace)
+	}
+}
+
+// reconcileChangeSet decides the pending members of a decided change-set like it, members whose NetworkPolicy
+// changed since they joined are left to their own request
+func (r *CertificateSigningRequestReconciler) reconcileChangeSet(ctx context.Context, changeSet *certificatesv1.CertificateSigningRequest) error {
+	log := logf.FromContext(ctx).WithValues("changeSet", changeSet.Name)
+	var decision certificatesv1.CertificateSigningRequestCondition
+	for _, condition := range changeSet.Status.Conditions {
+		if condition.Type == certificatesv1.CertificateApproved || condition.Type == certificatesv1.CertificateDenied {
+			decision = condition
+			break
+		}
+	}
+	if decision.Type == "" {
+		return nil
+	}
+
+	namespace := changeSet.Annotations[approval.AnnotationNamespace]
+	members := approval.ChangeSetMembers(changeSet.Annotations)
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		csr := &certificatesv1.CertificateSigningRequest{}
+		exists, err := r.GetResource(ctx, types.NamespacedName{Name: approval.Name(namespace, name)}, csr)
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to get member %s of change-set %s: %w", name, changeSet.Name, err)
+		}
+		if !exists || csr.Annotations[approval.AnnotationChangeSet] != changeSet.Name ||
+			csr.Annotations[approval.AnnotationApprovalHash] != members[name] || len(csr.Status.Conditions) > 0 {
+			continue
+		}
+		csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+			Type:           decision.Type,
+			Status:         corev1.ConditionTrue,
+			Reason:         approval.ConditionReasonChangeSet,
+			Message:        fmt.Sprintf("%s with change-set %s: %s", decision.Type, changeSet.Name, decision.Message),
+			LastUpdateTime: metav1.Now(),
+		})
+		if err := r.Client().SubResource("approval").Update(ctx, csr); err != nil {
+			return fmt.Errorf("failed to decide member %s of change-set %s: %w", name, changeSet.Name, err)
+		}
+		log.Info("Decided change-set member", "name", name, "namespace", namespace, "decision", decision.Type)
+	}
+	return nil
+}
+
+// updatePendingMetrics recomputes the number and age of pending approval requests per namespace
+func (r *CertificateSigningRequestReconciler) updatePendingMetrics(ctx context.Context) error {
+	csrList := &certificatesv1.CertificateSigningRequestList{}
+	if err := r.Client().List(ctx, csrList, client.MatchingLabels{approval.LabelNetworkPolicyApproval: "true"}); err != nil {
+		return fmt.Errorf("failed to list CSRs: %w", err)
+	}
+
+	pending := map[string]int{}
+	oldest := map[string]time.Duration{}
+	for i := range csrList.Items {
+		item := &csrList.Items[i]
+		if len(item.Status.Conditions) > 0 {
+			continue
+		}
+		namespace := item.Annotations[approval.AnnotationNamespace]
+		pending[namespace]++
+		if age := time.Since(item.CreationTimestamp.Time); age > oldest[namespace] {
+			oldest[namespace] = age
+		}
+	}
+
+	metrics.PendingRequests.Reset()
+	metrics.OldestPendingRequestAge.Reset()
+	for namespace, count := range pending {
+		metrics.PendingRequests.WithLabelValues(namespace).Set(float64(count))
+		metrics.OldestPendingRequestAge.WithLabelValues(namespace).Set(oldest[namespace].Seconds())
+	}
+	return nil
+}
+
+// observeApproval records the approval latency of a newly approved request and the expiry of its certificate
+func (r *CertificateSigningRequestReconciler) observeApproval(csr *certificatesv1.CertificateSigningRequest, npNamespace, npName string, approvedAt time.Time, newApproval bool) {
+	if newApproval && !approvedAt.IsZero() && !csr.CreationTimestamp.IsZero() {
+		metrics.TimeToApproval.WithLabelValues(npNamespace).Observe(approvedAt.Sub(csr.CreationTimestamp.Time).Seconds())
+	}
+
+	if notAfter, ok := approval.CertificateNotAfter(csr.Status.Certificate); ok {
+		metrics.CertificateExpiry.WithLabelValues(npNamespace, npName).Set(float64(notAfter.Unix()))
+	}
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *CertificateSigningRequestReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
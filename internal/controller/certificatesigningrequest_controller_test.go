@@ -18,10 +18,15 @@ package controller
 
 import (
 	"context"
+	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/hadi2f244/approve-controller/internal/pkg/approval"
+	"github.com/hadi2f244/approve-controller/internal/pkg/events"
+	"github.com/hadi2f244/approve-controller/internal/pkg/metrics"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 
 	certificatesv1 "k8s.io/api/certificates/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -196,6 +201,11 @@ var _ = Describe("CertificateSigningRequest Controller", func() {
 			Expect(secret.Type).To(Equal(corev1.SecretType("networkpolicy.webhook.io/approval")))
 			Expect(secret.Data["hash"]).To(Equal([]byte("test-hash-123")))
 			Expect(secret.Data["tls-crt"]).To(Equal([]byte("test-certificate-data")))
+			Expect(secret.Data["approval-message"]).To(Equal([]byte("Approved by test")))
+			versions, err := approval.History(secret.Data)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(versions).To(HaveLen(1))
+			Expect(versions[0].Hash).To(Equal("test-hash-123"))
 			Expect(secret.Data["csr-name"]).To(Equal([]byte("test-csr")))
 
 			// Verify annotations
@@ -209,6 +219,103 @@ var _ = Describe("CertificateSigningRequest Controller", func() {
 		})
 	})
 
+	Context("When reconciling an approved CSR that needs more approvers", func() {
+		BeforeEach(func() {
+			approvedCSR := csr.DeepCopy()
+			approvedCSR.Annotations[approval.AnnotationRequiredApprovers] = "2"
+			approvedCSR.Annotations[approval.AnnotationApprovers] = "alice"
+			approvedCSR.Status = certificatesv1.CertificateSigningRequestStatus{
+				Conditions: []certificatesv1.CertificateSigningRequestCondition{
+					{Type: certificatesv1.CertificateApproved, Status: corev1.ConditionTrue, Reason: "Approved"},
+				},
+				Certificate: []byte("test-certificate-data"),
+			}
+			Expect(fakeClient.Create(ctx, approvedCSR)).To(Succeed())
+		})
+
+		It("should not create a secret until enough approvers are recorded", func() {
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			secretName := types.NamespacedName{Name: "np-approval-test-namespace-test-policy", Namespace: namespace}
+			Expect(fakeClient.Get(ctx, secretName, &corev1.Secret{})).NotTo(Succeed())
+
+			By("recording a second approver")
+			Expect(fakeClient.Get(ctx, req.NamespacedName, csr)).To(Succeed())
+			csr.Annotations[approval.AnnotationApprovers] = "alice,bob"
+			Expect(fakeClient.Update(ctx, csr)).To(Succeed())
+
+			_, err = reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.Get(ctx, secretName, &corev1.Secret{})).To(Succeed())
+		})
+	})
+
+	Context("When reconciling an approved CSR affecting other namespaces", func() {
+		BeforeEach(func() {
+			approvedCSR := csr.DeepCopy()
+			approvedCSR.Annotations[approval.AnnotationAffectedNamespaces] = "team-b,team-c"
+			approvedCSR.Annotations[approval.AnnotationNamespaceApprovals] = "team-b=bob"
+			approvedCSR.Status = certificatesv1.CertificateSigningRequestStatus{
+				Conditions: []certificatesv1.CertificateSigningRequestCondition{
+					{Type: certificatesv1.CertificateApproved, Status: corev1.ConditionTrue, Reason: "Approved"},
+				},
+				Certificate: []byte("test-certificate-data"),
+			}
+			Expect(fakeClient.Create(ctx, approvedCSR)).To(Succeed())
+		})
+
+		It("should not create a secret until every affected namespace was approved for", func() {
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			secretName := types.NamespacedName{Name: "np-approval-test-namespace-test-policy", Namespace: namespace}
+			Expect(fakeClient.Get(ctx, secretName, &corev1.Secret{})).NotTo(Succeed())
+
+			By("recording the approval for the last namespace")
+			Expect(fakeClient.Get(ctx, req.NamespacedName, csr)).To(Succeed())
+			csr.Annotations[approval.AnnotationNamespaceApprovals] = "team-b=bob,team-c=carol"
+			Expect(fakeClient.Update(ctx, csr)).To(Succeed())
+
+			_, err = reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			secret := &corev1.Secret{}
+			Expect(fakeClient.Get(ctx, secretName, secret)).To(Succeed())
+			Expect(secret.Annotations[approval.AnnotationNamespaceApprovals]).To(Equal("team-b=bob,team-c=carol"))
+		})
+	})
+
+	Context("When reconciling an approved CSR for a rejected NetworkPolicy", func() {
+		var eventRecorder *record.FakeRecorder
+
+		BeforeEach(func() {
+			eventRecorder = record.NewFakeRecorder(10)
+			reconciler.Events = events.NewEmitter(fakeClient, eventRecorder)
+
+			approvedCSR := csr.DeepCopy()
+			approvedCSR.Status = certificatesv1.CertificateSigningRequestStatus{
+				Conditions: []certificatesv1.CertificateSigningRequestCondition{
+					{
+						Type:   certificatesv1.CertificateApproved,
+						Status: corev1.ConditionTrue,
+						Reason: "Approved",
+					},
+				},
+				Certificate: []byte("test-certificate-data"),
+			}
+			Expect(fakeClient.Create(ctx, approvedCSR)).To(Succeed())
+		})
+
+		It("should emit well-formed events on the secret and on the namespace", func() {
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(recorder.Events).To(Receive(Equal(
+				"Normal Created Created v1.Secret test-namespace/np-approval-test-namespace-test-policy")))
+			// The NetworkPolicy does not exist, so the event names it on the namespace
+			Expect(eventRecorder.Events).To(Receive(
+				ContainSubstring("Normal ApprovalGranted NetworkPolicy test-policy: CSR test-csr was approved")))
+		})
+	})
+
 	Context("When reconciling an approved CSR with an existing secret", func() {
 		BeforeEach(func() {
 			// Create the CSR with approval and certificate data
@@ -272,48 +379,121 @@ var _ = Describe("CertificateSigningRequest Controller", func() {
 		})
 	})
 
-	Context("When cleaning up orphaned secrets", func() {
+	Context("When reconciling an approved CSR scheduled for later", func() {
+		var eventRecorder *record.FakeRecorder
+
 		BeforeEach(func() {
-			// Create an orphaned secret (no corresponding CSR)
-			orphanedSecret := &corev1.Secret{
+			eventRecorder = record.NewFakeRecorder(10)
+			reconciler.Events = events.NewEmitter(fakeClient, eventRecorder)
+
+			approvedCSR := csr.DeepCopy()
+			approvedCSR.Annotations[approval.AnnotationNotBefore] = time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+			approvedCSR.Status = certificatesv1.CertificateSigningRequestStatus{
+				Conditions: []certificatesv1.CertificateSigningRequestCondition{
+					{Type: certificatesv1.CertificateApproved, Status: corev1.ConditionTrue, Reason: "Approved"},
+				},
+				Certificate: []byte("test-certificate-data"),
+			}
+			Expect(fakeClient.Create(ctx, approvedCSR)).To(Succeed())
+
+			Expect(fakeClient.Create(ctx, &corev1.Secret{
 				ObjectMeta: metav1.ObjectMeta{
-					Name:      "np-approval-test-namespace-orphaned",
+					Name:      "np-approval-test-namespace-test-policy",
 					Namespace: namespace,
-					Labels: map[string]string{
-						"networkpolicy.webhook.io/approval": "true",
-						"networkpolicy.webhook.io/name":     "orphaned",
-					},
 					Annotations: map[string]string{
-						"networkpolicy.webhook.io/csr-name":      "non-existent-csr",
-						"networkpolicy.webhook.io/approval-hash": "orphaned-hash",
-						"networkpolicy.webhook.io/np-name":       "orphaned",
+						"networkpolicy.webhook.io/csr-name":      "old-csr",
+						"networkpolicy.webhook.io/approval-hash": "old-hash",
+						"networkpolicy.webhook.io/np-name":       "test-policy",
 						"networkpolicy.webhook.io/np-namespace":  namespace,
 					},
-					Finalizers: []string{"networkpolicy-approval-protection"},
 				},
 				Type: "networkpolicy.webhook.io/approval",
 				Data: map[string][]byte{
-					"hash":     []byte("orphaned-hash"),
-					"tls-crt":  []byte("orphaned-certificate-data"),
-					"csr-name": []byte("non-existent-csr"),
+					"hash":     []byte("old-hash"),
+					"tls-crt":  []byte("old-certificate-data"),
+					"csr-name": []byte("old-csr"),
 				},
-			}
-			Expect(fakeClient.Create(ctx, orphanedSecret)).To(Succeed())
+			})).To(Succeed())
 		})
 
-		It("should remove the finalizer and delete the orphaned secret", func() {
-			err := reconciler.cleanupOrphanedSecrets(ctx)
+		It("should keep the current approval and store the scheduled one as pending", func() {
+			_, err := reconciler.Reconcile(ctx, req)
 			Expect(err).NotTo(HaveOccurred())
 
-			// Check that the orphaned secret was deleted
-			secretName := types.NamespacedName{
-				Name:      "np-approval-test-namespace-orphaned",
+			secret := &corev1.Secret{}
+			Expect(fakeClient.Get(ctx, types.NamespacedName{
+				Name:      "np-approval-test-namespace-test-policy",
 				Namespace: namespace,
+			}, secret)).To(Succeed())
+			Expect(secret.Data["hash"]).To(Equal([]byte("old-hash")))
+			Expect(secret.Annotations["networkpolicy.webhook.io/approval-hash"]).To(Equal("old-hash"))
+			Expect(secret.Data["pending-hash"]).To(Equal([]byte("test-hash-123")))
+			Expect(secret.Data["pending-tls-crt"]).To(Equal([]byte("test-certificate-data")))
+			Expect(secret.Data).To(HaveKey(approval.SecretKeyPendingNotBefore))
+			Expect(eventRecorder.Events).To(Receive(ContainSubstring("Normal ApprovalScheduled")))
+		})
+	})
+
+	Context("When reconciling an approved change-set", func() {
+		var changeSet *certificatesv1.CertificateSigningRequest
+
+		BeforeEach(func() {
+			changeSet = &certificatesv1.CertificateSigningRequest{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   approval.ChangeSetName(namespace, "rel-1"),
+					Labels: map[string]string{approval.LabelNetworkPolicyApproval: approval.LabelValueChangeSet},
+					Annotations: map[string]string{
+						approval.AnnotationNamespace:        namespace,
+						approval.AnnotationChangeSetMembers: "test-policy=test-hash-123,changed-policy=old-hash",
+					},
+				},
+				Spec: csr.Spec,
+				Status: certificatesv1.CertificateSigningRequestStatus{
+					Conditions: []certificatesv1.CertificateSigningRequestCondition{
+						{Type: certificatesv1.CertificateApproved, Status: corev1.ConditionTrue, Message: "release 1"},
+					},
+				},
 			}
-			secret := &corev1.Secret{}
-			err = fakeClient.Get(ctx, secretName, secret)
-			Expect(err).To(HaveOccurred())
-			Expect(client.IgnoreNotFound(err)).NotTo(HaveOccurred())
+			Expect(fakeClient.Create(ctx, changeSet)).To(Succeed())
+			for name, hash := range map[string]string{"test-policy": "test-hash-123", "changed-policy": "new-hash"} {
+				member := csr.DeepCopy()
+				member.Name = approval.Name(namespace, name)
+				member.Annotations[approval.AnnotationName] = name
+				member.Annotations[approval.AnnotationApprovalHash] = hash
+				member.Annotations[approval.AnnotationChangeSet] = changeSet.Name
+				Expect(fakeClient.Create(ctx, member)).To(Succeed())
+			}
+		})
+
+		It("should approve the members that did not change since they joined", func() {
+			_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: changeSet.Name}})
+			Expect(err).NotTo(HaveOccurred())
+
+			member := &certificatesv1.CertificateSigningRequest{}
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Name: approval.Name(namespace, "test-policy")}, member)).To(Succeed())
+			Expect(member.Status.Conditions).To(HaveLen(1))
+			Expect(member.Status.Conditions[0].Type).To(Equal(certificatesv1.CertificateApproved))
+			Expect(member.Status.Conditions[0].Reason).To(Equal(approval.ConditionReasonChangeSet))
+			Expect(member.Status.Conditions[0].Message).To(ContainSubstring("release 1"))
+
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Name: approval.Name(namespace, "changed-policy")}, member)).To(Succeed())
+			Expect(member.Status.Conditions).To(BeEmpty())
+			Expect(testutil.ToFloat64(metrics.PendingRequests.WithLabelValues(namespace))).To(Equal(float64(2)))
+		})
+	})
+
+	Context("When reconciling while other requests are pending", func() {
+		BeforeEach(func() {
+			other := csr.DeepCopy()
+			other.Name = "other-csr"
+			Expect(fakeClient.Create(ctx, csr)).To(Succeed())
+			Expect(fakeClient.Create(ctx, other)).To(Succeed())
+		})
+
+		It("should report the pending requests of the namespace", func() {
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(testutil.ToFloat64(metrics.PendingRequests.WithLabelValues(namespace))).To(Equal(float64(2)))
 		})
 	})
 })
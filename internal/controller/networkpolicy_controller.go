@@ -0,0 +1,748 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hadi2f244/approve-controller/internal/pkg/approval"
+	"github.com/hadi2f244/approve-controller/internal/pkg/audit"
+	"github.com/hadi2f244/approve-controller/internal/pkg/consts"
+	"github.com/hadi2f244/approve-controller/internal/pkg/events"
+	"github.com/hadi2f244/approve-controller/internal/pkg/metrics"
+	"github.com/hadi2f244/approve-controller/internal/pkg/signature"
+	"github.com/hadi2f244/approve-controller/internal/pkg/templates"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// approvalInFlightRequeue is how long to wait for the Secret of an approved CSR before checking again
+const approvalInFlightRequeue = 10 * time.Second
+
+// NetworkPolicyReconciler detects NetworkPolicies that differ from their approval, e.g. because
+// they were created while the webhook was down or disabled, and optionally remediates them
+type NetworkPolicyReconciler struct {
+	*SharedReconciler
+	// ResyncPeriod is how often every NetworkPolicy is compared with its approval
+	ResyncPeriod time.Duration
+	// Remediation is the action taken on drifted NetworkPolicies
+	Remediation consts.DriftRemediation
+	// ExcludedNamespaces are not checked for drift
+	ExcludedNamespaces []string
+	// Events reports expired approvals and rollbacks on the NetworkPolicy, if set
+	Events *events.Emitter
+	// ExpiryWarning is how long before an approval expires approvers are warned, never if zero
+	ExpiryWarning time.Duration
+	// Audit receives a record for every break-glass change that is rolled back, every scheduled approval
+	// that is activated and every rollback to an approved version, if set
+	Audit audit.Sink
+	// Signatures pre-approve NetworkPolicies signed with a trusted key, if set
+	Signatures *signature.Verifier
+	// OrphanRetention is how long the approval of a missing NetworkPolicy is kept, forever if zero
+	OrphanRetention time.Duration
+	// HistoryLimit is how many approved versions the approval Secret keeps for rollbacks
+	HistoryLimit int
+}
+
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;delete
+
+func (r *NetworkPolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	orphanWait, err := r.reconcileApprovalRecord(ctx, req.NamespacedName)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	wait, err := r.activateScheduledApproval(ctx, req.NamespacedName)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	result, err := r.reconcileDrift(ctx, req)
+	// Come back when the scheduled approval takes effect or the approval of a missing NetworkPolicy is orphaned
+	for _, after := range []time.Duration{wait, orphanWait} {
+		if err == nil && after > 0 && (result.RequeueAfter == 0 || after < result.RequeueAfter) {
+			result.RequeueAfter = after
+		}
+	}
+	return result, err
+}
+
+// reconcileApprovalRecord manages the lifetime of the approval Secret, which does not depend on its CSR since
+// CSRs are garbage collected. Deleting the Secret revokes the approval, the revocation is recorded before its
+// finalizer is removed. The approval of a NetworkPolicy that is missing for OrphanRetention is deleted, unless it
+// is scheduled to create the NetworkPolicy. It returns how long until the approval is orphaned, zero if it is not
+// waiting to be
+func (r *NetworkPolicyReconciler) reconcileApprovalRecord(ctx context.Context, key types.NamespacedName) (time.Duration, error) {
+	log := logf.FromContext(ctx).WithValues("networkpolicy", key)
+
+	secret := &corev1.Secret{}
+	secretKey := types.NamespacedName{Name: approval.Name(key.Namespace, key.Name), Namespace: key.Namespace}
+	exists, err := r.GetResource(ctx, secretKey, secret)
+	if err != nil && !errors.IsNotFound(err) {
+		log.Error(err, "Failed to get approval secret")
+		return 0, err
+	}
+	if !exists || secret.Type != approval.SecretTypeNetworkPolicyApproval {
+		return 0, nil
+	}
+
+	if !secret.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(secret, approval.FinalizerApprovalProtection) {
+			return 0, nil
+		}
+		reason := secret.Annotations[approval.AnnotationRevocationReason]
+		if reason == "" {
+			reason = "the approval secret was deleted"
+		}
+		r.recordAudit(ctx, audit.Record{
+			Action:     audit.ActionRevocation,
+			Namespace:  key.Namespace,
+			Name:       key.Name,
+			CSRName:    string(secret.Data[approval.SecretKeyCSRName]),
+			Requester:  string(secret.Data[approval.SecretKeyRequester]),
+			PolicyHash: string(secret.Data[approval.SecretKeyHash]),
+			Message:    reason,
+		})
+		r.Events.Revoked(ctx, key.Namespace, key.Name, reason)
+		if err := r.revokeRequest(ctx, secret, reason); err != nil {
+			return 0, err
+		}
+		_, err := r.RemoveFinalizer(ctx, secretKey, secret, approval.FinalizerApprovalProtection)
+		return 0, err
+	}
+
+	npExists, err := r.GetResource(ctx, key, &networkingv1.NetworkPolicy{})
+	if err != nil && !errors.IsNotFound(err) {
+		log.Error(err, "Failed to get NetworkPolicy")
+		return 0, err
+	}
+	orphanedSince, orphaned := secret.Annotations[approval.AnnotationOrphanedSince]
+	if npExists {
+		if orphaned {
+			delete(secret.Annotations, approval.AnnotationOrphanedSince)
+			_, err = r.UpdateResource(ctx, secretKey, secret)
+		}
+		return 0, err
+	}
+	if r.OrphanRetention <= 0 || len(secret.Data[approval.SecretKeyPendingPrefix+approval.SecretKeyHash]) > 0 {
+		return 0, nil
+	}
+
+	since, err := time.Parse(time.RFC3339, orphanedSince)
+	if !orphaned || err != nil {
+		if secret.Annotations == nil {
+			secret.Annotations = map[string]string{}
+		}
+		secret.Annotations[approval.AnnotationOrphanedSince] = time.Now().UTC().Format(time.RFC3339)
+		_, err = r.UpdateResource(ctx, secretKey, secret)
+		return r.OrphanRetention, err
+	}
+	if remaining := time.Until(since.Add(r.OrphanRetention)); remaining > 0 {
+		return remaining, nil
+	}
+
+	log.Info("Deleting the approval of a NetworkPolicy that no longer exists", "missingSince", orphanedSince)
+	secret.Annotations[approval.AnnotationRevocationReason] = fmt.Sprintf("the NetworkPolicy is missing since %s", orphanedSince)
+	if _, err := r.UpdateResource(ctx, secretKey, secret); err != nil {
+		return 0, err
+	}
+	if _, err := r.DeleteResource(ctx, secret); client.IgnoreNotFound(err) != nil {
+		return 0, err
+	}
+	metrics.GCDeletions.WithLabelValues(key.Namespace).Inc()
+	return 0, nil
+}
+
+// reconcileDrift compares the NetworkPolicy with its approval
+func (r *NetworkPolicyReconciler) reconcileDrift(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := logf.FromContext(ctx).WithValues("networkpolicy", req.NamespacedName)
+
+	if slices.Contains(r.ExcludedNamespaces, req.Namespace) {
+		return ctrl.Result{}, nil
+	}
+
+	np := &networkingv1.NetworkPolicy{}
+	exists, err := r.GetResource(ctx, req.NamespacedName, np)
+	if err != nil || !exists {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get NetworkPolicy")
+			return ctrl.Result{}, err
+		}
+		// NetworkPolicy was deleted, stop reporting it
+		metrics.NetworkPolicyDrift.DeleteLabelValues(req.Namespace, req.Name)
+		return ctrl.Result{}, nil
+	}
+	if !np.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	hash, err := approval.GenerateNetworkPolicyHash(np)
+	if err != nil {
+		log.Error(err, "Failed to generate NetworkPolicy hash")
+		return ctrl.Result{}, err
+	}
+
+	secret := &corev1.Secret{}
+	secretKey := types.NamespacedName{Name: approval.Name(np.Namespace, np.Name), Namespace: np.Namespace}
+	approved, err := r.GetResource(ctx, secretKey, secret)
+	if err != nil && !errors.IsNotFound(err) {
+		log.Error(err, "Failed to get approval secret")
+		return ctrl.Result{}, err
+	}
+	approved = approved && secret.Type == approval.SecretTypeNetworkPolicyApproval
+
+	if _, ok := np.Annotations[approval.AnnotationRollbackTo]; ok && approved {
+		rolledBack, err := r.reconcileRollback(ctx, np, secretKey, secret, hash)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if rolledBack {
+			metrics.NetworkPolicyDrift.WithLabelValues(np.Namespace, np.Name).Set(0)
+			return ctrl.Result{RequeueAfter: r.ResyncPeriod}, nil
+		}
+	}
+
+	if approved {
+		// An approval the admission webhook no longer accepts does not approve the NetworkPolicy either
+		if reason := approval.Expired(secret, time.Now()); reason != "" {
+			r.Events.Expired(ctx, np.Namespace, np.Name, reason)
+			approved = false
+		}
+	}
+
+	if approved && string(secret.Data[approval.SecretKeyHash]) == hash {
+		metrics.NetworkPolicyDrift.WithLabelValues(np.Namespace, np.Name).Set(0)
+		if err := r.clearDrift(ctx, secretKey, secret); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := r.warnExpiry(ctx, np, secretKey, secret); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: r.ResyncPeriod}, nil
+	}
+
+	template, _, err := templates.Find(ctx, r.Client(), np)
+	if err != nil {
+		log.Error(err, "Failed to match PolicyTemplates")
+		return ctrl.Result{}, err
+	}
+	if template != nil {
+		// Instances of an approved template do not have an approval of their own
+		metrics.NetworkPolicyDrift.WithLabelValues(np.Namespace, np.Name).Set(0)
+		return ctrl.Result{RequeueAfter: r.ResyncPeriod}, nil
+	}
+	if sig, ok := np.Annotations[approval.AnnotationSignature]; ok {
+		if _, err := r.Signatures.Verify(np.Namespace, hash, sig); err == nil {
+			// Pre-approved by a trusted key, there is no approval of its own
+			metrics.NetworkPolicyDrift.WithLabelValues(np.Namespace, np.Name).Set(0)
+			return ctrl.Result{RequeueAfter: r.ResyncPeriod}, nil
+		}
+	}
+
+	breakGlassCSR, err := r.breakGlassRequest(ctx, np, hash)
+	if err != nil {
+		log.Error(err, "Failed to get approval CSR")
+		return ctrl.Result{}, err
+	}
+	if breakGlassCSR != nil {
+		expires, _ := approval.BreakGlassExpiry(breakGlassCSR.Annotations)
+		switch remaining := time.Until(expires); {
+		case hasCondition(breakGlassCSR, certificatesv1.CertificateApproved) && approval.ApprovalsComplete(breakGlassCSR.Annotations):
+			// Approved in time, the approval Secret is not written yet
+			return ctrl.Result{RequeueAfter: approvalInFlightRequeue}, nil
+		case remaining > 0 && !hasCondition(breakGlassCSR, certificatesv1.CertificateDenied):
+			// Admitted during an incident, the retroactive request is still within its window
+			metrics.NetworkPolicyDrift.WithLabelValues(np.Namespace, np.Name).Set(0)
+			return ctrl.Result{RequeueAfter: remaining}, nil
+		}
+		if err := r.rollBackBreakGlass(ctx, np, secret, approved, breakGlassCSR); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: r.ResyncPeriod}, nil
+	}
+
+	inFlight, err := r.approvalInFlight(ctx, np, hash)
+	if err != nil {
+		log.Error(err, "Failed to get approval CSR")
+		return ctrl.Result{}, err
+	}
+	if inFlight {
+		// The CSR was approved, e.g. by an auto-approval rule, but the approval Secret is not written yet
+		return ctrl.Result{RequeueAfter: approvalInFlightRequeue}, nil
+	}
+
+	log.Info("NetworkPolicy drifted from its approval", "hash", hash, "remediation", r.Remediation)
+	metrics.NetworkPolicyDrift.WithLabelValues(np.Namespace, np.Name).Set(1)
+	if approved {
+		r.Events.DriftDetected(ctx, np.Namespace, np.Name, hash, string(secret.Data[approval.SecretKeyHash]))
+		if err := r.markDrift(ctx, secretKey, secret, hash); err != nil {
+			return ctrl.Result{}, err
+		}
+	} else {
+		r.Events.DriftDetected(ctx, np.Namespace, np.Name, hash, "")
+	}
+
+	if _, err := r.remediate(ctx, np, secret, approved, r.Remediation); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: r.ResyncPeriod}, nil
+}
+
+// breakGlassRequest returns the retroactive request filed by break-glass for hash, nil if there is none
+func (r *NetworkPolicyReconciler) breakGlassRequest(ctx context.Context, np *networkingv1.NetworkPolicy, hash string) (*certificatesv1.CertificateSigningRequest, error) {
+	csr := &certificatesv1.CertificateSigningRequest{}
+	exists, err := r.GetResource(ctx, types.NamespacedName{Name: approval.Name(np.Namespace, np.Name)}, csr)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if !exists || csr.Annotations[approval.AnnotationApprovalHash] != hash {
+		return nil, nil
+	}
+	if _, ok := approval.BreakGlassExpiry(csr.Annotations); !ok {
+		return nil, nil
+	}
+	return csr, nil
+}
+
+// hasCondition reports whether the CSR has a condition of conditionType
+func hasCondition(csr *certificatesv1.CertificateSigningRequest, conditionType certificatesv1.RequestConditionType) bool {
+	for _, condition := range csr.Status.Conditions {
+		if condition.Type == conditionType {
+			return true
+		}
+	}
+	return false
+}
+
+// rollBackBreakGlass reverts a NetworkPolicy whose break-glass window elapsed without approval, or was denied, to its approved
+// spec, or deletes it if it was never approved, regardless of the drift remediation. The retroactive request is
+// deleted so a late approval cannot approve the rolled back change
+func (r *NetworkPolicyReconciler) rollBackBreakGlass(ctx context.Context, np *networkingv1.NetworkPolicy, secret *corev1.Secret, approved bool, csr *certificatesv1.CertificateSigningRequest) error {
+	log := logf.FromContext(ctx)
+	log.Info("Break-glass change was not approved in time, rolling back the NetworkPolicy", "csr", csr.Name)
+
+	delete(np.Annotations, approval.AnnotationBreakGlass)
+	action, err := r.remediate(ctx, np, secret, approved, consts.DriftRemediationRevert)
+	if err != nil {
+		return err
+	}
+	if _, err := r.DeleteResource(ctx, csr); client.IgnoreNotFound(err) != nil {
+		log.Error(err, "Failed to delete the break-glass request", "csr", csr.Name)
+		return err
+	}
+
+	result := "deleted"
+	if action == consts.DriftRemediationRevert {
+		result = "reverted to its approved spec"
+	}
+	r.Events.BreakGlassExpired(ctx, np.Namespace, np.Name, csr.Name, result)
+	r.recordAudit(ctx, audit.Record{
+		Action:     audit.ActionBreakGlassExpired,
+		Severity:   audit.SeverityHigh,
+		Namespace:  np.Namespace,
+		Name:       np.Name,
+		CSRName:    csr.Name,
+		Requester:  csr.Annotations[approval.AnnotationRequester],
+		PolicyHash: csr.Annotations[approval.AnnotationApprovalHash],
+		Message:    fmt.Sprintf("not approved by %s, the NetworkPolicy was %s", csr.Annotations[approval.AnnotationBreakGlassExpires], result),
+	})
+	return nil
+}
+
+// revokeRequest marks the approved CSR of a revoked approval, if it was not garbage collected yet, so the
+// approval is not written again from it
+func (r *NetworkPolicyReconciler) revokeRequest(ctx context.Context, secret *corev1.Secret, reason string) error {
+	csr := &certificatesv1.CertificateSigningRequest{}
+	csrKey := types.NamespacedName{Name: string(secret.Data[approval.SecretKeyCSRName])}
+	exists, err := r.GetResource(ctx, csrKey, csr)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if !exists || len(secret.Data[approval.SecretKeyHash]) == 0 ||
+		csr.Annotations[approval.AnnotationApprovalHash] != string(secret.Data[approval.SecretKeyHash]) {
+		return nil
+	}
+	if csr.Annotations[approval.AnnotationRevocationReason] == reason {
+		return nil
+	}
+	csr.Annotations[approval.AnnotationRevocationReason] = reason
+	_, err = r.UpdateResource(ctx, csrKey, csr)
+	return err
+}
+
+// activateScheduledApproval makes an approval scheduled on the approval Secret the current one once its notBefore
+// passed and applies its spec, creating the NetworkPolicy if it does not exist. It returns how long until a
+// scheduled approval takes effect, zero if there is none
+func (r *NetworkPolicyReconciler) activateScheduledApproval(ctx context.Context, key types.NamespacedName) (time.Duration, error) {
+	log := logf.FromContext(ctx).WithValues("networkpolicy", key)
+
+	secret := &corev1.Secret{}
+	secretKey := types.NamespacedName{Name: approval.Name(key.Namespace, key.Name), Namespace: key.Namespace}
+	exists, err := r.GetResource(ctx, secretKey, secret)
+	if err != nil && !errors.IsNotFound(err) {
+		log.Error(err, "Failed to get approval secret")
+		return 0, err
+	}
+	pendingHash := string(secret.Data[approval.SecretKeyPendingPrefix+approval.SecretKeyHash])
+	if !exists || secret.Type != approval.SecretTypeNetworkPolicyApproval || pendingHash == "" {
+		return 0, nil
+	}
+	csrName := string(secret.Data[approval.SecretKeyPendingPrefix+approval.SecretKeyCSRName])
+
+	window, err := approval.PendingWindow(secret.Data)
+	now := time.Now()
+	switch {
+	case err != nil:
+		log.Error(err, "Scheduled approval has an invalid window, dropping it")
+		dropPendingApproval(secret)
+		_, err = r.UpdateResource(ctx, secretKey, secret)
+		return 0, err
+	case window.Pending(now):
+		return window.NotBefore.Sub(now), nil
+	case window.Ended(now):
+		log.Info("Scheduled approval ended before it was activated", "csr", csrName)
+		dropPendingApproval(secret)
+		if _, err := r.UpdateResource(ctx, secretKey, secret); err != nil {
+			return 0, err
+		}
+		_, notAfter := window.Format()
+		r.Events.Expired(ctx, key.Namespace, key.Name, fmt.Sprintf("scheduled approval of CSR %s ended at %s before it was activated", csrName, notAfter))
+		return 0, nil
+	}
+
+	var spec *networkingv1.NetworkPolicySpec
+	if specData, ok := secret.Data[approval.SecretKeyPendingPrefix+approval.SecretKeySpec]; ok {
+		if spec, err = approval.DecodeSpec(specData); err != nil {
+			log.Error(err, "Failed to decode scheduled spec")
+			return 0, err
+		}
+	}
+
+	// Promote the scheduled approval before applying its spec so the webhook admits it
+	promoted := map[string][]byte{}
+	for dataKey, value := range secret.Data {
+		if name, ok := strings.CutPrefix(dataKey, approval.SecretKeyPendingPrefix); ok && dataKey != approval.SecretKeyPendingNotBefore && dataKey != approval.SecretKeyPendingNotAfter {
+			promoted[name] = value
+		}
+	}
+	if history, ok := secret.Data[approval.SecretKeyHistory]; ok {
+		promoted[approval.SecretKeyHistory] = history
+	}
+	if err := approval.RecordVersion(promoted, approval.CurrentVersion(promoted), r.HistoryLimit); err != nil {
+		log.Error(err, "Failed to record the approved version")
+		return 0, err
+	}
+	secret.Data = promoted
+	for _, annotation := range []string{approval.AnnotationAutoApprovedBy, approval.AnnotationNamespaceApprovals, approval.AnnotationNotBefore, approval.AnnotationNotAfter} {
+		delete(secret.Annotations, annotation)
+	}
+	notBefore, notAfter := window.Format()
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[approval.AnnotationApprovalHash] = pendingHash
+	secret.Annotations[approval.AnnotationCSRName] = csrName
+	secret.Annotations[approval.AnnotationNotBefore] = notBefore
+	if notAfter != "" {
+		secret.Annotations[approval.AnnotationNotAfter] = notAfter
+	}
+	if _, err := r.UpdateResource(ctx, secretKey, secret); err != nil {
+		return 0, err
+	}
+
+	if spec != nil {
+		if err := r.applySpec(ctx, key, spec); err != nil {
+			log.Error(err, "Failed to apply the scheduled NetworkPolicy")
+			return 0, err
+		}
+	}
+	log.Info("Scheduled approval took effect", "csr", csrName, "hash", pendingHash)
+	r.Events.Activated(ctx, key.Namespace, key.Name, csrName)
+	r.recordAudit(ctx, audit.Record{
+		Action:     audit.ActionActivation,
+		Namespace:  key.Namespace,
+		Name:       key.Name,
+		CSRName:    csrName,
+		PolicyHash: pendingHash,
+		Message:    fmt.Sprintf("scheduled approval took effect at %s", notBefore),
+	})
+	return 0, nil
+}
+
+// reconcileRollback rolls the NetworkPolicy back to the version of the approval history its rollback-to annotation
+// names, hash is the hash of the live NetworkPolicy. The version is made the current approval before its spec is
+// applied so the webhook admits it, then the annotations triggering the rollback are removed. It reports false if
+// there is nothing to roll back, e.g. the history has no such version or the incident reference is missing
+func (r *NetworkPolicyReconciler) reconcileRollback(ctx context.Context, np *networkingv1.NetworkPolicy, secretKey types.NamespacedName, secret *corev1.Secret, hash string) (bool, error) {
+	log := logf.FromContext(ctx).WithValues("networkpolicy", client.ObjectKeyFromObject(np))
+	target := np.Annotations[approval.AnnotationRollbackTo]
+	incident := strings.TrimSpace(np.Annotations[approval.AnnotationIncident])
+
+	versions, err := approval.History(secret.Data)
+	if err != nil {
+		log.Error(err, "Failed to read the approval history")
+	}
+	version, found := approval.FindVersion(versions, target)
+	switch {
+	case !found:
+		r.Events.RollbackFailed(ctx, np.Namespace, np.Name, target,
+			fmt.Sprintf("no approved version of the NetworkPolicy has this hash, see kubectl npapprove history %s/%s", np.Namespace, np.Name))
+		return false, r.clearRollback(ctx, np)
+	case incident == "":
+		r.Events.RollbackFailed(ctx, np.Namespace, np.Name, target,
+			fmt.Sprintf("rollbacks need an incident reference in annotation %s", approval.AnnotationIncident))
+		return false, r.clearRollback(ctx, np)
+	}
+
+	previous := string(secret.Data[approval.SecretKeyHash])
+	if previous != version.Hash {
+		if err := approval.RestoreVersion(secret.Data, version, time.Now(), r.HistoryLimit); err != nil {
+			return false, err
+		}
+		// The restored version is admitted without the window or approvals of the one it replaces
+		for _, annotation := range []string{approval.AnnotationAutoApprovedBy, approval.AnnotationNamespaceApprovals, approval.AnnotationNotBefore,
+			approval.AnnotationNotAfter, approval.AnnotationDriftHash, approval.AnnotationDriftDetectedAt} {
+			delete(secret.Annotations, annotation)
+		}
+		if secret.Annotations == nil {
+			secret.Annotations = map[string]string{}
+		}
+		secret.Annotations[approval.AnnotationApprovalHash] = version.Hash
+		secret.Annotations[approval.AnnotationCSRName] = version.CSRName
+		if _, err := r.UpdateResource(ctx, secretKey, secret); err != nil {
+			return false, err
+		}
+
+		approvedAt := version.ApprovedAt.UTC().Format(time.RFC3339)
+		log.Info("Rolled back to a previously approved version", "hash", version.Hash, "previous", previous, "incident", incident)
+		r.recordAudit(ctx, audit.Record{
+			Action:     audit.ActionRollback,
+			Namespace:  np.Namespace,
+			Name:       np.Name,
+			CSRName:    version.CSRName,
+			Approver:   version.Approver,
+			PolicyHash: version.Hash,
+			Incident:   incident,
+			Message:    fmt.Sprintf("rolled back from %s to the version approved at %s", previous, approvedAt),
+		})
+		r.Events.RolledBack(ctx, np.Namespace, np.Name, previous, version.Hash, version.ApprovedAt, incident)
+	}
+
+	if hash != version.Hash {
+		spec, err := approval.DecodeSpec([]byte(version.Spec))
+		if err != nil {
+			log.Error(err, "Failed to decode the spec of the restored version")
+			return false, err
+		}
+		np.Spec = *spec
+	}
+	return true, r.clearRollback(ctx, np)
+}
+
+// clearRollback removes the annotations that triggered a rollback, so later approvals are not rolled back again
+func (r *NetworkPolicyReconciler) clearRollback(ctx context.Context, np *networkingv1.NetworkPolicy) error {
+	delete(np.Annotations, approval.AnnotationRollbackTo)
+	delete(np.Annotations, approval.AnnotationIncident)
+	_, err := r.UpdateResource(ctx, client.ObjectKeyFromObject(np), np)
+	return err
+}
+
+// applySpec sets the spec of the NetworkPolicy, creating it if it does not exist
+func (r *NetworkPolicyReconciler) applySpec(ctx context.Context, key types.NamespacedName, spec *networkingv1.NetworkPolicySpec) error {
+	np := &networkingv1.NetworkPolicy{}
+	exists, err := r.GetResource(ctx, key, np)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if !exists {
+		np = &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}, Spec: *spec}
+		_, err = r.CreateResource(ctx, np)
+		return err
+	}
+	np.Spec = *spec
+	_, err = r.UpdateResource(ctx, key, np)
+	return err
+}
+
+// dropPendingApproval removes a scheduled approval from the data of an approval Secret
+func dropPendingApproval(secret *corev1.Secret) {
+	for dataKey := range secret.Data {
+		if strings.HasPrefix(dataKey, approval.SecretKeyPendingPrefix) {
+			delete(secret.Data, dataKey)
+		}
+	}
+}
+
+// recordAudit writes the record to the audit trail if one is configured, failures are logged
+func (r *NetworkPolicyReconciler) recordAudit(ctx context.Context, record audit.Record) {
+	if r.Audit == nil {
+		return
+	}
+	if err := r.Audit.Write(ctx, record); err != nil {
+		logf.FromContext(ctx).Error(err, "Failed to write audit record", "action", record.Action)
+	}
+}
+
+// approvalInFlight reports whether the approval CSR of the NetworkPolicy was approved for hash, or the
+// change-set it is a member of was, which admits it before the CSR controller decides the member
+func (r *NetworkPolicyReconciler) approvalInFlight(ctx context.Context, np *networkingv1.NetworkPolicy, hash string) (bool, error) {
+	csr := &certificatesv1.CertificateSigningRequest{}
+	exists, err := r.GetResource(ctx, types.NamespacedName{Name: approval.Name(np.Namespace, np.Name)}, csr)
+	if err != nil && !errors.IsNotFound(err) {
+		return false, err
+	}
+	if !exists || csr.Annotations[approval.AnnotationApprovalHash] != hash {
+		return false, nil
+	}
+	if hasCondition(csr, certificatesv1.CertificateApproved) {
+		return true, nil
+	}
+
+	name, ok := csr.Annotations[approval.AnnotationChangeSet]
+	if !ok {
+		return false, nil
+	}
+	changeSet := &certificatesv1.CertificateSigningRequest{}
+	exists, err = r.GetResource(ctx, types.NamespacedName{Name: name}, changeSet)
+	if err != nil && !errors.IsNotFound(err) {
+		return false, err
+	}
+	return exists && hasCondition(changeSet, certificatesv1.CertificateApproved) &&
+		approval.ChangeSetMembers(changeSet.Annotations)[np.Name] == hash, nil
+}
+
+// remediate applies the remediation to a drifted NetworkPolicy and returns the one it performed, a revert
+// falls back to deleting NetworkPolicies without an approved spec
+func (r *NetworkPolicyReconciler) remediate(ctx context.Context, np *networkingv1.NetworkPolicy, secret *corev1.Secret, approved bool, remediation consts.DriftRemediation) (consts.DriftRemediation, error) {
+	log := logf.FromContext(ctx)
+
+	switch remediation {
+	case consts.DriftRemediationRevert:
+		if approved {
+			if specData, ok := secret.Data[approval.SecretKeySpec]; ok {
+				spec, err := approval.DecodeSpec(specData)
+				if err != nil {
+					log.Error(err, "Failed to decode approved spec")
+					return "", err
+				}
+				np.Spec = *spec
+				if _, err := r.UpdateResource(ctx, client.ObjectKeyFromObject(np), np); err != nil {
+					return "", err
+				}
+				metrics.DriftRemediations.WithLabelValues(np.Namespace, "revert").Inc()
+				r.Events.DriftReverted(ctx, np.Namespace, np.Name)
+				return consts.DriftRemediationRevert, nil
+			}
+			log.Info("Approval has no stored spec to revert to, deleting the NetworkPolicy instead")
+		}
+		fallthrough
+	case consts.DriftRemediationDelete:
+		if _, err := r.DeleteResource(ctx, np); err != nil {
+			return "", client.IgnoreNotFound(err)
+		}
+		metrics.DriftRemediations.WithLabelValues(np.Namespace, "delete").Inc()
+		return consts.DriftRemediationDelete, nil
+	}
+	return consts.DriftRemediationNone, nil
+}
+
+// markDrift records the drift on the approval secret so it is visible without metrics
+func (r *NetworkPolicyReconciler) markDrift(ctx context.Context, secretKey types.NamespacedName, secret *corev1.Secret, hash string) error {
+	if secret.Annotations[approval.AnnotationDriftHash] == hash {
+		return nil
+	}
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[approval.AnnotationDriftHash] = hash
+	secret.Annotations[approval.AnnotationDriftDetectedAt] = time.Now().UTC().Format(time.RFC3339)
+	_, err := r.UpdateResource(ctx, secretKey, secret)
+	return err
+}
+
+// warnExpiry warns once when the approval expires within ExpiryWarning, at the end of its window or when its
+// certificate expires, whichever comes first
+func (r *NetworkPolicyReconciler) warnExpiry(ctx context.Context, np *networkingv1.NetworkPolicy, secretKey types.NamespacedName, secret *corev1.Secret) error {
+	if r.ExpiryWarning <= 0 {
+		return nil
+	}
+	expiry, ok := approval.CertificateNotAfter(secret.Data[approval.SecretKeyCertificate])
+	if window, err := approval.AnnotatedWindow(secret.Annotations); err == nil && !window.NotAfter.IsZero() && (!ok || window.NotAfter.Before(expiry)) {
+		expiry, ok = window.NotAfter, true
+	}
+	now := time.Now()
+	if !ok || !expiry.After(now) || expiry.Sub(now) > r.ExpiryWarning {
+		return nil
+	}
+	at := expiry.UTC().Format(time.RFC3339)
+	if secret.Annotations[approval.AnnotationExpiryNotified] == at {
+		return nil
+	}
+	r.Events.Expiring(ctx, np.Namespace, np.Name, secret.Annotations[approval.AnnotationCSRName], expiry)
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[approval.AnnotationExpiryNotified] = at
+	_, err := r.UpdateResource(ctx, secretKey, secret)
+	return err
+}
+
+// clearDrift removes a previously recorded drift from the approval secret
+func (r *NetworkPolicyReconciler) clearDrift(ctx context.Context, secretKey types.NamespacedName, secret *corev1.Secret) error {
+	if _, ok := secret.Annotations[approval.AnnotationDriftHash]; !ok {
+		return nil
+	}
+	delete(secret.Annotations, approval.AnnotationDriftHash)
+	delete(secret.Annotations, approval.AnnotationDriftDetectedAt)
+	_, err := r.UpdateResource(ctx, secretKey, secret)
+	return err
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *NetworkPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&networkingv1.NetworkPolicy{}).
+		// Re-check a NetworkPolicy whenever its approval changes
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+			secret, ok := obj.(*corev1.Secret)
+			if !ok || secret.Type != approval.SecretTypeNetworkPolicyApproval {
+				return nil
+			}
+			npName, ok := secret.Annotations[approval.AnnotationNPName]
+			if !ok {
+				return nil
+			}
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{
+				Name:      npName,
+				Namespace: secret.Annotations[approval.AnnotationNPNamespace],
+			}}}
+		})).
+		Named("networkpolicy").
+		Complete(r)
+}
@@ -0,0 +1,659 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	approvalv1alpha1 "github.com/hadi2f244/approve-controller/api/v1alpha1"
+	"github.com/hadi2f244/approve-controller/internal/pkg/approval"
+	"github.com/hadi2f244/approve-controller/internal/pkg/audit"
+	"github.com/hadi2f244/approve-controller/internal/pkg/consts"
+	"github.com/hadi2f244/approve-controller/internal/pkg/events"
+	"github.com/hadi2f244/approve-controller/internal/pkg/templates"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("NetworkPolicy Controller", func() {
+	var (
+		reconciler *NetworkPolicyReconciler
+		fakeClient client.Client
+		recorder   *record.FakeRecorder
+		ctx        context.Context
+		req        ctrl.Request
+		np         *networkingv1.NetworkPolicy
+		approved   *networkingv1.NetworkPolicy
+		namespace  string
+	)
+
+	// approvalSecret returns an approval secret for the given NetworkPolicy
+	approvalSecret := func(approvedNP *networkingv1.NetworkPolicy) *corev1.Secret {
+		hash, err := approval.GenerateNetworkPolicyHash(approvedNP)
+		Expect(err).NotTo(HaveOccurred())
+		spec, err := approval.EncodeSpec(approvedNP.Spec)
+		Expect(err).NotTo(HaveOccurred())
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      approval.Name(namespace, approvedNP.Name),
+				Namespace: namespace,
+				Annotations: map[string]string{
+					approval.AnnotationNPName:      approvedNP.Name,
+					approval.AnnotationNPNamespace: namespace,
+				},
+			},
+			Type: approval.SecretTypeNetworkPolicyApproval,
+			Data: map[string][]byte{
+				approval.SecretKeyHash:        []byte(hash),
+				approval.SecretKeySpec:        []byte(spec),
+				approval.SecretKeyCertificate: []byte("-----BEGIN CERTIFICATE-----\n-----END CERTIFICATE-----"),
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		recorder = record.NewFakeRecorder(10)
+		namespace = "test-namespace"
+		Expect(approvalv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
+
+		np = &networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-policy",
+				Namespace: namespace,
+			},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "test"}},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			},
+		}
+		approved = np.DeepCopy()
+
+		fakeClient = fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithObjects(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}).
+			Build()
+
+		reconciler = &NetworkPolicyReconciler{
+			SharedReconciler: NewSharedReconciler(
+				fakeClient,
+				scheme.Scheme,
+				fakeClient,
+				logf.Log.WithName("test"),
+				recorder,
+			),
+			ResyncPeriod: time.Minute,
+			Remediation:  consts.DriftRemediationNone,
+		}
+
+		req = ctrl.Request{NamespacedName: types.NamespacedName{Name: np.Name, Namespace: namespace}}
+	})
+
+	Context("When the NetworkPolicy matches its approval", func() {
+		BeforeEach(func() {
+			Expect(fakeClient.Create(ctx, approvalSecret(approved))).To(Succeed())
+			Expect(fakeClient.Create(ctx, np)).To(Succeed())
+		})
+
+		It("should not report drift and requeue after the resync period", func() {
+			result, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(time.Minute))
+
+			secret := &corev1.Secret{}
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Name: approval.Name(namespace, np.Name), Namespace: namespace}, secret)).To(Succeed())
+			Expect(secret.Annotations).NotTo(HaveKey(approval.AnnotationDriftHash))
+		})
+
+		It("should warn once when the approval is about to expire", func() {
+			reconciler.ExpiryWarning = 24 * time.Hour
+			secret := &corev1.Secret{}
+			secretKey := types.NamespacedName{Name: approval.Name(namespace, np.Name), Namespace: namespace}
+			Expect(fakeClient.Get(ctx, secretKey, secret)).To(Succeed())
+			notAfter := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+			secret.Annotations[approval.AnnotationNotAfter] = notAfter
+			Expect(fakeClient.Update(ctx, secret)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.Get(ctx, secretKey, secret)).To(Succeed())
+			Expect(secret.Annotations[approval.AnnotationExpiryNotified]).To(Equal(notAfter))
+		})
+	})
+
+	Context("When the NetworkPolicy drifted from its approval", func() {
+		var eventRecorder *record.FakeRecorder
+
+		BeforeEach(func() {
+			eventRecorder = record.NewFakeRecorder(10)
+			reconciler.Events = events.NewEmitter(fakeClient, eventRecorder)
+			Expect(fakeClient.Create(ctx, approvalSecret(approved))).To(Succeed())
+			np.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeEgress}
+			Expect(fakeClient.Create(ctx, np)).To(Succeed())
+		})
+
+		It("should record the drift on the approval secret", func() {
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			hash, err := approval.GenerateNetworkPolicyHash(np)
+			Expect(err).NotTo(HaveOccurred())
+			secret := &corev1.Secret{}
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Name: approval.Name(namespace, np.Name), Namespace: namespace}, secret)).To(Succeed())
+			Expect(secret.Annotations[approval.AnnotationDriftHash]).To(Equal(hash))
+			Expect(secret.Annotations).To(HaveKey(approval.AnnotationDriftDetectedAt))
+			Expect(eventRecorder.Events).To(Receive(ContainSubstring(events.ReasonDriftDetected)))
+		})
+
+		It("should restore the approved spec in revert mode", func() {
+			reconciler.Remediation = consts.DriftRemediationRevert
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			live := &networkingv1.NetworkPolicy{}
+			Expect(fakeClient.Get(ctx, req.NamespacedName, live)).To(Succeed())
+			Expect(live.Spec).To(Equal(approved.Spec))
+			Expect(eventRecorder.Events).To(Receive(ContainSubstring(events.ReasonDriftDetected)))
+			Expect(eventRecorder.Events).To(Receive(ContainSubstring(events.ReasonDriftReverted)))
+		})
+	})
+
+	Context("When the approval of the NetworkPolicy expired", func() {
+		var eventRecorder *record.FakeRecorder
+
+		BeforeEach(func() {
+			eventRecorder = record.NewFakeRecorder(10)
+			reconciler.Events = events.NewEmitter(fakeClient, eventRecorder)
+			secret := approvalSecret(approved)
+			secret.Annotations[approval.AnnotationNotAfter] = time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+			Expect(fakeClient.Create(ctx, secret)).To(Succeed())
+			Expect(fakeClient.Create(ctx, np)).To(Succeed())
+		})
+
+		It("should report the unchanged NetworkPolicy as drifted like the admission webhook", func() {
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(eventRecorder.Events).To(Receive(And(ContainSubstring(events.ReasonExpired), ContainSubstring("approval window ended"))))
+			Expect(eventRecorder.Events).To(Receive(And(ContainSubstring(events.ReasonDriftDetected), ContainSubstring("has no valid approval"))))
+		})
+
+		It("should delete the NetworkPolicy in delete mode", func() {
+			reconciler.Remediation = consts.DriftRemediationDelete
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = fakeClient.Get(ctx, req.NamespacedName, &networkingv1.NetworkPolicy{})
+			Expect(err).To(HaveOccurred())
+			Expect(client.IgnoreNotFound(err)).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("When the NetworkPolicy was never approved", func() {
+		BeforeEach(func() {
+			Expect(fakeClient.Create(ctx, np)).To(Succeed())
+		})
+
+		It("should only report the drift by default", func() {
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.Get(ctx, req.NamespacedName, &networkingv1.NetworkPolicy{})).To(Succeed())
+		})
+
+		It("should delete the NetworkPolicy in revert mode", func() {
+			reconciler.Remediation = consts.DriftRemediationRevert
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = fakeClient.Get(ctx, req.NamespacedName, &networkingv1.NetworkPolicy{})
+			Expect(err).To(HaveOccurred())
+			Expect(client.IgnoreNotFound(err)).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("When the NetworkPolicy was admitted by an approved change-set", func() {
+		var changeSet *certificatesv1.CertificateSigningRequest
+
+		BeforeEach(func() {
+			reconciler.Remediation = consts.DriftRemediationDelete
+			hash, err := approval.GenerateNetworkPolicyHash(np)
+			Expect(err).NotTo(HaveOccurred())
+			changeSet = &certificatesv1.CertificateSigningRequest{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        approval.ChangeSetName(namespace, "release-1-4"),
+					Annotations: map[string]string{approval.AnnotationChangeSetMembers: approval.EncodeChangeSetMembers(map[string]string{np.Name: hash})},
+				},
+			}
+			member := &certificatesv1.CertificateSigningRequest{ObjectMeta: metav1.ObjectMeta{
+				Name: approval.Name(namespace, np.Name),
+				Annotations: map[string]string{
+					approval.AnnotationApprovalHash: hash,
+					approval.AnnotationChangeSet:    changeSet.Name,
+				},
+			}}
+			Expect(fakeClient.Create(ctx, member)).To(Succeed())
+			Expect(fakeClient.Create(ctx, np)).To(Succeed())
+		})
+
+		It("should wait for the member to be approved once the change-set is", func() {
+			changeSet.Status.Conditions = []certificatesv1.CertificateSigningRequestCondition{
+				{Type: certificatesv1.CertificateApproved, Status: corev1.ConditionTrue},
+			}
+			Expect(fakeClient.Create(ctx, changeSet)).To(Succeed())
+
+			result, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(approvalInFlightRequeue))
+			Expect(fakeClient.Get(ctx, req.NamespacedName, &networkingv1.NetworkPolicy{})).To(Succeed())
+		})
+
+		It("should remediate it while the change-set is pending", func() {
+			Expect(fakeClient.Create(ctx, changeSet)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.Get(ctx, req.NamespacedName, &networkingv1.NetworkPolicy{})).NotTo(Succeed())
+		})
+	})
+
+	Context("When the NetworkPolicy was admitted by break-glass", func() {
+		var csr *certificatesv1.CertificateSigningRequest
+
+		BeforeEach(func() {
+			Expect(fakeClient.Create(ctx, approvalSecret(approved))).To(Succeed())
+			np.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeEgress}
+			np.Annotations = map[string]string{approval.AnnotationBreakGlass: "INC-42 database outage"}
+			Expect(fakeClient.Create(ctx, np)).To(Succeed())
+
+			hash, err := approval.GenerateNetworkPolicyHash(np)
+			Expect(err).NotTo(HaveOccurred())
+			csr = &certificatesv1.CertificateSigningRequest{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: approval.Name(namespace, np.Name),
+					Annotations: map[string]string{
+						approval.AnnotationApprovalHash:      hash,
+						approval.AnnotationBreakGlass:        "INC-42 database outage",
+						approval.AnnotationBreakGlassExpires: time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+					},
+				},
+			}
+		})
+
+		It("should leave it alone until the window closes", func() {
+			reconciler.Remediation = consts.DriftRemediationDelete
+			Expect(fakeClient.Create(ctx, csr)).To(Succeed())
+
+			result, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically(">", 59*time.Minute))
+			Expect(fakeClient.Get(ctx, req.NamespacedName, &networkingv1.NetworkPolicy{})).To(Succeed())
+		})
+
+		It("should revert it and withdraw the request once the window elapsed", func() {
+			csr.Annotations[approval.AnnotationBreakGlassExpires] = time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+			Expect(fakeClient.Create(ctx, csr)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			live := &networkingv1.NetworkPolicy{}
+			Expect(fakeClient.Get(ctx, req.NamespacedName, live)).To(Succeed())
+			Expect(live.Spec).To(Equal(approved.Spec))
+			Expect(live.Annotations).NotTo(HaveKey(approval.AnnotationBreakGlass))
+			err = fakeClient.Get(ctx, types.NamespacedName{Name: csr.Name}, &certificatesv1.CertificateSigningRequest{})
+			Expect(client.IgnoreNotFound(err)).NotTo(HaveOccurred())
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should roll it back as soon as the request is denied", func() {
+			csr.Status.Conditions = []certificatesv1.CertificateSigningRequestCondition{
+				{Type: certificatesv1.CertificateDenied, Status: corev1.ConditionTrue},
+			}
+			Expect(fakeClient.Create(ctx, csr)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			live := &networkingv1.NetworkPolicy{}
+			Expect(fakeClient.Get(ctx, req.NamespacedName, live)).To(Succeed())
+			Expect(live.Spec).To(Equal(approved.Spec))
+		})
+	})
+
+	Context("When an approval is scheduled", func() {
+		var (
+			secret    *corev1.Secret
+			scheduled *networkingv1.NetworkPolicy
+		)
+
+		BeforeEach(func() {
+			scheduled = approved.DeepCopy()
+			scheduled.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress}
+			secret = approvalSecret(approved)
+			for key, value := range approvalSecret(scheduled).Data {
+				secret.Data[approval.SecretKeyPendingPrefix+key] = value
+			}
+			secret.Data[approval.SecretKeyPendingPrefix+approval.SecretKeyCSRName] = []byte("scheduled-csr")
+		})
+
+		It("should requeue until notBefore", func() {
+			secret.Data[approval.SecretKeyPendingNotBefore] = []byte(time.Now().Add(10 * time.Second).UTC().Format(time.RFC3339))
+			Expect(fakeClient.Create(ctx, secret)).To(Succeed())
+			Expect(fakeClient.Create(ctx, np)).To(Succeed())
+
+			result, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically("<=", 10*time.Second))
+
+			live := &networkingv1.NetworkPolicy{}
+			Expect(fakeClient.Get(ctx, req.NamespacedName, live)).To(Succeed())
+			Expect(live.Spec).To(Equal(approved.Spec))
+		})
+
+		It("should activate it and apply the scheduled spec at notBefore", func() {
+			secret.Data[approval.SecretKeyPendingNotBefore] = []byte(time.Now().Add(-time.Minute).UTC().Format(time.RFC3339))
+			Expect(fakeClient.Create(ctx, secret)).To(Succeed())
+			Expect(fakeClient.Create(ctx, np)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			live := &networkingv1.NetworkPolicy{}
+			Expect(fakeClient.Get(ctx, req.NamespacedName, live)).To(Succeed())
+			Expect(live.Spec).To(Equal(scheduled.Spec))
+
+			hash, err := approval.GenerateNetworkPolicyHash(scheduled)
+			Expect(err).NotTo(HaveOccurred())
+			current := &corev1.Secret{}
+			Expect(fakeClient.Get(ctx, client.ObjectKeyFromObject(secret), current)).To(Succeed())
+			Expect(current.Data[approval.SecretKeyHash]).To(Equal([]byte(hash)))
+			Expect(current.Data).NotTo(HaveKey(approval.SecretKeyPendingPrefix + approval.SecretKeyHash))
+			Expect(current.Annotations[approval.AnnotationCSRName]).To(Equal("scheduled-csr"))
+			Expect(current.Annotations).To(HaveKey(approval.AnnotationNotBefore))
+		})
+
+		It("should create a NetworkPolicy that does not exist yet", func() {
+			secret.Data[approval.SecretKeyPendingNotBefore] = []byte(time.Now().Add(-time.Minute).UTC().Format(time.RFC3339))
+			Expect(fakeClient.Create(ctx, secret)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			live := &networkingv1.NetworkPolicy{}
+			Expect(fakeClient.Get(ctx, req.NamespacedName, live)).To(Succeed())
+			Expect(live.Spec).To(Equal(scheduled.Spec))
+		})
+
+		It("should drop it once its window ended", func() {
+			secret.Data[approval.SecretKeyPendingNotBefore] = []byte(time.Now().Add(-time.Hour).UTC().Format(time.RFC3339))
+			secret.Data[approval.SecretKeyPendingNotAfter] = []byte(time.Now().Add(-time.Minute).UTC().Format(time.RFC3339))
+			Expect(fakeClient.Create(ctx, secret)).To(Succeed())
+			Expect(fakeClient.Create(ctx, np)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			live := &networkingv1.NetworkPolicy{}
+			Expect(fakeClient.Get(ctx, req.NamespacedName, live)).To(Succeed())
+			Expect(live.Spec).To(Equal(approved.Spec))
+			current := &corev1.Secret{}
+			Expect(fakeClient.Get(ctx, client.ObjectKeyFromObject(secret), current)).To(Succeed())
+			Expect(current.Data).NotTo(HaveKey(approval.SecretKeyPendingPrefix + approval.SecretKeyHash))
+		})
+	})
+
+	Context("When the NetworkPolicy is rolled back to an approved version", func() {
+		var (
+			secret        *corev1.Secret
+			previous      string
+			eventRecorder *record.FakeRecorder
+		)
+
+		BeforeEach(func() {
+			eventRecorder = record.NewFakeRecorder(10)
+			reconciler.Events = events.NewEmitter(fakeClient, eventRecorder)
+			reconciler.HistoryLimit = 10
+			reconciler.Remediation = consts.DriftRemediationRevert
+			current := approved.DeepCopy()
+			current.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeEgress}
+			secret = approvalSecret(current)
+			var err error
+			previous, err = approval.GenerateNetworkPolicyHash(approved)
+			Expect(err).NotTo(HaveOccurred())
+			spec, err := approval.EncodeSpec(approved.Spec)
+			Expect(err).NotTo(HaveOccurred())
+			for _, version := range []approval.Version{
+				{Hash: previous, Spec: spec, Approver: "alice", ApprovedAt: time.Now().Add(-time.Hour)},
+				approval.CurrentVersion(secret.Data),
+			} {
+				Expect(approval.RecordVersion(secret.Data, version, 10)).To(Succeed())
+			}
+			Expect(fakeClient.Create(ctx, secret)).To(Succeed())
+		})
+
+		It("should make the restored version the current approval and record the incident", func() {
+			auditPath := filepath.Join(GinkgoT().TempDir(), "audit.jsonl")
+			sink, err := audit.NewFileSink(auditPath)
+			Expect(err).NotTo(HaveOccurred())
+			defer sink.Close()
+			reconciler.Audit = sink
+			np.Annotations = map[string]string{approval.AnnotationRollbackTo: previous, approval.AnnotationIncident: "INC-7"}
+			Expect(fakeClient.Create(ctx, np)).To(Succeed())
+
+			_, err = reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			live := &networkingv1.NetworkPolicy{}
+			Expect(fakeClient.Get(ctx, req.NamespacedName, live)).To(Succeed())
+			Expect(live.Spec).To(Equal(approved.Spec))
+			Expect(live.Annotations).NotTo(HaveKey(approval.AnnotationRollbackTo))
+			Expect(live.Annotations).NotTo(HaveKey(approval.AnnotationIncident))
+			current := &corev1.Secret{}
+			Expect(fakeClient.Get(ctx, client.ObjectKeyFromObject(secret), current)).To(Succeed())
+			Expect(string(current.Data[approval.SecretKeyHash])).To(Equal(previous))
+			Expect(current.Annotations[approval.AnnotationApprovalHash]).To(Equal(previous))
+			versions, err := approval.History(current.Data)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(versions).To(HaveLen(3))
+			Expect(versions[2].Hash).To(Equal(previous))
+			Expect(versions[2].RestoredAt).NotTo(BeNil())
+
+			records, err := audit.ReadFile(auditPath, func(audit.Record) bool { return true }, 0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(records).To(HaveLen(1))
+			Expect(records[0].Action).To(Equal(audit.ActionRollback))
+			Expect(records[0].PolicyHash).To(Equal(previous))
+			Expect(records[0].Incident).To(Equal("INC-7"))
+			Expect(eventRecorder.Events).To(Receive(And(ContainSubstring(events.ReasonRolledBack), ContainSubstring("INC-7"))))
+		})
+
+		It("should apply the restored version when only the annotations are set", func() {
+			np.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeEgress}
+			np.Annotations = map[string]string{approval.AnnotationRollbackTo: previous[:12], approval.AnnotationIncident: "INC-7"}
+			Expect(fakeClient.Create(ctx, np)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			live := &networkingv1.NetworkPolicy{}
+			Expect(fakeClient.Get(ctx, req.NamespacedName, live)).To(Succeed())
+			Expect(live.Spec).To(Equal(approved.Spec))
+			Expect(live.Annotations).NotTo(HaveKey(approval.AnnotationRollbackTo))
+			current := &corev1.Secret{}
+			Expect(fakeClient.Get(ctx, client.ObjectKeyFromObject(secret), current)).To(Succeed())
+			Expect(string(current.Data[approval.SecretKeyHash])).To(Equal(previous))
+		})
+
+		It("should refuse a rollback without an incident and revert the change", func() {
+			np.Annotations = map[string]string{approval.AnnotationRollbackTo: previous}
+			Expect(fakeClient.Create(ctx, np)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			live := &networkingv1.NetworkPolicy{}
+			Expect(fakeClient.Get(ctx, req.NamespacedName, live)).To(Succeed())
+			Expect(live.Spec.PolicyTypes).To(Equal([]networkingv1.PolicyType{networkingv1.PolicyTypeEgress}))
+			Expect(live.Annotations).NotTo(HaveKey(approval.AnnotationRollbackTo))
+			Expect(eventRecorder.Events).To(Receive(ContainSubstring(events.ReasonRollbackFailed)))
+		})
+
+		It("should refuse a version that is not in the history and revert the change", func() {
+			np.Annotations = map[string]string{approval.AnnotationRollbackTo: "0000", approval.AnnotationIncident: "INC-7"}
+			np.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress}
+			Expect(fakeClient.Create(ctx, np)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			live := &networkingv1.NetworkPolicy{}
+			Expect(fakeClient.Get(ctx, req.NamespacedName, live)).To(Succeed())
+			Expect(live.Spec.PolicyTypes).To(Equal([]networkingv1.PolicyType{networkingv1.PolicyTypeEgress}))
+			Expect(eventRecorder.Events).To(Receive(ContainSubstring(events.ReasonRollbackFailed)))
+		})
+	})
+
+	Context("When an approval is revoked", func() {
+		var secret *corev1.Secret
+
+		BeforeEach(func() {
+			secret = approvalSecret(approved)
+			secret.Finalizers = []string{approval.FinalizerApprovalProtection}
+			secret.Annotations[approval.AnnotationRevocationReason] = "INC-7"
+			secret.Data[approval.SecretKeyCSRName] = []byte(secret.Name)
+			csr := &certificatesv1.CertificateSigningRequest{ObjectMeta: metav1.ObjectMeta{
+				Name:        secret.Name,
+				Annotations: map[string]string{approval.AnnotationApprovalHash: string(secret.Data[approval.SecretKeyHash])},
+			}}
+			Expect(fakeClient.Create(ctx, csr)).To(Succeed())
+			Expect(fakeClient.Create(ctx, secret)).To(Succeed())
+			Expect(fakeClient.Create(ctx, np)).To(Succeed())
+			Expect(fakeClient.Delete(ctx, secret)).To(Succeed())
+		})
+
+		It("should mark the request revoked and release the approval secret", func() {
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeClient.Get(ctx, client.ObjectKeyFromObject(secret), &corev1.Secret{})).NotTo(Succeed())
+			csr := &certificatesv1.CertificateSigningRequest{}
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Name: secret.Name}, csr)).To(Succeed())
+			Expect(csr.Annotations[approval.AnnotationRevocationReason]).To(Equal("INC-7"))
+		})
+	})
+
+	Context("When the approved NetworkPolicy is missing", func() {
+		var secret *corev1.Secret
+
+		BeforeEach(func() {
+			reconciler.OrphanRetention = time.Hour
+			secret = approvalSecret(approved)
+			secret.Finalizers = []string{approval.FinalizerApprovalProtection}
+		})
+
+		It("should keep the approval for the retention period", func() {
+			Expect(fakeClient.Create(ctx, secret)).To(Succeed())
+
+			result, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically("<=", time.Hour))
+
+			current := &corev1.Secret{}
+			Expect(fakeClient.Get(ctx, client.ObjectKeyFromObject(secret), current)).To(Succeed())
+			Expect(current.Annotations).To(HaveKey(approval.AnnotationOrphanedSince))
+		})
+
+		It("should delete the approval once the retention period elapsed", func() {
+			secret.Annotations[approval.AnnotationOrphanedSince] = time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+			Expect(fakeClient.Create(ctx, secret)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeClient.Get(ctx, client.ObjectKeyFromObject(secret), &corev1.Secret{})).NotTo(Succeed())
+		})
+
+		It("should forget that it was missing once it exists again", func() {
+			secret.Annotations[approval.AnnotationOrphanedSince] = time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+			Expect(fakeClient.Create(ctx, secret)).To(Succeed())
+			Expect(fakeClient.Create(ctx, np)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			current := &corev1.Secret{}
+			Expect(fakeClient.Get(ctx, client.ObjectKeyFromObject(secret), current)).To(Succeed())
+			Expect(current.Annotations).NotTo(HaveKey(approval.AnnotationOrphanedSince))
+		})
+	})
+
+	Context("When the NetworkPolicy instantiates an approved template", func() {
+		BeforeEach(func() {
+			template := &approvalv1alpha1.PolicyTemplate{
+				ObjectMeta: metav1.ObjectMeta{Name: "app-isolation"},
+				Spec: approvalv1alpha1.PolicyTemplateSpec{
+					Parameters: []approvalv1alpha1.PolicyTemplateParameter{{Name: "app"}},
+					Template:   runtime.RawExtension{Raw: []byte(`{"podSelector": {"matchLabels": {"app": "{{app}}"}}}`)},
+				},
+			}
+			hash, err := templates.Hash(template.Spec)
+			Expect(err).NotTo(HaveOccurred())
+			template.Status.ApprovedHash = hash
+			Expect(fakeClient.Create(ctx, template)).To(Succeed())
+			Expect(fakeClient.Create(ctx, np)).To(Succeed())
+		})
+
+		It("should not remediate it", func() {
+			reconciler.Remediation = consts.DriftRemediationDelete
+			result, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(time.Minute))
+			Expect(fakeClient.Get(ctx, req.NamespacedName, &networkingv1.NetworkPolicy{})).To(Succeed())
+		})
+	})
+
+	Context("When the NetworkPolicy is in an excluded namespace", func() {
+		BeforeEach(func() {
+			reconciler.ExcludedNamespaces = []string{namespace}
+			reconciler.Remediation = consts.DriftRemediationDelete
+			Expect(fakeClient.Create(ctx, np)).To(Succeed())
+		})
+
+		It("should leave the NetworkPolicy alone", func() {
+			result, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeZero())
+			Expect(fakeClient.Get(ctx, req.NamespacedName, &networkingv1.NetworkPolicy{})).To(Succeed())
+		})
+	})
+})
@@ -0,0 +1,186 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	approvalv1alpha1 "github.com/hadi2f244/approve-controller/api/v1alpha1"
+	"github.com/hadi2f244/approve-controller/internal/pkg/approval"
+	"github.com/hadi2f244/approve-controller/internal/pkg/templates"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Reasons of the Approved condition of PolicyTemplates
+const (
+	templateReasonInvalid  = "InvalidTemplate"
+	templateReasonPending  = "PendingApproval"
+	templateReasonApproved = "Approved"
+	templateReasonDenied   = "Denied"
+)
+
+// PolicyTemplateReconciler files a CSR for every version of a PolicyTemplate and marks the
+// template approved once an administrator approves it
+type PolicyTemplateReconciler struct {
+	*SharedReconciler
+}
+
+// +kubebuilder:rbac:groups=approval.hadiazad.local,resources=policytemplates,verbs=get;list;watch
+// +kubebuilder:rbac:groups=approval.hadiazad.local,resources=policytemplates/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=approval.hadiazad.local,resources=policytemplates/finalizers,verbs=update
+
+func (r *PolicyTemplateReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := logf.FromContext(ctx).WithValues("policytemplate", req.Name)
+
+	template := &approvalv1alpha1.PolicyTemplate{}
+	exists, err := r.GetResource(ctx, req.NamespacedName, template)
+	if err != nil || !exists {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get PolicyTemplate")
+			return ctrl.Result{}, err
+		}
+		// The CSR is owned by the template and garbage collected with it
+		return ctrl.Result{}, nil
+	}
+	if !template.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	if err := templates.Validate(template.Spec); err != nil {
+		return ctrl.Result{}, r.setApproved(ctx, template, metav1.ConditionFalse, templateReasonInvalid, err.Error())
+	}
+	if templates.Approved(template) {
+		return ctrl.Result{}, r.setApproved(ctx, template, metav1.ConditionTrue, templateReasonApproved,
+			"Template was approved, matching NetworkPolicies are admitted without a request")
+	}
+
+	hash, err := templates.Hash(template.Spec)
+	if err != nil {
+		log.Error(err, "Failed to hash PolicyTemplate")
+		return ctrl.Result{}, err
+	}
+
+	csrName := templates.CSRName(template.Name)
+	csr := &certificatesv1.CertificateSigningRequest{}
+	exists, err = r.GetResource(ctx, types.NamespacedName{Name: csrName}, csr)
+	if err != nil && !errors.IsNotFound(err) {
+		log.Error(err, "Failed to get template CSR")
+		return ctrl.Result{}, err
+	}
+	if exists && csr.Annotations[approval.AnnotationApprovalHash] != hash {
+		// The CSR was filed for another version of the template, replace it
+		if _, err := r.DeleteResource(ctx, csr); client.IgnoreNotFound(err) != nil {
+			return ctrl.Result{}, err
+		}
+		exists = false
+	}
+	template.Status.CSRName = csrName
+
+	if !exists {
+		if err := r.createCSR(ctx, template, csrName, hash); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, r.setApproved(ctx, template, metav1.ConditionFalse, templateReasonPending,
+			fmt.Sprintf("Waiting for an administrator to approve CSR %s", csrName))
+	}
+
+	for _, condition := range csr.Status.Conditions {
+		switch condition.Type {
+		case certificatesv1.CertificateApproved:
+			now := metav1.Now()
+			template.Status.ApprovedHash = hash
+			template.Status.ApprovedAt = &now
+			r.Recorder().Eventf(template, corev1.EventTypeNormal, "TemplateApproved", "Template was approved with CSR %s", csrName)
+			return ctrl.Result{}, r.setApproved(ctx, template, metav1.ConditionTrue, templateReasonApproved,
+				"Template was approved, matching NetworkPolicies are admitted without a request")
+		case certificatesv1.CertificateDenied, certificatesv1.CertificateFailed:
+			return ctrl.Result{}, r.setApproved(ctx, template, metav1.ConditionFalse, templateReasonDenied,
+				fmt.Sprintf("CSR %s was denied. Change the template to file a new request", csrName))
+		}
+	}
+	return ctrl.Result{}, r.setApproved(ctx, template, metav1.ConditionFalse, templateReasonPending,
+		fmt.Sprintf("Waiting for an administrator to approve CSR %s", csrName))
+}
+
+// createCSR files the CSR administrators approve the template version with
+func (r *PolicyTemplateReconciler) createCSR(ctx context.Context, template *approvalv1alpha1.PolicyTemplate, csrName, hash string) error {
+	request, err := approval.NewCertificateRequest(csrName)
+	if err != nil {
+		return err
+	}
+	csr := &certificatesv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: csrName,
+			Labels: map[string]string{
+				approval.LabelTemplateApproval: "true",
+			},
+			Annotations: map[string]string{
+				approval.AnnotationApprovalHash: hash,
+				approval.AnnotationTemplateName: template.Name,
+			},
+		},
+		Spec: certificatesv1.CertificateSigningRequestSpec{
+			Request: request,
+			Usages: []certificatesv1.KeyUsage{
+				certificatesv1.UsageDigitalSignature,
+				certificatesv1.UsageKeyEncipherment,
+				certificatesv1.UsageClientAuth,
+			},
+			SignerName: approval.SignerName,
+		},
+	}
+	if err := controllerutil.SetControllerReference(template, csr, r.Scheme()); err != nil {
+		return err
+	}
+	_, err = r.CreateResource(ctx, csr)
+	return err
+}
+
+// setApproved updates the Approved condition, and the rest of the status, of the template
+func (r *PolicyTemplateReconciler) setApproved(ctx context.Context, template *approvalv1alpha1.PolicyTemplate, status metav1.ConditionStatus, reason, message string) error {
+	meta.SetStatusCondition(&template.Status.Conditions, metav1.Condition{
+		Type:               approvalv1alpha1.PolicyTemplateConditionApproved,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: template.Generation,
+	})
+	if err := r.Client().Status().Update(ctx, template); err != nil {
+		logf.FromContext(ctx).Error(err, "Failed to update PolicyTemplate status")
+		return err
+	}
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PolicyTemplateReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&approvalv1alpha1.PolicyTemplate{}).
+		Owns(&certificatesv1.CertificateSigningRequest{}).
+		Named("policytemplate").
+		Complete(r)
+}
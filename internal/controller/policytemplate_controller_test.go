@@ -0,0 +1,178 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	approvalv1alpha1 "github.com/hadi2f244/approve-controller/api/v1alpha1"
+	"github.com/hadi2f244/approve-controller/internal/pkg/approval"
+	"github.com/hadi2f244/approve-controller/internal/pkg/templates"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("PolicyTemplate Controller", func() {
+	var (
+		reconciler *PolicyTemplateReconciler
+		fakeClient client.Client
+		ctx        context.Context
+		req        ctrl.Request
+		template   *approvalv1alpha1.PolicyTemplate
+	)
+
+	getCSR := func() *certificatesv1.CertificateSigningRequest {
+		csr := &certificatesv1.CertificateSigningRequest{}
+		Expect(fakeClient.Get(ctx, types.NamespacedName{Name: templates.CSRName(template.Name)}, csr)).To(Succeed())
+		return csr
+	}
+	getTemplate := func() *approvalv1alpha1.PolicyTemplate {
+		current := &approvalv1alpha1.PolicyTemplate{}
+		Expect(fakeClient.Get(ctx, req.NamespacedName, current)).To(Succeed())
+		return current
+	}
+	setCSRCondition := func(conditionType certificatesv1.RequestConditionType) {
+		csr := getCSR()
+		csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+			Type:   conditionType,
+			Status: corev1.ConditionTrue,
+		})
+		Expect(fakeClient.SubResource("approval").Update(ctx, csr)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		Expect(approvalv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
+
+		template = &approvalv1alpha1.PolicyTemplate{
+			ObjectMeta: metav1.ObjectMeta{Name: "allow-from-frontend"},
+			Spec: approvalv1alpha1.PolicyTemplateSpec{
+				Parameters: []approvalv1alpha1.PolicyTemplateParameter{{Name: "app"}},
+				Template:   runtime.RawExtension{Raw: []byte(`{"podSelector": {"matchLabels": {"app": "{{app}}"}}}`)},
+			},
+		}
+		fakeClient = fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithStatusSubresource(&approvalv1alpha1.PolicyTemplate{}, &certificatesv1.CertificateSigningRequest{}).
+			WithObjects(template.DeepCopy()).
+			Build()
+
+		reconciler = &PolicyTemplateReconciler{
+			SharedReconciler: NewSharedReconciler(
+				fakeClient,
+				scheme.Scheme,
+				fakeClient,
+				logf.Log.WithName("test"),
+				record.NewFakeRecorder(10),
+			),
+		}
+		req = ctrl.Request{NamespacedName: types.NamespacedName{Name: template.Name}}
+	})
+
+	It("should file a CSR for the template and wait for its approval", func() {
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		hash, err := templates.Hash(template.Spec)
+		Expect(err).NotTo(HaveOccurred())
+		csr := getCSR()
+		Expect(csr.Labels).To(HaveKey(approval.LabelTemplateApproval))
+		Expect(csr.Annotations[approval.AnnotationApprovalHash]).To(Equal(hash))
+		Expect(csr.OwnerReferences).To(HaveLen(1))
+
+		current := getTemplate()
+		Expect(current.Status.CSRName).To(Equal(csr.Name))
+		Expect(meta.IsStatusConditionFalse(current.Status.Conditions, approvalv1alpha1.PolicyTemplateConditionApproved)).To(BeTrue())
+		Expect(templates.Approved(current)).To(BeFalse())
+	})
+
+	It("should approve the template once its CSR is approved", func() {
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		setCSRCondition(certificatesv1.CertificateApproved)
+
+		_, err = reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		current := getTemplate()
+		Expect(templates.Approved(current)).To(BeTrue())
+		Expect(current.Status.ApprovedAt).NotTo(BeNil())
+		Expect(meta.IsStatusConditionTrue(current.Status.Conditions, approvalv1alpha1.PolicyTemplateConditionApproved)).To(BeTrue())
+	})
+
+	It("should report a denied template", func() {
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		setCSRCondition(certificatesv1.CertificateDenied)
+
+		_, err = reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		condition := meta.FindStatusCondition(getTemplate().Status.Conditions, approvalv1alpha1.PolicyTemplateConditionApproved)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Reason).To(Equal(templateReasonDenied))
+	})
+
+	It("should file a new CSR when the approved template changes", func() {
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		setCSRCondition(certificatesv1.CertificateApproved)
+		_, err = reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		current := getTemplate()
+		current.Spec.Namespaces = []string{"team-a"}
+		Expect(fakeClient.Update(ctx, current)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		hash, err := templates.Hash(current.Spec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getCSR().Annotations[approval.AnnotationApprovalHash]).To(Equal(hash))
+		Expect(getCSR().Status.Conditions).To(BeEmpty())
+		Expect(templates.Approved(getTemplate())).To(BeFalse())
+	})
+
+	It("should not file a CSR for an invalid template", func() {
+		current := getTemplate()
+		current.Spec.Parameters = nil
+		Expect(fakeClient.Update(ctx, current)).To(Succeed())
+
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		condition := meta.FindStatusCondition(getTemplate().Status.Conditions, approvalv1alpha1.PolicyTemplateConditionApproved)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Reason).To(Equal(templateReasonInvalid))
+		err = fakeClient.Get(ctx, types.NamespacedName{Name: templates.CSRName(template.Name)}, &certificatesv1.CertificateSigningRequest{})
+		Expect(client.IgnoreNotFound(err)).NotTo(HaveOccurred())
+		Expect(err).To(HaveOccurred())
+	})
+})
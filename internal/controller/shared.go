@@ -86,7 +86,7 @@ func (r *SharedReconciler) CreateResource(ctx context.Context, obj client.Object
 		logger.Error(err, "create object", "kind", strings.Replace(fmt.Sprintf("%T", obj), "*", "", 1), "name", obj.GetName(), "namespace", obj.GetNamespace())
 		return false, err
 	}
-	r.Recorder().Eventf(obj, core.EventTypeNormal, "Created ", "kind", strings.Replace(fmt.Sprintf("%T", obj), "*", "", 1), "name", obj.GetName(), "namespace", obj.GetNamespace())
+	r.Recorder().Eventf(obj, core.EventTypeNormal, "Created", "Created %s", describe(obj))
 	// Let's re-fetch the object after update
 	return true, nil
 }
@@ -98,7 +98,7 @@ func (r *SharedReconciler) UpdateResource(ctx context.Context, objKey types.Name
 		logger.Error(err, "update object", "kind", strings.Replace(fmt.Sprintf("%T", obj), "*", "", 1), "name", obj.GetName(), "namespace", obj.GetNamespace())
 		return false, err
 	}
-	r.Recorder().Eventf(obj, core.EventTypeNormal, "Updated ", "kind", strings.Replace(fmt.Sprintf("%T", obj), "*", "", 1), "name", obj.GetName(), "namespace", obj.GetNamespace())
+	r.Recorder().Eventf(obj, core.EventTypeNormal, "Updated", "Updated %s", describe(obj))
 
 	// toContinue, err := r.GetResource(ctx, objKey, obj)
 	// return toContinue, err
@@ -111,7 +111,7 @@ func (r *SharedReconciler) UpdateResourceStatus(ctx context.Context, objKey type
 		logger.Error(err, "failed update object status", "kind", strings.Replace(fmt.Sprintf("%T", obj), "*", "", 1), "name", obj.GetName(), "namespace", obj.GetNamespace())
 		return false, err
 	}
-	r.Recorder().Eventf(obj, core.EventTypeNormal, "Updated status ", "kind", strings.Replace(fmt.Sprintf("%T", obj), "*", "", 1), "name", obj.GetName(), "namespace", obj.GetNamespace())
+	r.Recorder().Eventf(obj, core.EventTypeNormal, "StatusUpdated", "Updated status of %s", describe(obj))
 
 	// toContinue, err := r.GetResource(ctx, objKey, obj)
 	// return toContinue, err
@@ -124,7 +124,7 @@ func (r *SharedReconciler) DeleteResource(ctx context.Context, obj client.Object
 		logger.Error(err, "delete object", "kind", strings.Replace(fmt.Sprintf("%T", obj), "*", "", 1), "name", obj.GetName(), "namespace", obj.GetNamespace())
 		return false, err
 	}
-	r.Recorder().Eventf(obj, core.EventTypeNormal, "Deleted ", "kind", strings.Replace(fmt.Sprintf("%T", obj), "*", "", 1), "name", obj.GetName(), "namespace", obj.GetNamespace())
+	r.Recorder().Eventf(obj, core.EventTypeNormal, "Deleted", "Deleted %s", describe(obj))
 	return true, nil
 }
 
@@ -161,6 +161,15 @@ func (r *SharedReconciler) RemoveFinalizer(ctx context.Context, objKey types.Nam
 	return true, nil
 }
 
+// describe returns the Go type and the key of obj for event messages, e.g. v1.Secret default/name
+func describe(obj client.Object) string {
+	kind := strings.Replace(fmt.Sprintf("%T", obj), "*", "", 1)
+	if obj.GetNamespace() == "" {
+		return fmt.Sprintf("%s %s", kind, obj.GetName())
+	}
+	return fmt.Sprintf("%s %s/%s", kind, obj.GetNamespace(), obj.GetName())
+}
+
 func (r *SharedReconciler) ListOwnedResources(ctx context.Context, objKey types.NamespacedName, objList client.ObjectList, matchingField client.MatchingFields) (bool, error) {
 	logger, _ := logr.FromContext(ctx)
 	if err := r.Client().List(ctx, objList, client.InNamespace(objKey.Namespace), matchingField); err != nil {
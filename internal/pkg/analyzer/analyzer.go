@@ -0,0 +1,180 @@
+// Package analyzer inspects requested NetworkPolicy changes for risky patterns and scores them,
+// so approvers and auto-approval rules can tell a dangerous change from a harmless one.
+package analyzer
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// Severity of a finding
+type Severity string
+
+const (
+	SeverityLow    Severity = "low"
+	SeverityMedium Severity = "medium"
+	SeverityHigh   Severity = "high"
+)
+
+// weights are added to the risk score for each finding of a severity
+var weights = map[Severity]int{
+	SeverityLow:    5,
+	SeverityMedium: 20,
+	SeverityHigh:   40,
+}
+
+// MaxScore is the highest risk score, reached by any change with several high findings
+const MaxScore = 100
+
+// Finding identifiers
+const (
+	FindingAllowAllIngress    = "AllowAllIngress"
+	FindingAllowAllEgress     = "AllowAllEgress"
+	FindingWorldIPBlock       = "WorldIPBlock"
+	FindingAllNamespaces      = "AllNamespaces"
+	FindingDefaultDenyRemoved = "DefaultDenyRemoved"
+	FindingSensitivePort      = "SensitivePort"
+	FindingAllPortsToIPBlock  = "AllPortsToIPBlock"
+	FindingIsolationRemoved   = "IsolationRemoved"
+)
+
+// SensitivePorts are well-known ports of administrative and data services
+var SensitivePorts = map[int32]string{
+	22:    "ssh",
+	2379:  "etcd",
+	2380:  "etcd peer",
+	3306:  "mysql",
+	3389:  "rdp",
+	5432:  "postgresql",
+	6379:  "redis",
+	6443:  "kube-apiserver",
+	9200:  "elasticsearch",
+	10250: "kubelet",
+	27017: "mongodb",
+}
+
+// Finding is a risky pattern found in a NetworkPolicySpec
+type Finding struct {
+	ID       string   `json:"id"`
+	Severity Severity `json:"severity"`
+	// Path locates the pattern in the spec, e.g. spec.ingress[0].from[1]
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+// Report is the outcome of analyzing a change
+type Report struct {
+	// Score is the sum of the finding weights, capped at MaxScore
+	Score    int       `json:"score"`
+	Findings []Finding `json:"findings,omitempty"`
+}
+
+// Has reports whether the report contains a finding with the given ID
+func (r Report) Has(id string) bool {
+	return slices.ContainsFunc(r.Findings, func(finding Finding) bool { return finding.ID == id })
+}
+
+// Analyze inspects newSpec and, if the policy was approved before, the change from oldSpec
+func Analyze(oldSpec, newSpec *networkingv1.NetworkPolicySpec) Report {
+	findings := []Finding{}
+	add := func(id string, severity Severity, path, format string, args ...interface{}) {
+		findings = append(findings, Finding{ID: id, Severity: severity, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for i, rule := range newSpec.Ingress {
+		path := fmt.Sprintf("spec.ingress[%d]", i)
+		if len(rule.From) == 0 {
+			add(FindingAllowAllIngress, SeverityHigh, path, "empty from allows ingress from every source")
+		}
+		analyzePeers(add, path+".from", rule.From)
+		analyzePorts(add, path+".ports", rule.Ports)
+	}
+	for i, rule := range newSpec.Egress {
+		path := fmt.Sprintf("spec.egress[%d]", i)
+		if len(rule.To) == 0 {
+			add(FindingAllowAllEgress, SeverityMedium, path, "empty to allows egress to every destination")
+		}
+		analyzePeers(add, path+".to", rule.To)
+		analyzePorts(add, path+".ports", rule.Ports)
+		if len(rule.Ports) == 0 && slices.ContainsFunc(rule.To, func(peer networkingv1.NetworkPolicyPeer) bool { return peer.IPBlock != nil }) {
+			add(FindingAllPortsToIPBlock, SeverityLow, path, "egress to an ipBlock is allowed on every port")
+		}
+	}
+
+	if oldSpec != nil {
+		for _, direction := range []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress} {
+			if isDefaultDeny(oldSpec, direction) && !isDefaultDeny(newSpec, direction) {
+				add(FindingDefaultDenyRemoved, SeverityHigh, "spec", "the policy no longer denies all %s traffic of the selected pods", direction)
+			} else if isolates(oldSpec, direction) && !isolates(newSpec, direction) {
+				add(FindingIsolationRemoved, SeverityMedium, "spec.policyTypes", "the selected pods are no longer isolated for %s", direction)
+			}
+		}
+	}
+
+	score := 0
+	for _, finding := range findings {
+		score += weights[finding.Severity]
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return weights[findings[i].Severity] > weights[findings[j].Severity]
+	})
+	return Report{Score: min(score, MaxScore), Findings: findings}
+}
+
+func analyzePeers(add func(string, Severity, string, string, ...interface{}), path string, peers []networkingv1.NetworkPolicyPeer) {
+	for i, peer := range peers {
+		peerPath := fmt.Sprintf("%s[%d]", path, i)
+		if peer.IPBlock != nil && (peer.IPBlock.CIDR == "0.0.0.0/0" || peer.IPBlock.CIDR == "::/0") {
+			add(FindingWorldIPBlock, SeverityHigh, peerPath, "ipBlock %s matches every address", peer.IPBlock.CIDR)
+		}
+		if peer.NamespaceSelector != nil && len(peer.NamespaceSelector.MatchLabels) == 0 && len(peer.NamespaceSelector.MatchExpressions) == 0 {
+			add(FindingAllNamespaces, SeverityMedium, peerPath, "empty namespaceSelector matches every namespace")
+		}
+	}
+}
+
+func analyzePorts(add func(string, Severity, string, string, ...interface{}), path string, ports []networkingv1.NetworkPolicyPort) {
+	for i, port := range ports {
+		if port.Port == nil || port.Port.IntValue() == 0 {
+			// Named ports cannot be resolved without the pods
+			continue
+		}
+		first := int32(port.Port.IntValue())
+		last := first
+		if port.EndPort != nil {
+			last = *port.EndPort
+		}
+		numbers := make([]int32, 0, len(SensitivePorts))
+		for number := range SensitivePorts {
+			numbers = append(numbers, number)
+		}
+		slices.Sort(numbers)
+		for _, number := range numbers {
+			if number >= first && number <= last {
+				add(FindingSensitivePort, SeverityMedium, fmt.Sprintf("%s[%d]", path, i), "opens port %d (%s)", number, SensitivePorts[number])
+			}
+		}
+	}
+}
+
+// isolates reports whether the policy isolates the selected pods in the given direction
+func isolates(spec *networkingv1.NetworkPolicySpec, direction networkingv1.PolicyType) bool {
+	if len(spec.PolicyTypes) > 0 {
+		return slices.Contains(spec.PolicyTypes, direction)
+	}
+	return direction == networkingv1.PolicyTypeIngress || len(spec.Egress) > 0
+}
+
+// isDefaultDeny reports whether the policy selects every pod and allows no traffic in the given direction
+func isDefaultDeny(spec *networkingv1.NetworkPolicySpec, direction networkingv1.PolicyType) bool {
+	if len(spec.PodSelector.MatchLabels) > 0 || len(spec.PodSelector.MatchExpressions) > 0 || !isolates(spec, direction) {
+		return false
+	}
+	if direction == networkingv1.PolicyTypeIngress {
+		return len(spec.Ingress) == 0
+	}
+	return len(spec.Egress) == 0
+}
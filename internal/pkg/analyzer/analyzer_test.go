@@ -0,0 +1,98 @@
+package analyzer
+
+import (
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestAnalyze(t *testing.T) {
+	sshPort := intstr.FromInt32(22)
+	endPort := int32(3000)
+	httpPort := intstr.FromInt32(80)
+	defaultDeny := &networkingv1.NetworkPolicySpec{PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}}
+
+	tests := map[string]struct {
+		oldSpec *networkingv1.NetworkPolicySpec
+		newSpec *networkingv1.NetworkPolicySpec
+		want    []string
+	}{
+		"pod selector only": {
+			newSpec: &networkingv1.NetworkPolicySpec{Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				From: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}}},
+			}}},
+		},
+		"allow all ingress": {
+			newSpec: &networkingv1.NetworkPolicySpec{Ingress: []networkingv1.NetworkPolicyIngressRule{{}}},
+			want:    []string{FindingAllowAllIngress},
+		},
+		"world ipBlock and all namespaces": {
+			newSpec: &networkingv1.NetworkPolicySpec{Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				From: []networkingv1.NetworkPolicyPeer{
+					{IPBlock: &networkingv1.IPBlock{CIDR: "0.0.0.0/0"}},
+					{NamespaceSelector: &metav1.LabelSelector{}},
+				},
+			}}},
+			want: []string{FindingWorldIPBlock, FindingAllNamespaces},
+		},
+		"sensitive port range": {
+			newSpec: &networkingv1.NetworkPolicySpec{Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				From:  []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}},
+				Ports: []networkingv1.NetworkPolicyPort{{Port: &sshPort, EndPort: &endPort}, {Port: &httpPort}},
+			}}},
+			want: []string{FindingSensitivePort, FindingSensitivePort, FindingSensitivePort},
+		},
+		"default deny removed": {
+			oldSpec: defaultDeny,
+			newSpec: &networkingv1.NetworkPolicySpec{
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+				Ingress: []networkingv1.NetworkPolicyIngressRule{{
+					From: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}},
+				}},
+			},
+			want: []string{FindingDefaultDenyRemoved},
+		},
+		"default deny kept": {
+			oldSpec: defaultDeny,
+			newSpec: defaultDeny,
+		},
+		"egress isolation removed": {
+			oldSpec: &networkingv1.NetworkPolicySpec{Egress: []networkingv1.NetworkPolicyEgressRule{{
+				To: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}},
+			}}},
+			newSpec: &networkingv1.NetworkPolicySpec{},
+			want:    []string{FindingIsolationRemoved},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			report := Analyze(tt.oldSpec, tt.newSpec)
+			got := []string{}
+			for _, finding := range report.Findings {
+				got = append(got, finding.ID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Analyze() findings = %v, want %v", report.Findings, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Analyze() findings = %v, want %v", got, tt.want)
+				}
+			}
+			if len(tt.want) == 0 && report.Score != 0 {
+				t.Errorf("Analyze() score = %d for a change without findings", report.Score)
+			}
+		})
+	}
+}
+
+func TestScoreIsCapped(t *testing.T) {
+	spec := &networkingv1.NetworkPolicySpec{
+		Ingress: []networkingv1.NetworkPolicyIngressRule{{}, {}, {}},
+	}
+	if report := Analyze(nil, spec); report.Score != MaxScore {
+		t.Errorf("Analyze() score = %d, want %d", report.Score, MaxScore)
+	}
+}
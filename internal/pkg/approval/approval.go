@@ -0,0 +1,471 @@
+// Package approval holds the pieces of the NetworkPolicy approval protocol that are
+// shared between the admission webhook, the controllers and the command line tools.
+package approval
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// AnnotationApprovalHash contains the hash of the approved NetworkPolicy
+	AnnotationApprovalHash = "networkpolicy.webhook.io/approval-hash"
+	// AnnotationCSRName contains the CSR name for pending approval
+	AnnotationCSRName = "networkpolicy.webhook.io/csr-name"
+	// AnnotationName contains the name of the NetworkPolicy a CSR was filed for
+	AnnotationName = "networkpolicy.webhook.io/name"
+	// AnnotationNamespace contains the namespace of the NetworkPolicy a CSR was filed for
+	AnnotationNamespace = "networkpolicy.webhook.io/namespace"
+	// AnnotationSpec contains the JSON encoded NetworkPolicySpec that was requested
+	AnnotationSpec = "networkpolicy.webhook.io/spec"
+	// AnnotationRequester contains the user whose change filed the approval request
+	AnnotationRequester = "networkpolicy.webhook.io/requester"
+	// AnnotationDenialRecorded marks denied CSRs whose denial was written to the audit trail
+	AnnotationDenialRecorded = "networkpolicy.webhook.io/denial-recorded"
+	// AnnotationAutoApprovedBy contains the auto-approval rule that approved a CSR
+	AnnotationAutoApprovedBy = "networkpolicy.webhook.io/auto-approved-by"
+	// AnnotationRequiredApprovers contains the number of distinct approvers a CSR needs
+	AnnotationRequiredApprovers = "networkpolicy.webhook.io/required-approvers"
+	// AnnotationApprovers contains the comma separated users that approved a CSR needing several approvers
+	AnnotationApprovers = "networkpolicy.webhook.io/approvers"
+	// AnnotationAffectedNamespaces contains the comma separated other namespaces a CSR's NetworkPolicy selects peers in
+	AnnotationAffectedNamespaces = "networkpolicy.webhook.io/affected-namespaces"
+	// AnnotationNamespaceApprovals contains the comma separated namespace=user approvals of the affected namespaces
+	AnnotationNamespaceApprovals = "networkpolicy.webhook.io/namespace-approvals"
+	// AnnotationRiskScore contains the risk score of the requested change
+	AnnotationRiskScore = "networkpolicy.webhook.io/risk-score"
+	// AnnotationRiskFindings contains the JSON encoded risk findings of the requested change
+	AnnotationRiskFindings = "networkpolicy.webhook.io/risk-findings"
+	// AnnotationTemplate contains the PolicyTemplate that admitted a NetworkPolicy
+	AnnotationTemplate = "networkpolicy.webhook.io/template"
+	// AnnotationTemplateParameters contains the JSON encoded parameters the NetworkPolicy instantiated the template with
+	AnnotationTemplateParameters = "networkpolicy.webhook.io/template-parameters"
+	// AnnotationTemplateName contains the name of the PolicyTemplate a CSR was filed for
+	AnnotationTemplateName = "networkpolicy.webhook.io/template-name"
+	// AnnotationBreakGlass contains the justification of a NetworkPolicy admitted without approval during an
+	// incident, it is copied to the retroactive approval request
+	AnnotationBreakGlass = "networkpolicy.webhook.io/break-glass"
+	// AnnotationBreakGlassExpires contains the RFC3339 time the retroactive approval request has to be approved by
+	AnnotationBreakGlassExpires = "networkpolicy.webhook.io/break-glass-expires"
+	// AnnotationFreeze contains the change freeze a CSR was filed during
+	AnnotationFreeze = "networkpolicy.webhook.io/freeze"
+	// AnnotationApproverGroups contains the comma separated groups one of which the approver of a CSR has to be in
+	AnnotationApproverGroups = "networkpolicy.webhook.io/approver-groups"
+	// AnnotationNotBefore contains the RFC3339 time an approval takes effect, set by the approver of a CSR
+	AnnotationNotBefore = "networkpolicy.webhook.io/not-before"
+	// AnnotationNotAfter contains the RFC3339 time after which an approval no longer admits the NetworkPolicy
+	AnnotationNotAfter = "networkpolicy.webhook.io/not-after"
+	// AnnotationExpiryNotified contains the RFC3339 expiry of the approval that approvers were last warned about
+	AnnotationExpiryNotified = "networkpolicy.webhook.io/expiry-notified"
+	// AnnotationUsedCallbackTokens contains the comma separated IDs of the callback tokens used on a CSR
+	AnnotationUsedCallbackTokens = "networkpolicy.webhook.io/used-callback-tokens"
+	// AnnotationSignature contains a base64 encoded detached signature over the hash of a NetworkPolicy made with
+	// a trusted key, it admits the NetworkPolicy without a CSR
+	AnnotationSignature = "networkpolicy.webhook.io/signature"
+	// AnnotationNPName contains the NetworkPolicy name on the approval Secret
+	AnnotationNPName = "networkpolicy.webhook.io/np-name"
+	// AnnotationNPNamespace contains the NetworkPolicy namespace on the approval Secret
+	AnnotationNPNamespace = "networkpolicy.webhook.io/np-namespace"
+	// AnnotationOrphanedSince contains the RFC3339 time the NetworkPolicy of an approval Secret was found missing
+	AnnotationOrphanedSince = "networkpolicy.webhook.io/orphaned-since"
+	// AnnotationRevocationReason contains why an approval Secret is deleted, it is recorded with the revocation
+	AnnotationRevocationReason = "networkpolicy.webhook.io/revocation-reason"
+	// AnnotationDriftHash contains the hash of the live NetworkPolicy when it drifted from the approval
+	AnnotationDriftHash = "networkpolicy.webhook.io/drift-hash"
+	// AnnotationDriftDetectedAt contains the RFC3339 time the drift was first detected
+	AnnotationDriftDetectedAt = "networkpolicy.webhook.io/drift-detected-at"
+	// AnnotationChangeID groups the requests of the NetworkPolicies of a release into one change-set, on a
+	// change-set CSR it contains the change-id it was filed for
+	AnnotationChangeID = "networkpolicy.webhook.io/change-id"
+	// AnnotationChangeSet contains the name of the change-set CSR a request is a member of
+	AnnotationChangeSet = "networkpolicy.webhook.io/change-set"
+	// AnnotationChangeSetMembers contains the comma separated name=hash of the NetworkPolicies of a change-set
+	AnnotationChangeSetMembers = "networkpolicy.webhook.io/change-set-members"
+
+	// LabelNetworkPolicyApproval labels CSRs and Secrets for NetworkPolicy approval
+	LabelNetworkPolicyApproval = "networkpolicy.webhook.io/approval"
+	// LabelValueChangeSet is the LabelNetworkPolicyApproval value of change-set CSRs, requests and approval
+	// Secrets of single NetworkPolicies have the value "true"
+	LabelValueChangeSet = "change-set"
+	// LabelTemplateApproval labels CSRs for PolicyTemplate approval
+	LabelTemplateApproval = "networkpolicy.webhook.io/template-approval"
+	// LabelNetworkPolicyName labels approval Secrets with the NetworkPolicy name
+	LabelNetworkPolicyName = "networkpolicy.webhook.io/name"
+
+	// SecretTypeNetworkPolicyApproval is the type for approved NetworkPolicy secrets
+	SecretTypeNetworkPolicyApproval corev1.SecretType = "networkpolicy.webhook.io/approval"
+	// FinalizerApprovalProtection protects approval Secrets from accidental deletion
+	FinalizerApprovalProtection = "networkpolicy.webhook.io/approval-protection"
+
+	// AllNamespaces is the affected namespace of a selector matching every namespace, it needs a cluster-wide approver
+	AllNamespaces = "*"
+
+	// ConditionReasonAutoApproved is the reason of the Approved condition set by auto-approval
+	ConditionReasonAutoApproved = "AutoApproved"
+	// ConditionReasonChangeSet is the reason of the conditions set on the members of a decided change-set
+	ConditionReasonChangeSet = "ChangeSet"
+
+	// SecretKeyHash is the approval Secret data key holding the approved hash
+	SecretKeyHash = "hash"
+	// SecretKeyCertificate is the approval Secret data key holding the issued certificate
+	SecretKeyCertificate = "tls-crt"
+	// SecretKeyCSRName is the approval Secret data key holding the CSR name
+	SecretKeyCSRName = "csr-name"
+	// SecretKeySpec is the approval Secret data key holding the approved NetworkPolicySpec
+	SecretKeySpec = "spec"
+	// SecretKeyRequester, SecretKeyApprovedAt and SecretKeyApprovalMessage are the approval Secret data keys
+	// holding who requested the approval, when (RFC3339) and why it was given, so the approval does not depend
+	// on its CSR, which is garbage collected
+	SecretKeyRequester       = "requester"
+	SecretKeyApprovedAt      = "approved-at"
+	SecretKeyApprovalMessage = "approval-message"
+	// SecretKeyPendingPrefix prefixes the data keys of an approval scheduled for a later notBefore,
+	// it replaces the current approval at that time
+	SecretKeyPendingPrefix = "pending-"
+	// SecretKeyPendingNotBefore and SecretKeyPendingNotAfter hold the window of the pending approval
+	SecretKeyPendingNotBefore = SecretKeyPendingPrefix + "not-before"
+	SecretKeyPendingNotAfter  = SecretKeyPendingPrefix + "not-after"
+)
+
+// NetworkPolicyData represents the data used for generating hash
+type NetworkPolicyData struct {
+	Name      string                         `json:"name"`
+	Namespace string                         `json:"namespace"`
+	Spec      networkingv1.NetworkPolicySpec `json:"spec"`
+}
+
+// GenerateNetworkPolicyHash creates a unique hash for the NetworkPolicy
+func GenerateNetworkPolicyHash(np *networkingv1.NetworkPolicy) (string, error) {
+	data := NetworkPolicyData{
+		Name:      np.Name,
+		Namespace: np.Namespace,
+		Spec:      np.Spec,
+	}
+
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal NetworkPolicy data: %w", err)
+	}
+
+	hash := sha256.Sum256(jsonData)
+	return fmt.Sprintf("%x", hash), nil
+}
+
+// SetDefaults applies the defaults the API server sets on NetworkPolicies before admission, so that hashes
+// computed from manifests match the ones the webhook computes
+func SetDefaults(np *networkingv1.NetworkPolicy) {
+	if len(np.Spec.PolicyTypes) == 0 {
+		np.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}
+		if len(np.Spec.Egress) != 0 {
+			np.Spec.PolicyTypes = append(np.Spec.PolicyTypes, networkingv1.PolicyTypeEgress)
+		}
+	}
+	for i := range np.Spec.Ingress {
+		defaultProtocols(np.Spec.Ingress[i].Ports)
+	}
+	for i := range np.Spec.Egress {
+		defaultProtocols(np.Spec.Egress[i].Ports)
+	}
+}
+
+func defaultProtocols(ports []networkingv1.NetworkPolicyPort) {
+	for i := range ports {
+		if ports[i].Protocol == nil {
+			protocol := corev1.ProtocolTCP
+			ports[i].Protocol = &protocol
+		}
+	}
+}
+
+// Name returns the name shared by the CSR and the Secret of a NetworkPolicy approval
+func Name(namespace, name string) string {
+	return fmt.Sprintf("np-approval-%s-%s", namespace, name)
+}
+
+// EncodeSpec serializes a NetworkPolicySpec for storage in annotations and Secret data
+func EncodeSpec(spec networkingv1.NetworkPolicySpec) (string, error) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal NetworkPolicy spec: %w", err)
+	}
+	return string(data), nil
+}
+
+// DecodeSpec deserializes a NetworkPolicySpec stored with EncodeSpec
+func DecodeSpec(data []byte) (*networkingv1.NetworkPolicySpec, error) {
+	spec := &networkingv1.NetworkPolicySpec{}
+	if err := json.Unmarshal(data, spec); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal NetworkPolicy spec: %w", err)
+	}
+	return spec, nil
+}
+
+// RenderPolicy renders the NetworkPolicy with spec as YAML manifest for reviewers
+func RenderPolicy(namespace, name string, spec *networkingv1.NetworkPolicySpec) ([]byte, error) {
+	rendered, err := yaml.Marshal(&networkingv1.NetworkPolicy{
+		TypeMeta:   metav1.TypeMeta{APIVersion: networkingv1.SchemeGroupVersion.String(), Kind: "NetworkPolicy"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec:       *spec,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render NetworkPolicy: %w", err)
+	}
+	return rendered, nil
+}
+
+// CertificateNotAfter returns the expiry of a PEM encoded certificate, false if it cannot be parsed
+func CertificateNotAfter(data []byte) (time.Time, bool) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return time.Time{}, false
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return certificate.NotAfter, true
+}
+
+// ValidCertificate reports whether secret is an approval Secret with an approved hash and a certificate that
+// has not expired at now. PEM data that does not parse as a certificate is accepted, e.g. in tests
+func ValidCertificate(secret *corev1.Secret, now time.Time) bool {
+	if secret.Type != SecretTypeNetworkPolicyApproval {
+		return false
+	}
+	if _, ok := secret.Data[SecretKeyHash]; !ok {
+		return false
+	}
+	certificate := secret.Data[SecretKeyCertificate]
+	if notAfter, ok := CertificateNotAfter(certificate); ok {
+		return !notAfter.Before(now)
+	}
+	return bytes.HasPrefix(certificate, []byte("-----BEGIN CERTIFICATE-----"))
+}
+
+// Expired returns why the approval in secret no longer admits its NetworkPolicy at now, empty if it does.
+// The admission webhook and the drift detection agree on it
+func Expired(secret *corev1.Secret, now time.Time) string {
+	if !ValidCertificate(secret, now) {
+		if notAfter, ok := CertificateNotAfter(secret.Data[SecretKeyCertificate]); ok {
+			return fmt.Sprintf("certificate expired at %s", notAfter.UTC().Format(time.RFC3339))
+		}
+		return "approval has no valid certificate"
+	}
+	window, err := AnnotatedWindow(secret.Annotations)
+	if err != nil {
+		return err.Error()
+	}
+	if window.Ended(now) {
+		return fmt.Sprintf("approval window ended at %s", window.NotAfter.UTC().Format(time.RFC3339))
+	}
+	return ""
+}
+
+// RequiredApprovers returns the number of distinct approvers a CSR needs, 1 unless a rule asked for more
+func RequiredApprovers(annotations map[string]string) int {
+	required, err := strconv.Atoi(annotations[AnnotationRequiredApprovers])
+	if err != nil || required < 1 {
+		return 1
+	}
+	return required
+}
+
+// Approvers returns the distinct users recorded as approvers of a CSR
+func Approvers(annotations map[string]string) []string {
+	approvers := []string{}
+	for _, approver := range strings.Split(annotations[AnnotationApprovers], ",") {
+		if approver = strings.TrimSpace(approver); approver != "" && !slices.Contains(approvers, approver) {
+			approvers = append(approvers, approver)
+		}
+	}
+	return approvers
+}
+
+// AffectedNamespaces returns the other namespaces the NetworkPolicy of a CSR selects peers in
+func AffectedNamespaces(annotations map[string]string) []string {
+	namespaces := []string{}
+	for _, namespace := range strings.Split(annotations[AnnotationAffectedNamespaces], ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" && !slices.Contains(namespaces, namespace) {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
+
+// NamespaceApprovals returns the user that approved the CSR for each affected namespace
+func NamespaceApprovals(annotations map[string]string) map[string]string {
+	approvals := map[string]string{}
+	for _, entry := range strings.Split(annotations[AnnotationNamespaceApprovals], ",") {
+		namespace, user, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if ok && namespace != "" && user != "" {
+			approvals[namespace] = user
+		}
+	}
+	return approvals
+}
+
+// EncodeNamespaceApprovals returns the annotation value of the namespace approvals, sorted by namespace
+func EncodeNamespaceApprovals(approvals map[string]string) string {
+	entries := make([]string, 0, len(approvals))
+	for namespace, user := range approvals {
+		entries = append(entries, namespace+"="+user)
+	}
+	slices.Sort(entries)
+	return strings.Join(entries, ",")
+}
+
+// ChangeSetName returns the name of the change-set CSR with id in namespace
+func ChangeSetName(namespace, id string) string {
+	return fmt.Sprintf("np-changeset-%s-%s", namespace, id)
+}
+
+// ChangeSetID turns a change-id into the id of its change-set, a DNS label of at most 63 characters
+func ChangeSetID(changeID string) string {
+	id := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(changeID))
+	if len(id) > 63 {
+		id = id[:63]
+	}
+	return strings.Trim(id, "-")
+}
+
+// ChangeSetMembers returns the hash of each NetworkPolicy of a change-set CSR by name
+func ChangeSetMembers(annotations map[string]string) map[string]string {
+	members := map[string]string{}
+	for _, entry := range strings.Split(annotations[AnnotationChangeSetMembers], ",") {
+		name, hash, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if ok && name != "" && hash != "" {
+			members[name] = hash
+		}
+	}
+	return members
+}
+
+// EncodeChangeSetMembers returns the annotation value of the members of a change-set, sorted by name
+func EncodeChangeSetMembers(members map[string]string) string {
+	entries := make([]string, 0, len(members))
+	for name, hash := range members {
+		entries = append(entries, name+"="+hash)
+	}
+	slices.Sort(entries)
+	return strings.Join(entries, ",")
+}
+
+// PendingNamespaces returns the affected namespaces of a CSR nobody approved it for yet
+func PendingNamespaces(annotations map[string]string) []string {
+	approvals := NamespaceApprovals(annotations)
+	pending := []string{}
+	for _, namespace := range AffectedNamespaces(annotations) {
+		if _, ok := approvals[namespace]; !ok {
+			pending = append(pending, namespace)
+		}
+	}
+	return pending
+}
+
+// ApproverGroups returns the groups one of which the approver of a CSR has to be in, empty if anyone may approve
+func ApproverGroups(annotations map[string]string) []string {
+	groups := []string{}
+	for _, group := range strings.Split(annotations[AnnotationApproverGroups], ",") {
+		if group = strings.TrimSpace(group); group != "" && !slices.Contains(groups, group) {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// ApprovalsComplete reports whether an approved CSR has every approver and namespace approval it needs
+func ApprovalsComplete(annotations map[string]string) bool {
+	if required := RequiredApprovers(annotations); required > 1 && len(Approvers(annotations)) < required {
+		return false
+	}
+	return len(PendingNamespaces(annotations)) == 0
+}
+
+// BreakGlassExpiry returns the end of the break-glass window of a CSR, false if it was not filed by break-glass
+func BreakGlassExpiry(annotations map[string]string) (time.Time, bool) {
+	expires, ok := annotations[AnnotationBreakGlassExpires]
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, expires)
+	if err != nil {
+		// A malformed window is treated as elapsed
+		return time.Time{}, true
+	}
+	return t, true
+}
+
+// Window limits when an approval admits its NetworkPolicy, zero times are unbounded
+type Window struct {
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// ParseWindow parses the RFC3339 bounds of a window, empty bounds are unbounded
+func ParseWindow(notBefore, notAfter string) (Window, error) {
+	var w Window
+	var err error
+	if notBefore != "" {
+		if w.NotBefore, err = time.Parse(time.RFC3339, notBefore); err != nil {
+			return w, fmt.Errorf("invalid notBefore %q, expected RFC3339: %w", notBefore, err)
+		}
+	}
+	if notAfter != "" {
+		if w.NotAfter, err = time.Parse(time.RFC3339, notAfter); err != nil {
+			return w, fmt.Errorf("invalid notAfter %q, expected RFC3339: %w", notAfter, err)
+		}
+	}
+	if !w.NotBefore.IsZero() && !w.NotAfter.IsZero() && !w.NotAfter.After(w.NotBefore) {
+		return w, fmt.Errorf("notAfter %s is not after notBefore %s", notAfter, notBefore)
+	}
+	return w, nil
+}
+
+// AnnotatedWindow returns the window recorded in the not-before and not-after annotations
+func AnnotatedWindow(annotations map[string]string) (Window, error) {
+	return ParseWindow(annotations[AnnotationNotBefore], annotations[AnnotationNotAfter])
+}
+
+// PendingWindow returns the window of the approval scheduled in the data of an approval Secret
+func PendingWindow(data map[string][]byte) (Window, error) {
+	return ParseWindow(string(data[SecretKeyPendingNotBefore]), string(data[SecretKeyPendingNotAfter]))
+}
+
+// Pending reports whether t is before the window starts
+func (w Window) Pending(t time.Time) bool {
+	return !w.NotBefore.IsZero() && t.Before(w.NotBefore)
+}
+
+// Ended reports whether t is at or after the end of the window
+func (w Window) Ended(t time.Time) bool {
+	return !w.NotAfter.IsZero() && !t.Before(w.NotAfter)
+}
+
+// Format returns the RFC3339 bounds of the window, empty for unbounded ones
+func (w Window) Format() (notBefore, notAfter string) {
+	if !w.NotBefore.IsZero() {
+		notBefore = w.NotBefore.UTC().Format(time.RFC3339)
+	}
+	if !w.NotAfter.IsZero() {
+		notAfter = w.NotAfter.UTC().Format(time.RFC3339)
+	}
+	return notBefore, notAfter
+}
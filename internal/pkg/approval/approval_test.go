@@ -0,0 +1,165 @@
+package approval
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestSetDefaultsMatchesAdmittedPolicy(t *testing.T) {
+	port := intstr.FromInt32(5432)
+	manifest := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "shop"},
+		Spec: networkingv1.NetworkPolicySpec{
+			Egress: []networkingv1.NetworkPolicyEgressRule{{Ports: []networkingv1.NetworkPolicyPort{{Port: &port}}}},
+		},
+	}
+	// As stored by the API server and seen by the webhook
+	tcp := corev1.ProtocolTCP
+	admitted := manifest.DeepCopy()
+	admitted.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress}
+	admitted.Spec.Egress[0].Ports[0].Protocol = &tcp
+
+	SetDefaults(manifest)
+	got, err := GenerateNetworkPolicyHash(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := GenerateNetworkPolicyHash(admitted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("hash of the defaulted manifest = %s, want %s", got, want)
+	}
+
+	udp := corev1.ProtocolUDP
+	explicit := &networkingv1.NetworkPolicy{Spec: networkingv1.NetworkPolicySpec{
+		PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+		Ingress:     []networkingv1.NetworkPolicyIngressRule{{Ports: []networkingv1.NetworkPolicyPort{{Protocol: &udp}}}},
+	}}
+	SetDefaults(explicit)
+	if len(explicit.Spec.PolicyTypes) != 1 || *explicit.Spec.Ingress[0].Ports[0].Protocol != udp {
+		t.Errorf("SetDefaults() overwrote explicit values: %+v", explicit.Spec)
+	}
+}
+
+func TestChangeSetID(t *testing.T) {
+	for changeID, want := range map[string]string{
+		"REL-1.4":                      "rel-1-4",
+		" release/2025-06 ":            "release-2025-06",
+		"--":                           "",
+		strings.Repeat("a", 70):        strings.Repeat("a", 63),
+		strings.Repeat("a", 62) + "_b": strings.Repeat("a", 62),
+	} {
+		if got := ChangeSetID(changeID); got != want {
+			t.Errorf("ChangeSetID(%q) = %q, want %q", changeID, got, want)
+		}
+	}
+}
+
+func TestChangeSetMembersRoundTrip(t *testing.T) {
+	members := map[string]string{"web": "abc", "db": "def"}
+	encoded := EncodeChangeSetMembers(members)
+	if encoded != "db=def,web=abc" {
+		t.Errorf("EncodeChangeSetMembers() = %q, want sorted entries", encoded)
+	}
+	decoded := ChangeSetMembers(map[string]string{AnnotationChangeSetMembers: encoded + ",broken,=x"})
+	if len(decoded) != 2 || decoded["web"] != "abc" || decoded["db"] != "def" {
+		t.Errorf("ChangeSetMembers() = %v, want %v", decoded, members)
+	}
+}
+
+func TestRecordVersionKeepsNewest(t *testing.T) {
+	data := map[string][]byte{}
+	for _, hash := range []string{"a", "b", "b", "c"} {
+		if err := RecordVersion(data, Version{Hash: hash}, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	versions, err := History(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].Hash != "b" || versions[1].Hash != "c" {
+		t.Errorf("History() = %+v, want b and c", versions)
+	}
+
+	if err := RestoreVersion(data, versions[0], time.Now(), 2); err != nil {
+		t.Fatal(err)
+	}
+	versions, _ = History(data)
+	if string(data[SecretKeyHash]) != "b" || len(versions) != 2 || versions[1].Hash != "b" || versions[1].RestoredAt == nil {
+		t.Errorf("RestoreVersion() left hash %s and history %+v", data[SecretKeyHash], versions)
+	}
+	if version, ok := FindVersion(versions, "c"); !ok || version.Hash != "c" {
+		t.Errorf("FindVersion() = %+v, %v", version, ok)
+	}
+}
+
+func TestApprovedBy(t *testing.T) {
+	for _, tc := range []struct {
+		annotations map[string]string
+		message     string
+		want        string
+	}{
+		{map[string]string{AnnotationApprovers: "alice,bob"}, "ok (by bob)", "alice,bob"},
+		{map[string]string{AnnotationAutoApprovedBy: "tighten-only"}, "", "auto-approval rule tighten-only"},
+		{map[string]string{}, "reviewed in TICKET-42 (by carol)", "carol"},
+		{map[string]string{}, "Approved by test", ""},
+	} {
+		if got := ApprovedBy(tc.annotations, tc.message); got != tc.want {
+			t.Errorf("ApprovedBy(%v, %q) = %q, want %q", tc.annotations, tc.message, got, tc.want)
+		}
+	}
+}
+
+func TestExpired(t *testing.T) {
+	now := time.Now()
+	certificate := func(notAfter time.Time) []byte {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: notAfter.Add(-time.Hour), NotAfter: notAfter}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+	secret := func(cert []byte, notAfter string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{AnnotationNotAfter: notAfter}},
+			Type:       SecretTypeNetworkPolicyApproval,
+			Data:       map[string][]byte{SecretKeyHash: []byte("abc"), SecretKeyCertificate: cert},
+		}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		secret *corev1.Secret
+		want   string
+	}{
+		{"valid", secret(certificate(now.Add(time.Hour)), ""), ""},
+		{"expired certificate", secret(certificate(now.Add(-time.Minute)), ""), "certificate expired at"},
+		{"window ended", secret(certificate(now.Add(time.Hour)), now.Add(-time.Minute).UTC().Format(time.RFC3339)), "approval window ended at"},
+		{"no certificate", secret(nil, ""), "approval has no valid certificate"},
+	} {
+		got := Expired(tc.secret, now)
+		if (tc.want == "" && got != "") || !strings.HasPrefix(got, tc.want) {
+			t.Errorf("%s: Expired() = %q, want prefix %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package approval
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+)
+
+// SignerName is the signer of approval CSRs
+const SignerName = "kubernetes.io/kube-apiserver-client"
+
+// NewCertificateRequest returns a PEM encoded certificate request for commonName with a fresh key.
+// The key is discarded, the issued certificate only serves as proof of the approval
+func NewCertificateRequest(commonName string) ([]byte, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate private key: %w", err)
+	}
+
+	template := &x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName:   commonName,
+			Organization: []string{"networkpolicy-approval"},
+		},
+		DNSNames: []string{commonName},
+	}
+	csrBytes, err := x509.CreateCertificateRequest(rand.Reader, template, privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate request: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrBytes}), nil
+}
@@ -0,0 +1,61 @@
+package approval
+
+import (
+	"encoding/json"
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// DiffSpecs returns a unified line diff between two NetworkPolicySpecs rendered as indented JSON.
+// A nil spec is rendered as an empty document, so DiffSpecs(nil, spec) shows the whole spec as added.
+func DiffSpecs(oldSpec, newSpec *networkingv1.NetworkPolicySpec) string {
+	return diffLines(renderSpec(oldSpec), renderSpec(newSpec))
+}
+
+func renderSpec(spec *networkingv1.NetworkPolicySpec) []string {
+	if spec == nil {
+		return nil
+	}
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return nil
+	}
+	return strings.Split(string(data), "\n")
+}
+
+// diffLines computes the longest common subsequence of both inputs and prints
+// removed lines with "-", added lines with "+" and unchanged lines with " "
+func diffLines(a, b []string) string {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			out.WriteString(" " + a[i] + "\n")
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			out.WriteString("+" + b[j] + "\n")
+			j++
+		default:
+			out.WriteString("-" + a[i] + "\n")
+			i++
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,126 @@
+package approval
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// AnnotationRollbackTo on a NetworkPolicy contains the hash, or its prefix, of a version in the approval
+	// history to roll back to. The controller applies that version and the webhook admits it without a new approval
+	AnnotationRollbackTo = "networkpolicy.webhook.io/rollback-to"
+	// AnnotationIncident on a NetworkPolicy contains the incident a rollback is made for, it is recorded with it
+	AnnotationIncident = "networkpolicy.webhook.io/incident"
+
+	// SecretKeyApprover is the approval Secret data key holding who approved it
+	SecretKeyApprover = "approver"
+	// SecretKeyHistory is the approval Secret data key holding the JSON encoded approved versions, oldest first
+	SecretKeyHistory = "history"
+)
+
+// Version is an approved version of a NetworkPolicy in the history of its approval Secret
+type Version struct {
+	Hash string `json:"hash"`
+	// Spec is the approved NetworkPolicySpec as encoded by EncodeSpec
+	Spec       string    `json:"spec,omitempty"`
+	Approver   string    `json:"approver,omitempty"`
+	ApprovedAt time.Time `json:"approvedAt"`
+	// Reason is the message the version was approved with
+	Reason  string `json:"reason,omitempty"`
+	CSRName string `json:"csrName,omitempty"`
+	// RestoredAt is set on versions that became current again by a rollback
+	RestoredAt *time.Time `json:"restoredAt,omitempty"`
+}
+
+// CurrentVersion returns the approval held by the data of an approval Secret as a version
+func CurrentVersion(data map[string][]byte) Version {
+	version := Version{
+		Hash:     string(data[SecretKeyHash]),
+		Spec:     string(data[SecretKeySpec]),
+		Approver: string(data[SecretKeyApprover]),
+		Reason:   string(data[SecretKeyApprovalMessage]),
+		CSRName:  string(data[SecretKeyCSRName]),
+	}
+	version.ApprovedAt, _ = time.Parse(time.RFC3339, string(data[SecretKeyApprovedAt]))
+	return version
+}
+
+// History returns the approved versions recorded in the data of an approval Secret, oldest first
+func History(data map[string][]byte) ([]Version, error) {
+	versions := []Version{}
+	if len(data[SecretKeyHistory]) == 0 {
+		return versions, nil
+	}
+	if err := json.Unmarshal(data[SecretKeyHistory], &versions); err != nil {
+		return nil, fmt.Errorf("failed to parse approval history: %w", err)
+	}
+	return versions, nil
+}
+
+// RecordVersion appends version to the history in data unless it is the newest version already, keeping the
+// newest limit versions
+func RecordVersion(data map[string][]byte, version Version, limit int) error {
+	versions, err := History(data)
+	if err != nil {
+		return err
+	}
+	if n := len(versions); n > 0 && versions[n-1].Hash == version.Hash && version.RestoredAt == nil {
+		return nil
+	}
+	versions = append(versions, version)
+	if limit > 0 && len(versions) > limit {
+		versions = versions[len(versions)-limit:]
+	}
+	encoded, err := json.Marshal(versions)
+	if err != nil {
+		return fmt.Errorf("failed to marshal approval history: %w", err)
+	}
+	data[SecretKeyHistory] = encoded
+	return nil
+}
+
+// FindVersion returns the newest version in the history whose hash starts with prefix
+func FindVersion(versions []Version, prefix string) (Version, bool) {
+	if prefix == "" {
+		return Version{}, false
+	}
+	for i := len(versions) - 1; i >= 0; i-- {
+		if strings.HasPrefix(versions[i].Hash, prefix) {
+			return versions[i], true
+		}
+	}
+	return Version{}, false
+}
+
+// RestoreVersion makes version the current approval in data and records the rollback in the history
+func RestoreVersion(data map[string][]byte, version Version, now time.Time, limit int) error {
+	data[SecretKeyHash] = []byte(version.Hash)
+	data[SecretKeySpec] = []byte(version.Spec)
+	data[SecretKeyCSRName] = []byte(version.CSRName)
+	data[SecretKeyApprovalMessage] = []byte(version.Reason)
+	data[SecretKeyApprover] = []byte(version.Approver)
+	delete(data, SecretKeyApprovedAt)
+	if !version.ApprovedAt.IsZero() {
+		data[SecretKeyApprovedAt] = []byte(version.ApprovedAt.UTC().Format(time.RFC3339))
+	}
+	restoredAt := now.UTC().Truncate(time.Second)
+	version.RestoredAt = &restoredAt
+	return RecordVersion(data, version, limit)
+}
+
+// ApprovedBy returns who approved a CSR: its recorded approvers, the auto-approval rule or the user named in
+// the condition message the way approvers decide, empty if it is unknown
+func ApprovedBy(annotations map[string]string, message string) string {
+	if approvers := Approvers(annotations); len(approvers) > 0 {
+		return strings.Join(approvers, ",")
+	}
+	if rule, ok := annotations[AnnotationAutoApprovedBy]; ok {
+		return "auto-approval rule " + rule
+	}
+	if start := strings.LastIndex(message, "(by "); start >= 0 && strings.HasSuffix(message, ")") {
+		return message[start+len("(by ") : len(message)-1]
+	}
+	return ""
+}
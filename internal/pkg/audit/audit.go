@@ -0,0 +1,93 @@
+// Package audit records an append-only, hash-chained trail of NetworkPolicy approval decisions.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Action is the kind of event an audit record describes
+type Action string
+
+const (
+	// ActionRequest is recorded when an approval request is filed
+	ActionRequest Action = "request"
+	// ActionApproval is recorded when an approval request is approved
+	ActionApproval Action = "approval"
+	// ActionDenial is recorded when an approval request is denied
+	ActionDenial Action = "denial"
+	// ActionRevocation is recorded when an approval is removed
+	ActionRevocation Action = "revocation"
+	// ActionAdmission is recorded for every decision of the validating webhook
+	ActionAdmission Action = "admission"
+	// ActionBreakGlass is recorded when a NetworkPolicy is admitted without approval during an incident
+	ActionBreakGlass Action = "break-glass"
+	// ActionBreakGlassExpired is recorded when a break-glass change is rolled back for lack of approval
+	ActionBreakGlassExpired Action = "break-glass-expired"
+	// ActionActivation is recorded when a scheduled approval takes effect and its NetworkPolicy is applied
+	ActionActivation Action = "activation"
+	// ActionRollback is recorded when a NetworkPolicy is rolled back to a version of its approval history
+	ActionRollback Action = "rollback"
+)
+
+// SeverityHigh marks records that need a follow-up, e.g. bypassed approvals
+const SeverityHigh = "high"
+
+// Record is a single entry of the audit trail
+type Record struct {
+	// Sequence numbers records consecutively starting at 1
+	Sequence uint64    `json:"sequence"`
+	Time     time.Time `json:"time"`
+	Action   Action    `json:"action"`
+	// Severity is set for records that need attention, e.g. SeverityHigh
+	Severity string `json:"severity,omitempty"`
+	// Namespace and Name identify the NetworkPolicy
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// CSRName is the approval request the record refers to, if any
+	CSRName   string `json:"csrName,omitempty"`
+	Requester string `json:"requester,omitempty"`
+	Approver  string `json:"approver,omitempty"`
+	// PolicyHash is the hash of the NetworkPolicy as computed by the webhook
+	PolicyHash string `json:"policyHash,omitempty"`
+	// Decision is the outcome of an admission, e.g. approved, pending or denied
+	Decision string `json:"decision,omitempty"`
+	// Incident is the incident reference a rollback was made for
+	Incident string `json:"incident,omitempty"`
+	Message  string `json:"message,omitempty"`
+	// Diff is the change against the previously approved spec
+	Diff string `json:"diff,omitempty"`
+	// PreviousHash is the RecordHash of the preceding record
+	PreviousHash string `json:"previousHash"`
+	// RecordHash covers every other field of the record, including PreviousHash
+	RecordHash string `json:"recordHash"`
+}
+
+// Sink persists audit records
+type Sink interface {
+	// Write appends the record to the trail. Sequence, PreviousHash and RecordHash are set by the sink.
+	Write(ctx context.Context, record Record) error
+}
+
+// NopSink discards every record
+type NopSink struct{}
+
+var _ Sink = NopSink{}
+
+// Write implements Sink
+func (NopSink) Write(context.Context, Record) error {
+	return nil
+}
+
+// computeHash returns the hash of the record with RecordHash left empty
+func computeHash(record Record) (string, error) {
+	record.RecordHash = ""
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal audit record: %w", err)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
@@ -0,0 +1,160 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileSink appends records as JSON lines to a file, chaining each record to its predecessor
+type FileSink struct {
+	mu           sync.Mutex
+	file         *os.File
+	sequence     uint64
+	previousHash string
+}
+
+var _ Sink = &FileSink{}
+
+// NewFileSink opens or creates the audit file at path and continues the chain found in it.
+// It fails if the existing trail does not verify, so a tampered file is never extended.
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file: %w", err)
+	}
+
+	last, err := Verify(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("refusing to extend audit file %s: %w", path, err)
+	}
+
+	sink := &FileSink{file: file}
+	if last != nil {
+		sink.sequence = last.Sequence
+		sink.previousHash = last.RecordHash
+	}
+	return sink, nil
+}
+
+// Write implements Sink
+func (s *FileSink) Write(_ context.Context, record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+	record.Time = record.Time.UTC()
+	record.Sequence = s.sequence + 1
+	record.PreviousHash = s.previousHash
+	hash, err := computeHash(record)
+	if err != nil {
+		return err
+	}
+	record.RecordHash = hash
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %w", err)
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync audit file: %w", err)
+	}
+
+	s.sequence = record.Sequence
+	s.previousHash = record.RecordHash
+	return nil
+}
+
+// Close closes the underlying file
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// Verify reads a JSON lines audit trail and checks that every record hash is correct, that each record
+// references the hash of its predecessor and that sequence numbers have no gaps.
+// It returns the last record, or nil for an empty trail.
+func Verify(r io.Reader) (*Record, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	var last *Record
+	line := 0
+	for scanner.Scan() {
+		line++
+		record := Record{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("line %d: malformed record: %w", line, err)
+		}
+
+		expectedSequence, expectedPrevious := uint64(1), ""
+		if last != nil {
+			expectedSequence, expectedPrevious = last.Sequence+1, last.RecordHash
+		}
+		if record.Sequence != expectedSequence {
+			return nil, fmt.Errorf("line %d: expected sequence %d but found %d", line, expectedSequence, record.Sequence)
+		}
+		if record.PreviousHash != expectedPrevious {
+			return nil, fmt.Errorf("line %d: record is not chained to its predecessor", line)
+		}
+		hash, err := computeHash(record)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if hash != record.RecordHash {
+			return nil, fmt.Errorf("line %d: record hash mismatch, the record was modified", line)
+		}
+		last = &record
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to read audit trail: %w", err)
+	}
+	return last, nil
+}
+
+// ReadFile returns the last limit records of the JSON lines trail at path that match, oldest first.
+// Every matching record is returned if limit is zero, and none if the file does not exist yet.
+func ReadFile(path string, match func(Record) bool, limit int) ([]Record, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	var records []Record
+	for scanner.Scan() {
+		record := Record{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("malformed audit record: %w", err)
+		}
+		if !match(record) {
+			continue
+		}
+		records = append(records, record)
+		if limit > 0 && len(records) > limit {
+			records = records[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit trail: %w", err)
+	}
+	return records, nil
+}
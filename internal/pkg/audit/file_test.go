@@ -0,0 +1,108 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeRecords(t *testing.T, path string, records ...Record) {
+	t.Helper()
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatalf("Failed to open sink: %v", err)
+	}
+	defer sink.Close()
+	for _, record := range records {
+		if err := sink.Write(context.Background(), record); err != nil {
+			t.Fatalf("Failed to write record: %v", err)
+		}
+	}
+}
+
+func TestFileSinkChainsRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	writeRecords(t, path,
+		Record{Action: ActionRequest, Namespace: "default", Name: "allow-dns", Requester: "alice"},
+		Record{Action: ActionApproval, Namespace: "default", Name: "allow-dns", Approver: "bob"},
+	)
+	// Reopening the file must continue the existing chain
+	writeRecords(t, path, Record{Action: ActionAdmission, Namespace: "default", Name: "allow-dns", Decision: "approved"})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read audit file: %v", err)
+	}
+	last, err := Verify(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Untampered trail did not verify: %v", err)
+	}
+	if last.Sequence != 3 {
+		t.Errorf("Expected 3 records but the last sequence is %d", last.Sequence)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	writeRecords(t, path,
+		Record{Action: ActionRequest, Namespace: "default", Name: "allow-dns", Requester: "alice"},
+		Record{Action: ActionDenial, Namespace: "default", Name: "allow-dns", Approver: "bob"},
+		Record{Action: ActionRequest, Namespace: "default", Name: "allow-dns", Requester: "alice"},
+	)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read audit file: %v", err)
+	}
+	lines := strings.SplitAfter(strings.TrimSuffix(string(data), "\n"), "\n")
+
+	tests := map[string]string{
+		"modified record": strings.Replace(string(data), `"action":"denial"`, `"action":"approval"`, 1),
+		"removed record":  lines[0] + lines[2],
+		"reordered":       lines[1] + lines[0] + lines[2],
+		"truncated chain": lines[1] + lines[2],
+	}
+	for name, tampered := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Verify(strings.NewReader(tampered)); err == nil {
+				t.Error("Tampered trail verified successfully")
+			}
+		})
+	}
+
+	// A tampered trail must never be extended
+	if err := os.WriteFile(path, []byte(tests["modified record"]), 0o600); err != nil {
+		t.Fatalf("Failed to write tampered file: %v", err)
+	}
+	if _, err := NewFileSink(path); err == nil {
+		t.Error("Opened a sink on a tampered trail")
+	}
+}
+
+func TestReadFileReturnsTheLastMatchingRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	writeRecords(t, path,
+		Record{Action: ActionRequest, Namespace: "default", Name: "allow-dns", Requester: "alice"},
+		Record{Action: ActionRequest, Namespace: "shop", Name: "web", Requester: "carol"},
+		Record{Action: ActionApproval, Namespace: "default", Name: "allow-dns", Approver: "bob"},
+		Record{Action: ActionAdmission, Namespace: "default", Name: "allow-dns", Decision: "approved"},
+	)
+	match := func(record Record) bool { return record.Namespace == "default" && record.Name == "allow-dns" }
+
+	records, err := ReadFile(path, match, 2)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if len(records) != 2 || records[0].Action != ActionApproval || records[1].Action != ActionAdmission {
+		t.Errorf("Unexpected records %+v", records)
+	}
+	if records, _ := ReadFile(path, match, 0); len(records) != 3 {
+		t.Errorf("Expected 3 records without limit but got %d", len(records))
+	}
+	if records, err := ReadFile(filepath.Join(t.TempDir(), "missing.jsonl"), match, 0); err != nil || records != nil {
+		t.Errorf("Expected no records for a missing file but got %v, %v", records, err)
+	}
+}
@@ -0,0 +1,57 @@
+// Package authz decides who may approve NetworkPolicy requests. Approving is delegated through
+// RBAC: a user needs the approve verb on networkpolicyapprovals in the namespace of the request.
+package authz
+
+import (
+	"context"
+	"fmt"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Group is the API group of the approval verb
+	Group = "approval.hadiazad.local"
+	// Resource is the virtual resource approvers are granted the approval verb on
+	Resource = "networkpolicyapprovals"
+	// VerbApprove allows approving and denying requests
+	VerbApprove = "approve"
+)
+
+// Authorizer checks the approval verb with SubjectAccessReviews
+type Authorizer struct {
+	Client client.Client
+}
+
+// NewAuthorizer returns an Authorizer creating SubjectAccessReviews with c
+func NewAuthorizer(c client.Client) *Authorizer {
+	return &Authorizer{Client: c}
+}
+
+// CanApprove reports whether the user may approve requests in namespace, and the reason of the authorizer
+func (a *Authorizer) CanApprove(ctx context.Context, user authenticationv1.UserInfo, namespace string) (bool, string, error) {
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for key, value := range user.Extra {
+		extra[key] = authorizationv1.ExtraValue(value)
+	}
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			Groups: user.Groups,
+			UID:    user.UID,
+			Extra:  extra,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      VerbApprove,
+				Group:     Group,
+				Resource:  Resource,
+			},
+		},
+	}
+	if err := a.Client.Create(ctx, review); err != nil {
+		return false, "", fmt.Errorf("failed to create SubjectAccessReview: %w", err)
+	}
+	return review.Status.Allowed, review.Status.Reason, nil
+}
@@ -0,0 +1,137 @@
+// Package autoapprove decides whether a requested NetworkPolicy change is low risk enough
+// to be approved without a human, based on rules from the operator configuration.
+package autoapprove
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/hadi2f244/approve-controller/internal/pkg/analyzer"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Shape is a property of the requested change that a rule can require
+type Shape string
+
+const (
+	// ShapeRemovesPeersOnly matches changes that only remove peers or rules from the approved version
+	ShapeRemovesPeersOnly Shape = "removesPeersOnly"
+	// ShapeIngressSameNamespaceOnly matches policies that only allow ingress from pods of their own namespace
+	ShapeIngressSameNamespaceOnly Shape = "ingressSameNamespaceOnly"
+)
+
+// Rule approves a change when every one of its non-empty matchers matches
+type Rule struct {
+	// Name identifies the rule in the approval record
+	Name string `mapstructure:"name"`
+	// Namespaces the NetworkPolicy must be in, any namespace if empty
+	Namespaces []string `mapstructure:"namespaces"`
+	// MatchLabels the NetworkPolicy must carry
+	MatchLabels map[string]string `mapstructure:"matchLabels"`
+	// RequesterGroups of which the requester must be in at least one, any requester if empty
+	RequesterGroups []string `mapstructure:"requesterGroups"`
+	// Shapes the change must all have
+	Shapes []Shape `mapstructure:"shapes"`
+	// MaxRiskScore is the highest risk score of the change the rule approves, any score if unset
+	MaxRiskScore *int `mapstructure:"maxRiskScore"`
+}
+
+// Validate checks that the rule is named and only uses known shapes
+func (r Rule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("auto-approval rule has no name")
+	}
+	for _, shape := range r.Shapes {
+		switch shape {
+		case ShapeRemovesPeersOnly, ShapeIngressSameNamespaceOnly:
+		default:
+			return fmt.Errorf("auto-approval rule %s: unknown shape %q, expected %s or %s",
+				r.Name, shape, ShapeRemovesPeersOnly, ShapeIngressSameNamespaceOnly)
+		}
+	}
+	if len(r.Namespaces) == 0 && len(r.MatchLabels) == 0 && len(r.RequesterGroups) == 0 && len(r.Shapes) == 0 && r.MaxRiskScore == nil {
+		return fmt.Errorf("auto-approval rule %s matches every change, add at least one matcher", r.Name)
+	}
+	return nil
+}
+
+// Request is a change to be evaluated
+type Request struct {
+	// Policy is the requested NetworkPolicy
+	Policy *networkingv1.NetworkPolicy
+	// ApprovedSpec is the currently approved spec, nil if the policy was never approved
+	ApprovedSpec *networkingv1.NetworkPolicySpec
+	// UserInfo is the requester
+	UserInfo authenticationv1.UserInfo
+	// Risk is the analysis of the change
+	Risk analyzer.Report
+}
+
+// Engine evaluates a set of rules, the rules can be replaced while the engine is in use
+type Engine struct {
+	mu    sync.RWMutex
+	rules []Rule
+}
+
+// NewEngine returns an Engine for the given rules
+func NewEngine(rules []Rule) *Engine {
+	return &Engine{rules: rules}
+}
+
+// SetRules replaces the rules, e.g. after the configuration was reloaded
+func (e *Engine) SetRules(rules []Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules = rules
+}
+
+// Evaluate returns the name of the first rule that approves the request, false if none does
+func (e *Engine) Evaluate(req Request) (string, bool) {
+	if e == nil {
+		return "", false
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, rule := range e.rules {
+		if rule.matches(req) {
+			return rule.Name, true
+		}
+	}
+	return "", false
+}
+
+func (r Rule) matches(req Request) bool {
+	if len(r.Namespaces) > 0 && !slices.Contains(r.Namespaces, req.Policy.Namespace) {
+		return false
+	}
+	if len(r.MatchLabels) > 0 && !labels.SelectorFromSet(r.MatchLabels).Matches(labels.Set(req.Policy.Labels)) {
+		return false
+	}
+	if len(r.RequesterGroups) > 0 && !slices.ContainsFunc(r.RequesterGroups, func(group string) bool {
+		return slices.Contains(req.UserInfo.Groups, group)
+	}) {
+		return false
+	}
+	if r.MaxRiskScore != nil && req.Risk.Score > *r.MaxRiskScore {
+		return false
+	}
+	for _, shape := range r.Shapes {
+		if !hasShape(shape, req) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasShape(shape Shape, req Request) bool {
+	switch shape {
+	case ShapeRemovesPeersOnly:
+		return req.ApprovedSpec != nil && RemovesPeersOnly(req.ApprovedSpec, &req.Policy.Spec)
+	case ShapeIngressSameNamespaceOnly:
+		return IngressSameNamespaceOnly(&req.Policy.Spec)
+	}
+	return false
+}
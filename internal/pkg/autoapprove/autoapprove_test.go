@@ -0,0 +1,129 @@
+package autoapprove
+
+import (
+	"testing"
+
+	"github.com/hadi2f244/approve-controller/internal/pkg/analyzer"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func podPeer(app string) networkingv1.NetworkPolicyPeer {
+	return networkingv1.NetworkPolicyPeer{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": app}}}
+}
+
+func ingressSpec(peers ...networkingv1.NetworkPolicyPeer) *networkingv1.NetworkPolicySpec {
+	return &networkingv1.NetworkPolicySpec{
+		Ingress: []networkingv1.NetworkPolicyIngressRule{{From: peers}},
+	}
+}
+
+func TestRemovesPeersOnly(t *testing.T) {
+	approved := ingressSpec(podPeer("frontend"), podPeer("monitoring"))
+
+	tests := map[string]struct {
+		spec *networkingv1.NetworkPolicySpec
+		want bool
+	}{
+		"unchanged":         {spec: ingressSpec(podPeer("frontend"), podPeer("monitoring")), want: true},
+		"removed peer":      {spec: ingressSpec(podPeer("frontend")), want: true},
+		"removed all rules": {spec: &networkingv1.NetworkPolicySpec{}, want: true},
+		"added peer":        {spec: ingressSpec(podPeer("frontend"), podPeer("backend")), want: false},
+		"removed all peers": {spec: ingressSpec(), want: false},
+		"changed policy types": {spec: &networkingv1.NetworkPolicySpec{
+			Ingress:     approved.Ingress,
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+		}, want: false},
+		"changed pod selector": {spec: &networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+			Ingress:     approved.Ingress,
+		}, want: false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := RemovesPeersOnly(approved, tt.spec); got != tt.want {
+				t.Errorf("RemovesPeersOnly() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIngressSameNamespaceOnly(t *testing.T) {
+	tests := map[string]struct {
+		spec *networkingv1.NetworkPolicySpec
+		want bool
+	}{
+		"pod selector": {spec: ingressSpec(podPeer("frontend")), want: true},
+		"deny all":     {spec: &networkingv1.NetworkPolicySpec{}, want: true},
+		"allow all":    {spec: ingressSpec(), want: false},
+		"other ns":     {spec: ingressSpec(networkingv1.NetworkPolicyPeer{NamespaceSelector: &metav1.LabelSelector{}}), want: false},
+		"ip block":     {spec: ingressSpec(networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/8"}}), want: false},
+		"egress isolated": {spec: &networkingv1.NetworkPolicySpec{
+			Ingress: ingressSpec(podPeer("frontend")).Ingress,
+			Egress:  []networkingv1.NetworkPolicyEgressRule{{}},
+		}, want: false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := IngressSameNamespaceOnly(tt.spec); got != tt.want {
+				t.Errorf("IngressSameNamespaceOnly() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEngineEvaluate(t *testing.T) {
+	engine := NewEngine([]Rule{
+		{Name: "platform-team", RequesterGroups: []string{"platform"}, Namespaces: []string{"team-a"}},
+		{Name: "tighten", Shapes: []Shape{ShapeRemovesPeersOnly}, MatchLabels: map[string]string{"tier": "web"}},
+	})
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "allow-web", Namespace: "team-a", Labels: map[string]string{"tier": "web"}},
+		Spec:       *ingressSpec(podPeer("frontend")),
+	}
+	approved := ingressSpec(podPeer("frontend"), podPeer("monitoring"))
+
+	tests := map[string]struct {
+		req  Request
+		want string
+	}{
+		"requester group": {req: Request{Policy: policy, UserInfo: authenticationv1.UserInfo{Groups: []string{"platform"}}}, want: "platform-team"},
+		"shape":           {req: Request{Policy: policy, ApprovedSpec: approved}, want: "tighten"},
+		"no approval":     {req: Request{Policy: policy}, want: ""},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, ok := engine.Evaluate(tt.req)
+			if got != tt.want || ok != (tt.want != "") {
+				t.Errorf("Evaluate() = %q, %v, want %q", got, ok, tt.want)
+			}
+		})
+	}
+
+	maxRiskScore := 0
+	engine.SetRules([]Rule{{Name: "harmless", MaxRiskScore: &maxRiskScore}})
+	if _, ok := engine.Evaluate(Request{Policy: policy, Risk: analyzer.Report{Score: 20}}); ok {
+		t.Error("Evaluate() approved a change above the maximum risk score")
+	}
+	if _, ok := engine.Evaluate(Request{Policy: policy}); !ok {
+		t.Error("Evaluate() did not approve a change without risk")
+	}
+
+	engine.SetRules(nil)
+	if _, ok := engine.Evaluate(tests["requester group"].req); ok {
+		t.Error("Evaluate() approved after the rules were removed")
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	if err := (Rule{Name: "bad", Shapes: []Shape{"widens"}}).Validate(); err == nil {
+		t.Error("Validate() accepted an unknown shape")
+	}
+	if err := (Rule{Name: "everything"}).Validate(); err == nil {
+		t.Error("Validate() accepted a rule without matchers")
+	}
+	if err := (Rule{Shapes: []Shape{ShapeRemovesPeersOnly}}).Validate(); err == nil {
+		t.Error("Validate() accepted a rule without name")
+	}
+}
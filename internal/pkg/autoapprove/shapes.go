@@ -0,0 +1,91 @@
+package autoapprove
+
+import (
+	"slices"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// RemovesPeersOnly reports whether newSpec can be obtained from oldSpec by removing rules or peers,
+// i.e. it selects the same pods, isolates the same directions and allows a subset of the traffic
+func RemovesPeersOnly(oldSpec, newSpec *networkingv1.NetworkPolicySpec) bool {
+	if !equality.Semantic.DeepEqual(oldSpec.PodSelector, newSpec.PodSelector) {
+		return false
+	}
+	if !slices.Equal(EffectivePolicyTypes(oldSpec), EffectivePolicyTypes(newSpec)) {
+		return false
+	}
+	for _, rule := range newSpec.Ingress {
+		if !slices.ContainsFunc(oldSpec.Ingress, func(old networkingv1.NetworkPolicyIngressRule) bool {
+			return equality.Semantic.DeepEqual(old.Ports, rule.Ports) && peersSubset(rule.From, old.From)
+		}) {
+			return false
+		}
+	}
+	for _, rule := range newSpec.Egress {
+		if !slices.ContainsFunc(oldSpec.Egress, func(old networkingv1.NetworkPolicyEgressRule) bool {
+			return equality.Semantic.DeepEqual(old.Ports, rule.Ports) && peersSubset(rule.To, old.To)
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+// IngressSameNamespaceOnly reports whether the policy only allows ingress from pods selected by a
+// podSelector, which always refers to the policy's own namespace, and does not isolate egress
+func IngressSameNamespaceOnly(spec *networkingv1.NetworkPolicySpec) bool {
+	if slices.Contains(EffectivePolicyTypes(spec), networkingv1.PolicyTypeEgress) {
+		return false
+	}
+	for _, rule := range spec.Ingress {
+		// An empty from allows all sources
+		if len(rule.From) == 0 {
+			return false
+		}
+		for _, peer := range rule.From {
+			if peer.PodSelector == nil || peer.NamespaceSelector != nil || peer.IPBlock != nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// EffectivePolicyTypes returns the directions the policy isolates, applying the API defaults when
+// policyTypes is not set: ingress always, egress only if there are egress rules
+func EffectivePolicyTypes(spec *networkingv1.NetworkPolicySpec) []networkingv1.PolicyType {
+	types := []networkingv1.PolicyType{}
+	if len(spec.PolicyTypes) == 0 {
+		types = append(types, networkingv1.PolicyTypeIngress)
+		if len(spec.Egress) > 0 {
+			types = append(types, networkingv1.PolicyTypeEgress)
+		}
+		return types
+	}
+	for _, policyType := range []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress} {
+		if slices.Contains(spec.PolicyTypes, policyType) {
+			types = append(types, policyType)
+		}
+	}
+	return types
+}
+
+// peersSubset reports whether the peers of a rule allow a subset of the old peers, an empty list allows all
+func peersSubset(peers, oldPeers []networkingv1.NetworkPolicyPeer) bool {
+	if len(oldPeers) == 0 {
+		return true
+	}
+	if len(peers) == 0 {
+		return false
+	}
+	for _, peer := range peers {
+		if !slices.ContainsFunc(oldPeers, func(old networkingv1.NetworkPolicyPeer) bool {
+			return equality.Semantic.DeepEqual(old, peer)
+		}) {
+			return false
+		}
+	}
+	return true
+}
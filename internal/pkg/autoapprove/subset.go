@@ -0,0 +1,239 @@
+package autoapprove
+
+import (
+	"net/netip"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// RuleTightening names the built-in rule that approves changes admitting a subset of the approved traffic
+const RuleTightening = "tightening-only"
+
+// Narrows reports whether newSpec admits a subset of the traffic oldSpec admits.
+// It is conservative: false means the change could not be proven to only tighten the policy.
+//
+// Both specs must select the same pods, newSpec must isolate at least the directions oldSpec isolates
+// and every rule of newSpec must be covered by a rule of oldSpec, with a subset of its ports and peers.
+func Narrows(oldSpec, newSpec *networkingv1.NetworkPolicySpec) bool {
+	// Pods that are no longer selected would lose their isolation
+	if !equality.Semantic.DeepEqual(oldSpec.PodSelector, newSpec.PodSelector) {
+		return false
+	}
+	oldTypes, newTypes := EffectivePolicyTypes(oldSpec), EffectivePolicyTypes(newSpec)
+	for _, policyType := range oldTypes {
+		if !slices.Contains(newTypes, policyType) {
+			return false
+		}
+	}
+
+	// A direction that was not isolated allowed everything, any rules narrow it
+	if slices.Contains(oldTypes, networkingv1.PolicyTypeIngress) {
+		for _, rule := range newSpec.Ingress {
+			if !slices.ContainsFunc(oldSpec.Ingress, func(old networkingv1.NetworkPolicyIngressRule) bool {
+				return portsSubset(rule.Ports, old.Ports) && peersCovered(rule.From, old.From)
+			}) {
+				return false
+			}
+		}
+	}
+	if slices.Contains(oldTypes, networkingv1.PolicyTypeEgress) {
+		for _, rule := range newSpec.Egress {
+			if !slices.ContainsFunc(oldSpec.Egress, func(old networkingv1.NetworkPolicyEgressRule) bool {
+				return portsSubset(rule.Ports, old.Ports) && peersCovered(rule.To, old.To)
+			}) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// portsSubset reports whether every port is contained in one of oldPorts, an empty list allows all ports
+func portsSubset(ports, oldPorts []networkingv1.NetworkPolicyPort) bool {
+	if len(oldPorts) == 0 {
+		return true
+	}
+	if len(ports) == 0 {
+		return false
+	}
+	for _, port := range ports {
+		if !slices.ContainsFunc(oldPorts, func(old networkingv1.NetworkPolicyPort) bool { return portContained(port, old) }) {
+			return false
+		}
+	}
+	return true
+}
+
+func portContained(port, old networkingv1.NetworkPolicyPort) bool {
+	if protocol(port) != protocol(old) {
+		return false
+	}
+	// A missing port means every port of the protocol
+	if old.Port == nil {
+		return true
+	}
+	if port.Port == nil {
+		return false
+	}
+	if port.Port.IntValue() == 0 || old.Port.IntValue() == 0 {
+		// Named ports only match themselves
+		return port.Port.String() == old.Port.String() && port.EndPort == nil && old.EndPort == nil
+	}
+	first, last := portRange(port)
+	oldFirst, oldLast := portRange(old)
+	return first >= oldFirst && last <= oldLast
+}
+
+func protocol(port networkingv1.NetworkPolicyPort) corev1.Protocol {
+	if port.Protocol == nil {
+		return corev1.ProtocolTCP
+	}
+	return *port.Protocol
+}
+
+func portRange(port networkingv1.NetworkPolicyPort) (int32, int32) {
+	first := int32(port.Port.IntValue())
+	if port.EndPort == nil {
+		return first, first
+	}
+	return first, *port.EndPort
+}
+
+// peersCovered reports whether every peer is contained in one of oldPeers, an empty list allows all peers
+func peersCovered(peers, oldPeers []networkingv1.NetworkPolicyPeer) bool {
+	if len(oldPeers) == 0 {
+		return true
+	}
+	if len(peers) == 0 {
+		return false
+	}
+	for _, peer := range peers {
+		if !slices.ContainsFunc(oldPeers, func(old networkingv1.NetworkPolicyPeer) bool { return peerContained(peer, old) }) {
+			return false
+		}
+	}
+	return true
+}
+
+func peerContained(peer, old networkingv1.NetworkPolicyPeer) bool {
+	if peer.IPBlock != nil || old.IPBlock != nil {
+		return peer.IPBlock != nil && old.IPBlock != nil && ipBlockContained(peer.IPBlock, old.IPBlock)
+	}
+
+	// Without a namespaceSelector the peer is limited to the policy's own namespace
+	switch {
+	case old.NamespaceSelector == nil && peer.NamespaceSelector != nil:
+		return false
+	case old.NamespaceSelector != nil && peer.NamespaceSelector == nil:
+		if !selectsEverything(old.NamespaceSelector) {
+			return false
+		}
+	case old.NamespaceSelector != nil && !selectorContained(peer.NamespaceSelector, old.NamespaceSelector):
+		return false
+	}
+
+	// Without a podSelector the peer is every pod of the selected namespaces
+	if old.PodSelector == nil {
+		return true
+	}
+	if peer.PodSelector == nil {
+		return selectsEverything(old.PodSelector)
+	}
+	return selectorContained(peer.PodSelector, old.PodSelector)
+}
+
+// ipBlockContained reports whether the addresses of block are a subset of the addresses of old
+func ipBlockContained(block, old *networkingv1.IPBlock) bool {
+	prefix, err := netip.ParsePrefix(block.CIDR)
+	if err != nil {
+		return false
+	}
+	oldPrefix, err := netip.ParsePrefix(old.CIDR)
+	if err != nil || !prefixContains(oldPrefix, prefix) {
+		return false
+	}
+	// Addresses excluded from the old block must also be excluded from the new one
+	for _, except := range old.Except {
+		exceptPrefix, err := netip.ParsePrefix(except)
+		if err != nil {
+			return false
+		}
+		if exceptPrefix.Overlaps(prefix) && !slices.ContainsFunc(block.Except, func(newExcept string) bool {
+			newExceptPrefix, err := netip.ParsePrefix(newExcept)
+			return err == nil && prefixContains(newExceptPrefix, exceptPrefix)
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+func prefixContains(outer, inner netip.Prefix) bool {
+	outer, inner = outer.Masked(), inner.Masked()
+	return outer.Addr().Is4() == inner.Addr().Is4() && outer.Bits() <= inner.Bits() && outer.Contains(inner.Addr())
+}
+
+func selectsEverything(selector *metav1.LabelSelector) bool {
+	return len(selector.MatchLabels) == 0 && len(selector.MatchExpressions) == 0
+}
+
+// selectorContained reports whether everything selector matches is matched by old,
+// by checking that each requirement of old is implied by the requirements of selector
+func selectorContained(selector, old *metav1.LabelSelector) bool {
+	parsed, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false
+	}
+	oldParsed, err := metav1.LabelSelectorAsSelector(old)
+	if err != nil {
+		return false
+	}
+	requirements, _ := parsed.Requirements()
+	oldRequirements, _ := oldParsed.Requirements()
+	for _, oldRequirement := range oldRequirements {
+		if !slices.ContainsFunc(requirements, func(requirement labels.Requirement) bool {
+			return implies(requirement, oldRequirement)
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+// implies reports whether every label set matching requirement also matches old
+func implies(requirement, old labels.Requirement) bool {
+	if requirement.Key() != old.Key() {
+		return false
+	}
+	values, oldValues := requirement.Values(), old.Values()
+	switch old.Operator() {
+	case selection.In, selection.Equals, selection.DoubleEquals:
+		switch requirement.Operator() {
+		case selection.In, selection.Equals, selection.DoubleEquals:
+			return oldValues.IsSuperset(values)
+		}
+	case selection.Exists:
+		switch requirement.Operator() {
+		case selection.In, selection.Equals, selection.DoubleEquals, selection.Exists:
+			return true
+		}
+	case selection.NotIn, selection.NotEquals:
+		switch requirement.Operator() {
+		case selection.In, selection.Equals, selection.DoubleEquals:
+			return !values.HasAny(oldValues.UnsortedList()...)
+		case selection.NotIn, selection.NotEquals:
+			return values.IsSuperset(oldValues)
+		case selection.DoesNotExist:
+			return true
+		}
+	case selection.DoesNotExist:
+		return requirement.Operator() == selection.DoesNotExist
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package autoapprove
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestNarrows(t *testing.T) {
+	port := func(number int32) networkingv1.NetworkPolicyPort {
+		value := intstr.FromInt32(number)
+		return networkingv1.NetworkPolicyPort{Port: &value}
+	}
+	portRange := func(first, last int32) networkingv1.NetworkPolicyPort {
+		p := port(first)
+		p.EndPort = &last
+		return p
+	}
+	udp := corev1.ProtocolUDP
+	ingress := func(ports []networkingv1.NetworkPolicyPort, peers ...networkingv1.NetworkPolicyPeer) *networkingv1.NetworkPolicySpec {
+		return &networkingv1.NetworkPolicySpec{Ingress: []networkingv1.NetworkPolicyIngressRule{{Ports: ports, From: peers}}}
+	}
+	ipBlock := func(cidr string, except ...string) networkingv1.NetworkPolicyPeer {
+		return networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: cidr, Except: except}}
+	}
+	namespaces := func(expressions ...metav1.LabelSelectorRequirement) networkingv1.NetworkPolicyPeer {
+		return networkingv1.NetworkPolicyPeer{NamespaceSelector: &metav1.LabelSelector{MatchExpressions: expressions}}
+	}
+	inTeams := func(teams ...string) metav1.LabelSelectorRequirement {
+		return metav1.LabelSelectorRequirement{Key: "team", Operator: metav1.LabelSelectorOpIn, Values: teams}
+	}
+
+	approved := ingress([]networkingv1.NetworkPolicyPort{portRange(8000, 8100), port(53)},
+		podPeer("frontend"), ipBlock("10.0.0.0/8", "10.1.0.0/16"), namespaces(inTeams("a", "b")))
+
+	tests := map[string]struct {
+		spec *networkingv1.NetworkPolicySpec
+		want bool
+	}{
+		"unchanged":                {spec: approved, want: true},
+		"port removed":             {spec: ingress([]networkingv1.NetworkPolicyPort{port(53)}, podPeer("frontend")), want: true},
+		"port range narrowed":      {spec: ingress([]networkingv1.NetworkPolicyPort{portRange(8010, 8020)}, podPeer("frontend")), want: true},
+		"port range widened":       {spec: ingress([]networkingv1.NetworkPolicyPort{portRange(7000, 8020)}, podPeer("frontend")), want: false},
+		"protocol changed":         {spec: ingress([]networkingv1.NetworkPolicyPort{{Protocol: &udp, Port: port(53).Port}}, podPeer("frontend")), want: false},
+		"all ports":                {spec: ingress(nil, podPeer("frontend")), want: false},
+		"all peers":                {spec: ingress([]networkingv1.NetworkPolicyPort{port(53)}), want: false},
+		"smaller ipBlock":          {spec: ingress([]networkingv1.NetworkPolicyPort{port(53)}, ipBlock("10.2.0.0/16")), want: true},
+		"ipBlock keeps the except": {spec: ingress([]networkingv1.NetworkPolicyPort{port(53)}, ipBlock("10.0.0.0/9", "10.1.0.0/16")), want: true},
+		"ipBlock drops the except": {spec: ingress([]networkingv1.NetworkPolicyPort{port(53)}, ipBlock("10.0.0.0/9")), want: false},
+		"larger ipBlock":           {spec: ingress([]networkingv1.NetworkPolicyPort{port(53)}, ipBlock("0.0.0.0/0")), want: false},
+		"fewer namespaces":         {spec: ingress([]networkingv1.NetworkPolicyPort{port(53)}, namespaces(inTeams("a"))), want: true},
+		"other namespaces":         {spec: ingress([]networkingv1.NetworkPolicyPort{port(53)}, namespaces(inTeams("c"))), want: false},
+		"all namespaces":           {spec: ingress([]networkingv1.NetworkPolicyPort{port(53)}, namespaces()), want: false},
+		"pods of a namespace": {spec: ingress([]networkingv1.NetworkPolicyPort{port(53)}, networkingv1.NetworkPolicyPeer{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "b"}},
+			PodSelector:       &metav1.LabelSelector{MatchLabels: map[string]string{"app": "api"}},
+		}), want: true},
+		"frontend of other namespaces": {spec: ingress([]networkingv1.NetworkPolicyPort{port(53)}, networkingv1.NetworkPolicyPeer{
+			NamespaceSelector: &metav1.LabelSelector{},
+			PodSelector:       podPeer("frontend").PodSelector,
+		}), want: false},
+		"egress isolation added": {spec: &networkingv1.NetworkPolicySpec{
+			Ingress:     approved.Ingress,
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+		}, want: true},
+		"ingress isolation removed": {spec: &networkingv1.NetworkPolicySpec{
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+		}, want: false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := Narrows(approved, tt.spec); got != tt.want {
+				t.Errorf("Narrows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+// Package backup exports the approvals of a cluster to a signed, versioned archive and imports them again, to
+// restore them after the cluster was rebuilt or to migrate them to another cluster. The archive holds the
+// approval Secrets, requests (CSRs) are not part of it since they are garbage collected anyway. Importing
+// re-validates every approved hash against the stored spec, so an archive cannot approve other policies than
+// the ones that were reviewed.
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hadi2f244/approve-controller/internal/pkg/approval"
+	"github.com/hadi2f244/approve-controller/internal/pkg/signature"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// APIVersion is the version of the archive format, archives of other versions are rejected
+	APIVersion = "networkpolicy.webhook.io/v1"
+	// Kind identifies approval archives among other manifests
+	Kind = "ApprovalArchive"
+)
+
+// Archive is an export of the approvals of a cluster
+type Archive struct {
+	APIVersion string    `json:"apiVersion"`
+	Kind       string    `json:"kind"`
+	ExportedAt time.Time `json:"exportedAt"`
+	// Approvals are sorted by namespace and name
+	Approvals []Approval `json:"approvals"`
+	// Signature is the base64 signature over the Digest of the archive, empty if it is not signed
+	Signature string `json:"signature,omitempty"`
+}
+
+// Approval is the approval Secret of a NetworkPolicy
+type Approval struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Annotations are the networkpolicy.webhook.io annotations of the Secret
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Data is the data of the Secret, approval Secrets only hold text
+	Data map[string]string `json:"data"`
+}
+
+// Export returns an unsigned archive of the approvals in namespace, of every namespace if it is empty
+func Export(ctx context.Context, c client.Reader, namespace string, now time.Time) (*Archive, error) {
+	secretList := &corev1.SecretList{}
+	if err := c.List(ctx, secretList, client.InNamespace(namespace), client.HasLabels{approval.LabelNetworkPolicyApproval}); err != nil {
+		return nil, fmt.Errorf("failed to list approvals: %w", err)
+	}
+	archive := &Archive{APIVersion: APIVersion, Kind: Kind, ExportedAt: now.UTC().Truncate(time.Second), Approvals: []Approval{}}
+	for i := range secretList.Items {
+		secret := &secretList.Items[i]
+		if secret.Type != approval.SecretTypeNetworkPolicyApproval {
+			continue
+		}
+		archive.Approvals = append(archive.Approvals, fromSecret(secret))
+	}
+	sort.Slice(archive.Approvals, func(i, j int) bool {
+		a, b := archive.Approvals[i], archive.Approvals[j]
+		return a.Namespace < b.Namespace || (a.Namespace == b.Namespace && a.Name < b.Name)
+	})
+	return archive, nil
+}
+
+func fromSecret(secret *corev1.Secret) Approval {
+	name := secret.Annotations[approval.AnnotationNPName]
+	if name == "" {
+		name = secret.Labels[approval.LabelNetworkPolicyName]
+	}
+	a := Approval{Namespace: secret.Namespace, Name: name, Annotations: map[string]string{}, Data: map[string]string{}}
+	for key, value := range secret.Annotations {
+		if strings.HasPrefix(key, "networkpolicy.webhook.io/") {
+			a.Annotations[key] = value
+		}
+	}
+	for key, value := range secret.Data {
+		a.Data[key] = string(value)
+	}
+	return a
+}
+
+// Decode reads an archive from its YAML or JSON encoding
+func Decode(data []byte) (*Archive, error) {
+	archive := &Archive{}
+	if err := yaml.Unmarshal(data, archive); err != nil {
+		return nil, fmt.Errorf("invalid approval archive: %w", err)
+	}
+	if archive.Kind != Kind {
+		return nil, fmt.Errorf("expected an approval archive of kind %s but got kind %q", Kind, archive.Kind)
+	}
+	if archive.APIVersion != APIVersion {
+		return nil, fmt.Errorf("unsupported approval archive version %q, expected %s", archive.APIVersion, APIVersion)
+	}
+	return archive, nil
+}
+
+// Digest returns the hex encoded SHA-256 digest of the archive without its signature, the message it is signed over
+func (a *Archive) Digest() (string, error) {
+	unsigned := *a
+	unsigned.Signature = ""
+	data, err := json.Marshal(unsigned)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal approval archive: %w", err)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
+// Sign signs the archive with a PEM encoded private key
+func (a *Archive) Sign(privateKey []byte) error {
+	digest, err := a.Digest()
+	if err != nil {
+		return err
+	}
+	a.Signature, err = signature.Sign(privateKey, digest)
+	return err
+}
+
+// Verify checks the signature of the archive and returns the name of the key that made it
+func (a *Archive) Verify(verifier *signature.Verifier) (string, error) {
+	if a.Signature == "" {
+		return "", errors.New("the approval archive is not signed")
+	}
+	digest, err := a.Digest()
+	if err != nil {
+		return "", err
+	}
+	return verifier.Verify(a.Namespace(), digest, a.Signature)
+}
+
+// Namespace returns the namespace all approvals of the archive are in, empty if they are in several. Signing
+// keys restricted to namespaces may only sign archives of their namespace
+func (a *Archive) Namespace() string {
+	namespace := ""
+	for i, entry := range a.Approvals {
+		if i > 0 && entry.Namespace != namespace {
+			return ""
+		}
+		namespace = entry.Namespace
+	}
+	return namespace
+}
+
+// Validate checks that the approved hashes, the current, the scheduled and those of the history, match the
+// stored specs
+func (a Approval) Validate() error {
+	if a.Namespace == "" || a.Name == "" {
+		return errors.New("approval has no namespace or name")
+	}
+	if _, ok := a.Data[approval.SecretKeyHash]; !ok {
+		return fmt.Errorf("approval of %s/%s has no hash", a.Namespace, a.Name)
+	}
+	if annotated, ok := a.Annotations[approval.AnnotationApprovalHash]; ok && annotated != a.Data[approval.SecretKeyHash] {
+		return fmt.Errorf("approval of %s/%s annotates hash %s but holds %s", a.Namespace, a.Name, annotated, a.Data[approval.SecretKeyHash])
+	}
+	for _, prefix := range []string{"", approval.SecretKeyPendingPrefix} {
+		hash, ok := a.Data[prefix+approval.SecretKeyHash]
+		if !ok {
+			continue
+		}
+		spec, ok := a.Data[prefix+approval.SecretKeySpec]
+		if !ok {
+			return fmt.Errorf("approval of %s/%s has no %s to re-validate %s against", a.Namespace, a.Name, prefix+approval.SecretKeySpec, prefix+approval.SecretKeyHash)
+		}
+		if err := a.validateSpec(prefix+approval.SecretKeyHash, hash, spec); err != nil {
+			return err
+		}
+	}
+	// Rollbacks admit the versions of the history without approval
+	versions, err := approval.History(map[string][]byte{approval.SecretKeyHistory: []byte(a.Data[approval.SecretKeyHistory])})
+	if err != nil {
+		return fmt.Errorf("approval of %s/%s: %w", a.Namespace, a.Name, err)
+	}
+	for i, version := range versions {
+		if err := a.validateSpec(fmt.Sprintf("history version %d", i+1), version.Hash, version.Spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateSpec checks that the approved hash, described by what, matches the encoded spec
+func (a Approval) validateSpec(what, hash, spec string) error {
+	decoded, err := approval.DecodeSpec([]byte(spec))
+	if err != nil {
+		return fmt.Errorf("approval of %s/%s: %w", a.Namespace, a.Name, err)
+	}
+	computed, err := approval.GenerateNetworkPolicyHash(&networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: a.Name, Namespace: a.Namespace},
+		Spec:       *decoded,
+	})
+	if err != nil {
+		return err
+	}
+	if computed != hash {
+		return fmt.Errorf("approval of %s/%s: %s %s does not match its spec, which hashes to %s", a.Namespace, a.Name, what, hash, computed)
+	}
+	return nil
+}
+
+// Secret returns the approval Secret the controller would have written for the approval
+func (a Approval) Secret() *corev1.Secret {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      approval.Name(a.Namespace, a.Name),
+			Namespace: a.Namespace,
+			Labels: map[string]string{
+				approval.LabelNetworkPolicyApproval: "true",
+				approval.LabelNetworkPolicyName:     a.Name,
+			},
+			Annotations: map[string]string{},
+			Finalizers:  []string{approval.FinalizerApprovalProtection},
+		},
+		Type: approval.SecretTypeNetworkPolicyApproval,
+		Data: map[string][]byte{},
+	}
+	for key, value := range a.Annotations {
+		secret.Annotations[key] = value
+	}
+	secret.Annotations[approval.AnnotationNPName] = a.Name
+	secret.Annotations[approval.AnnotationNPNamespace] = a.Namespace
+	for key, value := range a.Data {
+		secret.Data[key] = []byte(value)
+	}
+	return secret
+}
+
+// ImportOptions control how approvals are restored
+type ImportOptions struct {
+	// Overwrite replaces approvals of the cluster that differ from the archived ones, they are kept otherwise
+	Overwrite bool
+	// DryRun only reports what would be imported, the API server still validates every change
+	DryRun bool
+}
+
+// Import re-validates every approval of the archive and recreates its approval Secret, progress is written to
+// out. Nothing is imported if any approval fails validation
+func Import(ctx context.Context, c client.Client, archive *Archive, options ImportOptions, out io.Writer) error {
+	invalid := []string{}
+	for _, entry := range archive.Approvals {
+		if err := entry.Validate(); err != nil {
+			invalid = append(invalid, err.Error())
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("the archive holds invalid approvals, nothing was imported:\n  %s", strings.Join(invalid, "\n  "))
+	}
+
+	if options.DryRun {
+		c = client.NewDryRunClient(c)
+	}
+	failed := 0
+	for _, entry := range archive.Approvals {
+		result, err := importApproval(ctx, c, entry, options.Overwrite)
+		if err != nil {
+			failed++
+			result = err.Error()
+		}
+		fmt.Fprintf(out, "%s/%s: %s\n", entry.Namespace, entry.Name, result)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d approvals could not be imported", failed, len(archive.Approvals))
+	}
+	return nil
+}
+
+// importApproval writes the approval Secret of an approval and describes what it did
+func importApproval(ctx context.Context, c client.Client, entry Approval, overwrite bool) (string, error) {
+	secret := entry.Secret()
+	existing := &corev1.Secret{}
+	err := c.Get(ctx, types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}, existing)
+	if apierrors.IsNotFound(err) {
+		if err := c.Create(ctx, secret); err != nil {
+			return "", fmt.Errorf("failed to create approval: %w", err)
+		}
+		return "created", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get approval: %w", err)
+	}
+
+	if existing.Type != approval.SecretTypeNetworkPolicyApproval {
+		return "", fmt.Errorf("secret %s exists but is not an approval", existing.Name)
+	}
+	if string(existing.Data[approval.SecretKeyHash]) == entry.Data[approval.SecretKeyHash] &&
+		string(existing.Data[approval.SecretKeyPendingPrefix+approval.SecretKeyHash]) == entry.Data[approval.SecretKeyPendingPrefix+approval.SecretKeyHash] {
+		return "unchanged", nil
+	}
+	if !overwrite {
+		return fmt.Sprintf("skipped, the cluster approved hash %s instead", existing.Data[approval.SecretKeyHash]), nil
+	}
+	existing.Annotations, existing.Data = secret.Annotations, secret.Data
+	existing.Labels = secret.Labels
+	if !slices.Contains(existing.Finalizers, approval.FinalizerApprovalProtection) {
+		existing.Finalizers = append(existing.Finalizers, approval.FinalizerApprovalProtection)
+	}
+	if err := c.Update(ctx, existing); err != nil {
+		return "", fmt.Errorf("failed to update approval: %w", err)
+	}
+	return "updated", nil
+}
@@ -0,0 +1,154 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hadi2f244/approve-controller/internal/pkg/approval"
+	"github.com/hadi2f244/approve-controller/internal/pkg/signature"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+)
+
+// approvalSecret returns the approval Secret the controller writes for shop/web
+func approvalSecret(t *testing.T) *corev1.Secret {
+	t.Helper()
+	np := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"},
+		Spec:       networkingv1.NetworkPolicySpec{PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}},
+	}
+	hash, err := approval.GenerateNetworkPolicyHash(np)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, err := approval.EncodeSpec(np.Spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      approval.Name("shop", "web"),
+			Namespace: "shop",
+			Labels:    map[string]string{approval.LabelNetworkPolicyApproval: "true", approval.LabelNetworkPolicyName: "web"},
+			Annotations: map[string]string{
+				approval.AnnotationNPName:       "web",
+				approval.AnnotationNPNamespace:  "shop",
+				approval.AnnotationApprovalHash: hash,
+				"kubectl.kubernetes.io/note":    "not exported",
+			},
+			Finalizers: []string{approval.FinalizerApprovalProtection},
+		},
+		Type: approval.SecretTypeNetworkPolicyApproval,
+		Data: map[string][]byte{
+			approval.SecretKeyHash:    []byte(hash),
+			approval.SecretKeySpec:    []byte(spec),
+			approval.SecretKeyCSRName: []byte(approval.Name("shop", "web")),
+		},
+	}
+}
+
+func TestExportSignAndImport(t *testing.T) {
+	ctx := context.Background()
+	secret := approvalSecret(t)
+	source := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(secret).Build()
+
+	archive, err := Export(ctx, source, "", time.Now())
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if len(archive.Approvals) != 1 || archive.Approvals[0].Name != "web" {
+		t.Fatalf("Export() = %+v, want the approval of shop/web", archive.Approvals)
+	}
+	if _, ok := archive.Approvals[0].Annotations["kubectl.kubernetes.io/note"]; ok {
+		t.Error("Export() kept annotations of other tools")
+	}
+
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	privateDER, _ := x509.MarshalPKCS8PrivateKey(private)
+	publicDER, _ := x509.MarshalPKIXPublicKey(public)
+	if err := archive.Sign(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})); err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	encoded, err := yaml.Marshal(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := Decode(encoded)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	verifier, err := signature.NewVerifier([]signature.TrustedKey{
+		{Name: "backup", PublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := decoded.Verify(verifier); err != nil || key != "backup" {
+		t.Fatalf("Verify() = %q, %v", key, err)
+	}
+
+	target := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	out := &bytes.Buffer{}
+	if err := Import(ctx, target, decoded, ImportOptions{}, out); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	restored := &corev1.Secret{}
+	if err := target.Get(ctx, types.NamespacedName{Name: secret.Name, Namespace: "shop"}, restored); err != nil {
+		t.Fatalf("approval Secret was not restored: %v", err)
+	}
+	if !bytes.Equal(restored.Data[approval.SecretKeySpec], secret.Data[approval.SecretKeySpec]) ||
+		restored.Type != approval.SecretTypeNetworkPolicyApproval || len(restored.Finalizers) != 1 {
+		t.Errorf("restored Secret = %+v, want %+v", restored, secret)
+	}
+
+	out.Reset()
+	if err := Import(ctx, target, decoded, ImportOptions{}, out); err != nil || !strings.Contains(out.String(), "unchanged") {
+		t.Errorf("Import() again = %v, %q", err, out.String())
+	}
+}
+
+func TestImportRevalidatesHashes(t *testing.T) {
+	archive := &Archive{APIVersion: APIVersion, Kind: Kind, Approvals: []Approval{fromSecret(approvalSecret(t))}}
+	archive.Approvals[0].Data[approval.SecretKeySpec] = `{"policyTypes":["Egress"]}`
+
+	target := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	err := Import(context.Background(), target, archive, ImportOptions{}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "does not match its spec") {
+		t.Fatalf("Import() error = %v, want a hash mismatch", err)
+	}
+
+	forged := fromSecret(approvalSecret(t))
+	history := map[string][]byte{}
+	if err := approval.RecordVersion(history, approval.Version{Hash: forged.Data[approval.SecretKeyHash], Spec: `{"policyTypes":["Egress"]}`}, 10); err != nil {
+		t.Fatal(err)
+	}
+	forged.Data[approval.SecretKeyHistory] = string(history[approval.SecretKeyHistory])
+	if err := forged.Validate(); err == nil || !strings.Contains(err.Error(), "history version 1") {
+		t.Errorf("Validate() = %v, want the forged history version rejected", err)
+	}
+	if err := target.Get(context.Background(), types.NamespacedName{Name: approval.Name("shop", "web"), Namespace: "shop"}, &corev1.Secret{}); err == nil {
+		t.Error("Import() wrote an approval of an invalid archive")
+	}
+}
+
+func TestDecodeRejectsOtherVersions(t *testing.T) {
+	if _, err := Decode([]byte("apiVersion: networkpolicy.webhook.io/v2\nkind: ApprovalArchive\n")); err == nil {
+		t.Error("Decode() accepted an unsupported version")
+	}
+	if _, err := Decode([]byte("apiVersion: v1\nkind: Secret\n")); err == nil {
+		t.Error("Decode() accepted another kind")
+	}
+}
@@ -0,0 +1,68 @@
+// Package breakglass lets members of configured groups admit NetworkPolicies without an approval during incidents.
+// Every use files a retroactive approval request, the change is rolled back if it is not approved in time.
+package breakglass
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+)
+
+// Policy holds who may break glass and for how long, it can be replaced while in use
+type Policy struct {
+	mu       sync.RWMutex
+	groups   []string
+	duration time.Duration
+}
+
+// NewPolicy returns a Policy allowing members of groups to bypass approval for duration
+func NewPolicy(groups []string, duration time.Duration) *Policy {
+	return &Policy{groups: groups, duration: duration}
+}
+
+// Set replaces the groups and the duration, e.g. after the configuration was reloaded
+func (p *Policy) Set(groups []string, duration time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.groups = groups
+	p.duration = duration
+}
+
+// Groups returns the groups allowed to break glass
+func (p *Policy) Groups() []string {
+	if p == nil {
+		return nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.groups
+}
+
+// Allowed reports whether the user may break glass, it is never allowed without groups or a duration
+func (p *Policy) Allowed(user authenticationv1.UserInfo) bool {
+	if p == nil {
+		return false
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.duration <= 0 {
+		return false
+	}
+	return slices.ContainsFunc(p.groups, func(group string) bool {
+		return slices.Contains(user.Groups, group)
+	})
+}
+
+// Expiry returns the end of a window opened at now. An earlier window that is still open is kept,
+// so changing the NetworkPolicy again does not extend the time it may go unapproved
+func (p *Policy) Expiry(now time.Time, previous time.Time) time.Time {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	expiry := now.Add(p.duration)
+	if previous.After(now) && previous.Before(expiry) {
+		return previous
+	}
+	return expiry
+}
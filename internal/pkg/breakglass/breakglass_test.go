@@ -0,0 +1,53 @@
+package breakglass
+
+import (
+	"testing"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+)
+
+func TestAllowed(t *testing.T) {
+	oncall := authenticationv1.UserInfo{Username: "alice", Groups: []string{"system:authenticated", "oncall"}}
+	developer := authenticationv1.UserInfo{Username: "bob", Groups: []string{"system:authenticated"}}
+
+	policy := NewPolicy([]string{"oncall"}, time.Hour)
+	if !policy.Allowed(oncall) {
+		t.Error("member of the break-glass group is not allowed")
+	}
+	if policy.Allowed(developer) {
+		t.Error("user outside the break-glass group is allowed")
+	}
+
+	policy.Set([]string{"oncall"}, 0)
+	if policy.Allowed(oncall) {
+		t.Error("break-glass without a duration is allowed")
+	}
+
+	var disabled *Policy
+	if disabled.Allowed(oncall) {
+		t.Error("nil policy allows break-glass")
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	policy := NewPolicy([]string{"oncall"}, time.Hour)
+
+	tests := map[string]struct {
+		previous time.Time
+		want     time.Time
+	}{
+		"first use":       {want: now.Add(time.Hour)},
+		"open window":     {previous: now.Add(10 * time.Minute), want: now.Add(10 * time.Minute)},
+		"elapsed window":  {previous: now.Add(-time.Minute), want: now.Add(time.Hour)},
+		"longer previous": {previous: now.Add(2 * time.Hour), want: now.Add(time.Hour)},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := policy.Expiry(now, test.previous); !got.Equal(test.want) {
+				t.Errorf("Expiry() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
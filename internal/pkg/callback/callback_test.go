@@ -0,0 +1,217 @@
+package callback
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hadi2f244/approve-controller/internal/pkg/approval"
+	"github.com/hadi2f244/approve-controller/internal/pkg/authz"
+	"github.com/hadi2f244/approve-controller/internal/pkg/notify"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+var key = []byte("0123456789abcdef0123456789abcdef")
+
+func TestTokenRoundTrip(t *testing.T) {
+	signer := NewSigner(key, time.Hour)
+	token, err := signer.Issue(Claims{Subject: "alice", Groups: []string{"netsec"}, CSRName: "np-approval-shop-web", Hash: "abc", Action: ActionApprove})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	claims, err := signer.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if claims.Subject != "alice" || claims.Hash != "abc" || claims.Action != ActionApprove || claims.ID == "" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	parts := strings.Split(token, ".")
+	tampered := parts[0] + "." + parts[1] + "x." + parts[2]
+	if _, err := signer.Verify(tampered); err == nil {
+		t.Error("Verify() accepted a tampered token")
+	}
+	if _, err := NewSigner([]byte("another key of at least 32 bytes!"), time.Hour).Verify(token); err == nil {
+		t.Error("Verify() accepted a token signed with another key")
+	}
+	signer.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if _, err := signer.Verify(token); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("Verify() error = %v, want expired", err)
+	}
+}
+
+func TestLinks(t *testing.T) {
+	signer := NewSigner(key, time.Hour)
+	issuer := &LinkIssuer{BaseURL: "https://approvals.example.com/", Signer: signer}
+	approve, deny, err := issuer.Links(notify.Notification{CSRName: "np-approval-shop-web", Hash: "abc"}, "alice", nil)
+	if err != nil {
+		t.Fatalf("Links() error = %v", err)
+	}
+	for link, want := range map[string]Action{approve: ActionApprove, deny: ActionDeny} {
+		parsed, err := url.Parse(link)
+		if err != nil || parsed.Host != "approvals.example.com" || parsed.Path != Path {
+			t.Fatalf("unexpected link %s", link)
+		}
+		claims, err := signer.Verify(parsed.Query().Get("token"))
+		if err != nil || claims.Action != want || claims.Subject != "alice" {
+			t.Errorf("link %s has claims %+v, error %v", link, claims, err)
+		}
+	}
+}
+
+// newHandler returns a handler for a pending request of shop/web and a token deciding it as alice, who may
+// approve requests in shop
+func newHandler(t *testing.T, action Action, hash string) (*Handler, client.Client, string) {
+	t.Helper()
+	return newHandlerFor(t, "alice", action, hash)
+}
+
+func newHandlerFor(t *testing.T, approver string, action Action, hash string) (*Handler, client.Client, string) {
+	t.Helper()
+	csr := &certificatesv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "np-approval-shop-web",
+			Annotations: map[string]string{
+				approval.AnnotationApprovalHash: "abc",
+				approval.AnnotationNamespace:    "shop",
+				approval.AnnotationName:         "web",
+			},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(csr).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			review, ok := obj.(*authorizationv1.SubjectAccessReview)
+			if !ok {
+				return c.Create(ctx, obj, opts...)
+			}
+			review.Status.Allowed = review.Spec.User == "alice" && review.Spec.ResourceAttributes.Namespace == "shop"
+			return nil
+		},
+	}).Build()
+	signer := NewSigner(key, time.Hour)
+	handler := &Handler{Client: c, Authorizer: authz.NewAuthorizer(c), Signer: signer}
+	token, err := signer.Issue(Claims{Subject: approver, CSRName: csr.Name, Hash: hash, Action: action})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return handler, c, token
+}
+
+func post(handler http.Handler, token, reason string) *httptest.ResponseRecorder {
+	form := url.Values{"token": {token}, "reason": {reason}}
+	req := httptest.NewRequest(http.MethodPost, Path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandlerConfirmsBeforeDeciding(t *testing.T) {
+	handler, c, token := newHandler(t, ActionApprove, "abc")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, Path+"?token="+token, nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `<form method="post">`) ||
+		!strings.Contains(rec.Body.String(), "shop/web") {
+		t.Fatalf("GET responded %d:\n%s", rec.Code, rec.Body.String())
+	}
+	csr := &certificatesv1.CertificateSigningRequest{}
+	if err := c.Get(context.Background(), types.NamespacedName{Name: "np-approval-shop-web"}, csr); err != nil {
+		t.Fatal(err)
+	}
+	if len(csr.Status.Conditions) > 0 || csr.Annotations[approval.AnnotationUsedCallbackTokens] != "" {
+		t.Error("GET changed the request")
+	}
+}
+
+func TestHandlerApprovesOnce(t *testing.T) {
+	handler, c, token := newHandler(t, ActionApprove, "abc")
+	if rec := post(handler, token, ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("POST without reason responded %d", rec.Code)
+	}
+	if rec := post(handler, token, "change 42"); rec.Code != http.StatusOK {
+		t.Fatalf("POST responded %d:\n%s", rec.Code, rec.Body.String())
+	}
+	csr := &certificatesv1.CertificateSigningRequest{}
+	if err := c.Get(context.Background(), types.NamespacedName{Name: "np-approval-shop-web"}, csr); err != nil {
+		t.Fatal(err)
+	}
+	if len(csr.Status.Conditions) != 1 || csr.Status.Conditions[0].Type != certificatesv1.CertificateApproved ||
+		csr.Status.Conditions[0].Reason != ConditionReason || csr.Status.Conditions[0].Message != "change 42 (by alice)" {
+		t.Errorf("unexpected conditions %+v", csr.Status.Conditions)
+	}
+	if csr.Annotations[approval.AnnotationUsedCallbackTokens] == "" {
+		t.Error("the token was not recorded as used")
+	}
+	if rec := post(handler, token, "change 42"); rec.Code != http.StatusConflict {
+		t.Errorf("replayed POST responded %d", rec.Code)
+	}
+}
+
+func TestHandlerAuthorizesTheApprover(t *testing.T) {
+	handler, c, token := newHandlerFor(t, "mallory", ActionApprove, "abc")
+	if rec := post(handler, token, "change 42"); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "not allowed") {
+		t.Errorf("POST responded %d:\n%s", rec.Code, rec.Body.String())
+	}
+	csr := &certificatesv1.CertificateSigningRequest{}
+	if err := c.Get(context.Background(), types.NamespacedName{Name: "np-approval-shop-web"}, csr); err != nil {
+		t.Fatal(err)
+	}
+	if len(csr.Status.Conditions) > 0 {
+		t.Error("an unauthorized approver decided the request")
+	}
+
+	handler, c, token = newHandler(t, ActionApprove, "abc")
+	if err := c.Get(context.Background(), types.NamespacedName{Name: "np-approval-shop-web"}, csr); err != nil {
+		t.Fatal(err)
+	}
+	csr.Annotations[approval.AnnotationFreeze] = "year-end"
+	csr.Annotations[approval.AnnotationApproverGroups] = "change-board"
+	if err := c.Update(context.Background(), csr); err != nil {
+		t.Fatal(err)
+	}
+	if rec := post(handler, token, "change 42"); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "change-board") {
+		t.Errorf("POST during a freeze responded %d:\n%s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandlerRejectsReplayedToken(t *testing.T) {
+	handler, c, token := newHandler(t, ActionDeny, "abc")
+	claims, _ := handler.Signer.Verify(token)
+	csr := &certificatesv1.CertificateSigningRequest{}
+	if err := c.Get(context.Background(), types.NamespacedName{Name: "np-approval-shop-web"}, csr); err != nil {
+		t.Fatal(err)
+	}
+	csr.Annotations[approval.AnnotationUsedCallbackTokens] = claims.ID
+	if err := c.Update(context.Background(), csr); err != nil {
+		t.Fatal(err)
+	}
+	if rec := post(handler, token, "nope"); rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "already used") {
+		t.Errorf("POST responded %d:\n%s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandlerRejectsOtherVersion(t *testing.T) {
+	handler, c, token := newHandler(t, ActionApprove, "older")
+	if rec := post(handler, token, "change 42"); rec.Code != http.StatusGone {
+		t.Errorf("POST responded %d:\n%s", rec.Code, rec.Body.String())
+	}
+	csr := &certificatesv1.CertificateSigningRequest{}
+	if err := c.Get(context.Background(), types.NamespacedName{Name: "np-approval-shop-web"}, csr); err != nil {
+		t.Fatal(err)
+	}
+	if len(csr.Status.Conditions) > 0 {
+		t.Error("a token for another version decided the request")
+	}
+}
@@ -0,0 +1,266 @@
+package callback
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/hadi2f244/approve-controller/internal/pkg/approval"
+	"github.com/hadi2f244/approve-controller/internal/pkg/authz"
+	"github.com/hadi2f244/approve-controller/internal/pkg/decision"
+	"github.com/hadi2f244/approve-controller/internal/pkg/notify"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Path is where the handler is served
+const Path = "/callback"
+
+// ConditionReason is set on the CSR conditions written through callback links
+const ConditionReason = "NPApproveCallback"
+
+var log = logf.Log.WithName("callback")
+
+// LinkIssuer signs approve and deny links pointing to BaseURL, it implements notify.LinkIssuer
+type LinkIssuer struct {
+	BaseURL string
+	Signer  *Signer
+}
+
+var _ notify.LinkIssuer = &LinkIssuer{}
+
+// Links implements notify.LinkIssuer
+func (l *LinkIssuer) Links(n notify.Notification, approver string, groups []string) (string, string, error) {
+	claims := Claims{Subject: approver, Groups: groups, CSRName: n.CSRName, Hash: n.Hash}
+	urls := make([]string, 0, 2)
+	for _, action := range []Action{ActionApprove, ActionDeny} {
+		claims.Action = action
+		token, err := l.Signer.Issue(claims)
+		if err != nil {
+			return "", "", err
+		}
+		urls = append(urls, strings.TrimSuffix(l.BaseURL, "/")+Path+"?"+url.Values{"token": {token}}.Encode())
+	}
+	return urls[0], urls[1], nil
+}
+
+// Handler decides requests with callback tokens. A GET shows a confirmation form, only the POST it submits
+// decides, so link scanners of mail and chat clients cannot use a token.
+type Handler struct {
+	// Client reads requests and records used tokens and decisions as the manager
+	Client client.Client
+	// Authorizer checks that the approver of a token may decide the request, like the CertificateSigningRequest
+	// webhook does for decisions made with kubectl
+	Authorizer *authz.Authorizer
+	Signer     *Signer
+}
+
+// page is rendered for every response, Form is set on the confirmation
+type page struct {
+	Title     string
+	Message   string
+	Form      bool
+	Token     string
+	Action    Action
+	Namespace string
+	Name      string
+	Approver  string
+}
+
+var pageTemplate = template.Must(template.New("callback").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Message}}<pre>{{.Message}}</pre>{{end}}
+{{if .Form}}<p>{{.Action}} NetworkPolicy {{.Namespace}}/{{.Name}} as {{.Approver}}.</p>
+<form method="post">
+<input type="hidden" name="token" value="{{.Token}}">
+<label>Reason <input type="text" name="reason" required></label>
+<button type="submit">{{.Action}}</button>
+</form>{{end}}
+</body>
+</html>
+`))
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.confirm(w, r)
+	case http.MethodPost:
+		h.decide(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		render(w, http.StatusMethodNotAllowed, page{Title: "Method not allowed"})
+	}
+}
+
+// confirm shows what the token decides and asks for a reason
+func (h *Handler) confirm(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	claims, csr, status, err := h.request(r.Context(), token)
+	if err != nil {
+		render(w, status, page{Title: "Link cannot be used", Message: err.Error()})
+		return
+	}
+	render(w, http.StatusOK, page{
+		Title:     fmt.Sprintf("Confirm %s", claims.Action),
+		Form:      true,
+		Token:     token,
+		Action:    claims.Action,
+		Namespace: csr.Annotations[approval.AnnotationNamespace],
+		Name:      csr.Annotations[approval.AnnotationName],
+		Approver:  claims.Subject,
+	})
+}
+
+// decide consumes the token and records its decision as the approver
+func (h *Handler) decide(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims, csr, status, err := h.request(ctx, r.PostFormValue("token"))
+	if err != nil {
+		render(w, status, page{Title: "Link cannot be used", Message: err.Error()})
+		return
+	}
+	reason := r.PostFormValue("reason")
+	if strings.TrimSpace(reason) == "" {
+		render(w, http.StatusBadRequest, page{Title: "Link cannot be used", Message: "a reason is required"})
+		return
+	}
+	if err := h.consume(ctx, csr, claims.ID); err != nil {
+		log.Error(err, "Failed to record used callback token", "csr", csr.Name)
+		render(w, http.StatusConflict, page{Title: "Link cannot be used", Message: err.Error()})
+		return
+	}
+
+	outcome := certificatesv1.CertificateDenied
+	if claims.Action == ActionApprove {
+		outcome = certificatesv1.CertificateApproved
+	}
+	user := authenticationv1.UserInfo{Username: claims.Subject, Groups: claims.Groups}
+	if err := h.authorize(ctx, user, csr, outcome); err != nil {
+		log.Info("Rejected callback decision", "csr", csr.Name, "approver", claims.Subject, "action", claims.Action, "error", err.Error())
+		render(w, http.StatusForbidden, page{Title: "Decision failed", Message: err.Error()})
+		return
+	}
+	var out bytes.Buffer
+	decided, err := decision.Decide(ctx, h.Client, csr, outcome, reason, claims.Subject, ConditionReason, h.canApprove(user), &out)
+	if err != nil {
+		log.Info("Callback decision failed", "csr", csr.Name, "approver", claims.Subject, "action", claims.Action, "error", err.Error())
+		render(w, http.StatusForbidden, page{Title: "Decision failed", Message: err.Error()})
+		return
+	}
+	log.Info("Recorded callback decision", "csr", csr.Name, "approver", claims.Subject, "action", claims.Action, "decided", decided)
+	title := "Approval recorded"
+	if decided {
+		title = fmt.Sprintf("Request %s", strings.ToLower(string(outcome)))
+	}
+	render(w, http.StatusOK, page{Title: title, Message: out.String()})
+}
+
+// authorize returns an error unless user may decide the request: they need the approve verb in its namespace or
+// one it affects, and approvals during a change freeze need a member of its approver groups
+func (h *Handler) authorize(ctx context.Context, user authenticationv1.UserInfo, csr *certificatesv1.CertificateSigningRequest,
+	outcome certificatesv1.RequestConditionType) error {
+	namespace := csr.Annotations[approval.AnnotationNamespace]
+	allowed := false
+	for _, candidate := range append([]string{namespace}, approval.AffectedNamespaces(csr.Annotations)...) {
+		ok, err := h.canApprove(user)(ctx, candidate)
+		if err != nil {
+			return err
+		}
+		if ok {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("%s is not allowed to decide requests of namespace %s, it needs the %s verb on %s.%s",
+			user.Username, namespace, authz.VerbApprove, authz.Resource, authz.Group)
+	}
+	if groups := approval.ApproverGroups(csr.Annotations); outcome == certificatesv1.CertificateApproved && len(groups) > 0 &&
+		!slices.ContainsFunc(groups, func(group string) bool { return slices.Contains(user.Groups, group) }) {
+		return fmt.Errorf("request %s was filed during change freeze %s and has to be approved by a member of [%s]",
+			csr.Name, csr.Annotations[approval.AnnotationFreeze], strings.Join(groups, ", "))
+	}
+	return nil
+}
+
+// canApprove checks the approve verb of user with SubjectAccessReviews
+func (h *Handler) canApprove(user authenticationv1.UserInfo) decision.CanApproveFunc {
+	return func(ctx context.Context, namespace string) (bool, error) {
+		if namespace == approval.AllNamespaces {
+			namespace = ""
+		}
+		allowed, _, err := h.Authorizer.CanApprove(ctx, user, namespace)
+		return allowed, err
+	}
+}
+
+// request verifies the token and returns the pending request it was issued for, with the HTTP status of errors
+func (h *Handler) request(ctx context.Context, token string) (Claims, *certificatesv1.CertificateSigningRequest, int, error) {
+	claims, err := h.Signer.Verify(token)
+	if err != nil {
+		return claims, nil, http.StatusUnauthorized, err
+	}
+	csr := &certificatesv1.CertificateSigningRequest{}
+	err = h.Client.Get(ctx, types.NamespacedName{Name: claims.CSRName}, csr)
+	if apierrors.IsNotFound(err) {
+		return claims, nil, http.StatusGone, fmt.Errorf("request %s no longer exists", claims.CSRName)
+	}
+	if err != nil {
+		return claims, nil, http.StatusInternalServerError, fmt.Errorf("failed to get request %s", claims.CSRName)
+	}
+	if csr.Annotations[approval.AnnotationApprovalHash] != claims.Hash {
+		return claims, nil, http.StatusGone, errors.New("the NetworkPolicy changed since the link was sent, a new request was filed")
+	}
+	if len(csr.Status.Conditions) > 0 {
+		return claims, nil, http.StatusConflict, fmt.Errorf("request %s is already %s", csr.Name, decision.Status(csr))
+	}
+	if slices.Contains(usedTokens(csr), claims.ID) {
+		return claims, nil, http.StatusConflict, errors.New("the link was already used")
+	}
+	return claims, csr, http.StatusOK, nil
+}
+
+// consume records the token as used on the request. The update fails on a concurrent change of the request,
+// so a token is consumed only once even if it is submitted to several replicas at the same time
+func (h *Handler) consume(ctx context.Context, csr *certificatesv1.CertificateSigningRequest, id string) error {
+	if csr.Annotations == nil {
+		csr.Annotations = map[string]string{}
+	}
+	csr.Annotations[approval.AnnotationUsedCallbackTokens] = strings.Join(append(usedTokens(csr), id), ",")
+	if err := h.Client.Update(ctx, csr); err != nil {
+		return fmt.Errorf("the request changed while the link was used, open it again: %w", err)
+	}
+	return nil
+}
+
+// usedTokens returns the IDs of the tokens used on the request
+func usedTokens(csr *certificatesv1.CertificateSigningRequest) []string {
+	if used := csr.Annotations[approval.AnnotationUsedCallbackTokens]; used != "" {
+		return strings.Split(used, ",")
+	}
+	return nil
+}
+
+func render(w http.ResponseWriter, status int, p page) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.WriteHeader(status)
+	if err := pageTemplate.Execute(w, p); err != nil {
+		log.Error(err, "Failed to render callback page")
+	}
+}
@@ -0,0 +1,33 @@
+package callback
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Mux serves the handler at Path
+func Mux(handler *Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(Path, handler)
+	return mux
+}
+
+// Delegate returns the user the credentials of config authenticate as. The handler records decisions as this
+// user, the CertificateSigningRequest webhook lets it record them on behalf of the approvers of tokens
+func Delegate(ctx context.Context, config *rest.Config, scheme *runtime.Scheme) (string, error) {
+	c, err := client.New(config, client.Options{Scheme: scheme})
+	if err != nil {
+		return "", err
+	}
+	review := &authenticationv1.SelfSubjectReview{}
+	if err := c.Create(ctx, review); err != nil {
+		return "", fmt.Errorf("failed to determine the user of the controller: %w", err)
+	}
+	return review.Status.UserInfo.Username, nil
+}
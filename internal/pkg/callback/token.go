@@ -0,0 +1,107 @@
+// Package callback decides approval requests from signed links sent with notifications. A link carries a
+// short-lived HS256 JWT bound to one version of a request and one approver. The approver is authorized with
+// SubjectAccessReviews like the CertificateSigningRequest webhook authorizes kubectl users, then the controller
+// records the decision in their name.
+package callback
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Action is the decision a token grants
+type Action string
+
+const (
+	ActionApprove Action = "approve"
+	ActionDeny    Action = "deny"
+)
+
+// Claims bind a token to a decision on one version of a request by one approver
+type Claims struct {
+	// ID is unique per token, a used ID is recorded on the request so the token cannot be replayed
+	ID string `json:"jti"`
+	// Subject and Groups are the approver
+	Subject string   `json:"sub"`
+	Groups  []string `json:"groups,omitempty"`
+	// CSRName and Hash identify the request and the version of the NetworkPolicy it was filed for
+	CSRName   string `json:"csr"`
+	Hash      string `json:"hash"`
+	Action    Action `json:"action"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// header is the fixed JOSE header of every token
+var header = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Signer issues and verifies tokens with an HMAC key
+type Signer struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewSigner returns a Signer issuing tokens valid for ttl
+func NewSigner(key []byte, ttl time.Duration) *Signer {
+	return &Signer{key: key, ttl: ttl, now: time.Now}
+}
+
+// Issue signs the claims, setting a random ID, the issue and the expiry time
+func (s *Signer) Issue(claims Claims) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate token ID: %w", err)
+	}
+	now := s.now()
+	claims.ID = hex.EncodeToString(id)
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(s.ttl).Unix()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal token claims: %w", err)
+	}
+	signed := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + s.sign(signed), nil
+}
+
+// Verify checks the signature and expiry of token and returns its claims
+func (s *Signer) Verify(token string) (Claims, error) {
+	claims := Claims{}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != header {
+		return claims, errors.New("malformed token")
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(s.sign(parts[0]+"."+parts[1]))) {
+		return claims, errors.New("invalid token signature")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, errors.New("malformed token")
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, errors.New("malformed token")
+	}
+	if !s.now().Before(time.Unix(claims.ExpiresAt, 0)) {
+		return claims, errors.New("the link expired, ask for a new one")
+	}
+	if claims.ID == "" || claims.Subject == "" || claims.CSRName == "" || claims.Hash == "" ||
+		(claims.Action != ActionApprove && claims.Action != ActionDeny) {
+		return claims, errors.New("incomplete token")
+	}
+	return claims, nil
+}
+
+func (s *Signer) sign(data string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
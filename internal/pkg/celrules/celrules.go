@@ -0,0 +1,247 @@
+// Package celrules evaluates CEL expressions from the operator configuration against a requested
+// NetworkPolicy to approve it, deny it or require additional approvers.
+//
+// Expressions see three variables:
+//
+//	object       the requested NetworkPolicy
+//	oldObject    the approved NetworkPolicy, null if it was never approved
+//	request      the admission request, e.g. request.userInfo.username and request.userInfo.groups
+//	risk         the risk analysis, risk.score and risk.findings with id, severity, path and message
+package celrules
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/hadi2f244/approve-controller/internal/pkg/analyzer"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Action is what happens to a request whose rule expression evaluates to true
+type Action string
+
+const (
+	// ActionApprove approves the request without a human
+	ActionApprove Action = "approve"
+	// ActionDeny rejects the NetworkPolicy with the rule's message, no request is filed
+	ActionDeny Action = "deny"
+	// ActionRequireApprovers requires the rule's number of distinct approvers
+	ActionRequireApprovers Action = "requireApprovers"
+)
+
+// Rule is a CEL expression and the action taken when it evaluates to true
+type Rule struct {
+	// Name identifies the rule in messages and approval records
+	Name string `mapstructure:"name"`
+	// Expression is a CEL expression returning a bool
+	Expression string `mapstructure:"expression"`
+	// Action taken when the expression is true
+	Action Action `mapstructure:"action"`
+	// Message is shown to the requester when the rule denies the request
+	Message string `mapstructure:"message"`
+	// Approvers is the number of distinct approvers required by ActionRequireApprovers
+	Approvers int `mapstructure:"approvers"`
+}
+
+// Decision is the combined outcome of all rules, deny wins over requiring approvers, which wins over approve.
+// The zero Decision means no rule matched.
+type Decision struct {
+	Action Action
+	// Rule is the name of the rule that made the decision
+	Rule string
+	// Message explains a denial
+	Message string
+	// Approvers is the highest number of approvers required by any matching rule
+	Approvers int
+}
+
+// Input is the request the rules are evaluated against
+type Input struct {
+	// Policy is the requested NetworkPolicy
+	Policy *networkingv1.NetworkPolicy
+	// ApprovedPolicy is the approved version of the NetworkPolicy, nil if it was never approved
+	ApprovedPolicy *networkingv1.NetworkPolicy
+	// UserInfo is the requester
+	UserInfo authenticationv1.UserInfo
+	// Risk is the analysis of the change
+	Risk analyzer.Report
+}
+
+type compiledRule struct {
+	Rule
+	program cel.Program
+}
+
+// Evaluator holds compiled rules, the rules can be replaced while the evaluator is in use
+type Evaluator struct {
+	mu    sync.RWMutex
+	rules []compiledRule
+}
+
+// NewEvaluator compiles the rules, see Compile
+func NewEvaluator(rules []Rule) (*Evaluator, error) {
+	e := &Evaluator{}
+	if err := e.SetRules(rules); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// SetRules compiles and replaces the rules, the previous rules are kept if any rule is invalid
+func (e *Evaluator) SetRules(rules []Rule) error {
+	compiled, err := compile(rules)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules = compiled
+	return nil
+}
+
+// Compile checks that every rule is complete and its expression compiles to a bool
+func Compile(rules []Rule) error {
+	_, err := compile(rules)
+	return err
+}
+
+func compile(rules []Rule) ([]compiledRule, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("object", cel.DynType),
+		cel.Variable("oldObject", cel.DynType),
+		cel.Variable("request", cel.DynType),
+		cel.Variable("risk", cel.DynType),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CEL environment: %w", err)
+	}
+
+	compiled := make([]compiledRule, 0, len(rules))
+	names := map[string]bool{}
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("CEL rule %d has no name", i)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("duplicate CEL rule %s", rule.Name)
+		}
+		names[rule.Name] = true
+		switch rule.Action {
+		case ActionApprove, ActionDeny:
+		case ActionRequireApprovers:
+			if rule.Approvers < 2 {
+				return nil, fmt.Errorf("CEL rule %s: %s needs approvers of at least 2", rule.Name, ActionRequireApprovers)
+			}
+		default:
+			return nil, fmt.Errorf("CEL rule %s: unknown action %q, expected %s, %s or %s",
+				rule.Name, rule.Action, ActionApprove, ActionDeny, ActionRequireApprovers)
+		}
+
+		ast, issues := env.Compile(rule.Expression)
+		if issues != nil && issues.Err() != nil {
+			return nil, fmt.Errorf("CEL rule %s: invalid expression: %w", rule.Name, issues.Err())
+		}
+		if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+			return nil, fmt.Errorf("CEL rule %s: expression must return a bool but returns %s", rule.Name, ast.OutputType())
+		}
+		program, err := env.Program(ast)
+		if err != nil {
+			return nil, fmt.Errorf("CEL rule %s: %w", rule.Name, err)
+		}
+		compiled = append(compiled, compiledRule{Rule: rule, program: program})
+	}
+	return compiled, nil
+}
+
+// Evaluate runs every rule against the input and combines the matching ones into a Decision.
+// Rules that fail to evaluate, e.g. because they access a missing field, do not match and are returned as errors.
+func (e *Evaluator) Evaluate(input Input) (Decision, []error) {
+	if e == nil {
+		return Decision{}, nil
+	}
+	activation, err := activation(input)
+	if err != nil {
+		return Decision{}, []error{err}
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	decision := Decision{}
+	var errs []error
+	for _, rule := range e.rules {
+		value, _, err := rule.program.Eval(activation)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("CEL rule %s: %w", rule.Name, err))
+			continue
+		}
+		matched, ok := value.Value().(bool)
+		if !ok {
+			errs = append(errs, fmt.Errorf("CEL rule %s: expression returned %T instead of a bool", rule.Name, value.Value()))
+			continue
+		}
+		if matched {
+			decision = combine(decision, rule.Rule)
+		}
+	}
+	return decision, errs
+}
+
+// combine merges a matching rule into the decision so far
+func combine(decision Decision, rule Rule) Decision {
+	switch {
+	case decision.Action == ActionDeny:
+	case rule.Action == ActionDeny:
+		return Decision{Action: ActionDeny, Rule: rule.Name, Message: rule.Message}
+	case rule.Action == ActionRequireApprovers:
+		if rule.Approvers > decision.Approvers {
+			return Decision{Action: ActionRequireApprovers, Rule: rule.Name, Approvers: rule.Approvers}
+		}
+	case decision.Action == "":
+		return Decision{Action: ActionApprove, Rule: rule.Name}
+	}
+	return decision
+}
+
+func activation(input Input) (map[string]any, error) {
+	object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(input.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert NetworkPolicy for CEL: %w", err)
+	}
+	// oldObject is null rather than an empty map so expressions can test oldObject == null
+	var oldObject any
+	if input.ApprovedPolicy != nil {
+		if oldObject, err = runtime.DefaultUnstructuredConverter.ToUnstructured(input.ApprovedPolicy); err != nil {
+			return nil, fmt.Errorf("failed to convert approved NetworkPolicy for CEL: %w", err)
+		}
+	}
+	groups := make([]any, 0, len(input.UserInfo.Groups))
+	for _, group := range input.UserInfo.Groups {
+		groups = append(groups, group)
+	}
+	findings := make([]any, 0, len(input.Risk.Findings))
+	for _, finding := range input.Risk.Findings {
+		findings = append(findings, map[string]any{
+			"id":       finding.ID,
+			"severity": string(finding.Severity),
+			"path":     finding.Path,
+			"message":  finding.Message,
+		})
+	}
+	return map[string]any{
+		"risk": map[string]any{
+			"score":    input.Risk.Score,
+			"findings": findings,
+		},
+		"object":    object,
+		"oldObject": oldObject,
+		"request": map[string]any{
+			"userInfo": map[string]any{
+				"username": input.UserInfo.Username,
+				"groups":   groups,
+			},
+		},
+	}, nil
+}
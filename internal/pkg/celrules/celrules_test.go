@@ -0,0 +1,122 @@
+package celrules
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hadi2f244/approve-controller/internal/pkg/analyzer"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCompileRejectsInvalidRules(t *testing.T) {
+	tests := map[string]struct {
+		rule Rule
+		want string
+	}{
+		"syntax error":   {rule: Rule{Name: "broken", Action: ActionApprove, Expression: "object.metadata.name =="}, want: "CEL rule broken: invalid expression"},
+		"not a bool":     {rule: Rule{Name: "name", Action: ActionApprove, Expression: "'allow-dns'"}, want: "must return a bool"},
+		"unknown action": {rule: Rule{Name: "nothing", Action: "ignore", Expression: "true"}, want: "unknown action"},
+		"one approver":   {rule: Rule{Name: "single", Action: ActionRequireApprovers, Expression: "true", Approvers: 1}, want: "at least 2"},
+		"unnamed":        {rule: Rule{Action: ActionApprove, Expression: "true"}, want: "has no name"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := Compile([]Rule{tt.rule})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Compile() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	evaluator, err := NewEvaluator([]Rule{
+		{Name: "platform", Action: ActionApprove, Expression: "'platform' in request.userInfo.groups"},
+		{Name: "new-policy", Action: ActionRequireApprovers, Approvers: 2, Expression: "oldObject == null"},
+		{Name: "no-ipblocks", Action: ActionDeny, Message: "ipBlocks are not allowed",
+			Expression: "has(object.spec.ingress) && object.spec.ingress.exists(r, has(r.from) && r.from.exists(p, has(p.ipBlock)))"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to compile rules: %v", err)
+	}
+
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "allow-web", Namespace: "team-a"},
+		Spec: networkingv1.NetworkPolicySpec{Ingress: []networkingv1.NetworkPolicyIngressRule{{
+			From: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}},
+		}}},
+	}
+	withIPBlock := policy.DeepCopy()
+	withIPBlock.Spec.Ingress[0].From = append(withIPBlock.Spec.Ingress[0].From,
+		networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: "0.0.0.0/0"}})
+	platform := authenticationv1.UserInfo{Username: "alice", Groups: []string{"platform"}}
+
+	tests := map[string]struct {
+		input Input
+		want  Decision
+	}{
+		"approve": {
+			input: Input{Policy: policy, ApprovedPolicy: policy, UserInfo: platform},
+			want:  Decision{Action: ActionApprove, Rule: "platform"},
+		},
+		"require approvers wins over approve": {
+			input: Input{Policy: policy, UserInfo: platform},
+			want:  Decision{Action: ActionRequireApprovers, Rule: "new-policy", Approvers: 2},
+		},
+		"deny wins": {
+			input: Input{Policy: withIPBlock, UserInfo: platform},
+			want:  Decision{Action: ActionDeny, Rule: "no-ipblocks", Message: "ipBlocks are not allowed"},
+		},
+		"no match": {
+			input: Input{Policy: policy, ApprovedPolicy: policy},
+			want:  Decision{},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, errs := evaluator.Evaluate(tt.input)
+			if len(errs) > 0 {
+				t.Fatalf("Evaluate() errors = %v", errs)
+			}
+			if got != tt.want {
+				t.Errorf("Evaluate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetRulesKeepsPreviousRulesOnError(t *testing.T) {
+	evaluator, err := NewEvaluator([]Rule{{Name: "all", Action: ActionApprove, Expression: "true"}})
+	if err != nil {
+		t.Fatalf("Failed to compile rules: %v", err)
+	}
+	if err := evaluator.SetRules([]Rule{{Name: "broken", Action: ActionApprove, Expression: "("}}); err == nil {
+		t.Fatal("SetRules() accepted an invalid expression")
+	}
+	decision, _ := evaluator.Evaluate(Input{Policy: &networkingv1.NetworkPolicy{}})
+	if decision.Rule != "all" {
+		t.Errorf("Evaluate() = %+v, want the previous rule to still apply", decision)
+	}
+}
+
+func TestEvaluateRisk(t *testing.T) {
+	evaluator, err := NewEvaluator([]Rule{
+		{Name: "risky", Action: ActionRequireApprovers, Approvers: 3,
+			Expression: "risk.score >= 40 || risk.findings.exists(f, f.id == 'WorldIPBlock')"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to compile rules: %v", err)
+	}
+	input := Input{
+		Policy: &networkingv1.NetworkPolicy{},
+		Risk:   analyzer.Report{Score: 40, Findings: []analyzer.Finding{{ID: analyzer.FindingWorldIPBlock, Severity: analyzer.SeverityHigh}}},
+	}
+	if decision, errs := evaluator.Evaluate(input); len(errs) > 0 || decision.Rule != "risky" {
+		t.Errorf("Evaluate() = %+v, %v, want the risky rule to match", decision, errs)
+	}
+	if decision, errs := evaluator.Evaluate(Input{Policy: &networkingv1.NetworkPolicy{}}); len(errs) > 0 || decision.Action != "" {
+		t.Errorf("Evaluate() = %+v, %v, want no match without findings", decision, errs)
+	}
+}
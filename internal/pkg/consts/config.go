@@ -2,10 +2,17 @@ package consts
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/hadi2f244/approve-controller/internal/pkg/autoapprove"
+	"github.com/hadi2f244/approve-controller/internal/pkg/celrules"
+	"github.com/hadi2f244/approve-controller/internal/pkg/freeze"
+	"github.com/hadi2f244/approve-controller/internal/pkg/notify"
+	"github.com/hadi2f244/approve-controller/internal/pkg/signature"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
@@ -15,6 +22,30 @@ const (
 	lookupRequeueAfterTimeSecond               = "operator.config.lookupRequeueAfterTimeSecond"
 	logLevelKey                                = "log.level"
 	operatorCalicoNetworkPolicyExcludedListKey = "operator.caliconetworkpolicy.excludedList"
+	driftResyncPeriodSecondKey                 = "operator.drift.resyncPeriodSecond"
+	driftRemediationKey                        = "operator.drift.remediation"
+	auditFilePathKey                           = "operator.audit.filePath"
+	autoApprovalRulesKey                       = "operator.autoApproval.rules"
+	autoApprovalTighteningKey                  = "operator.autoApproval.tightening"
+	celRulesKey                                = "operator.celRules"
+	breakGlassGroupsKey                        = "operator.breakGlass.groups"
+	breakGlassDurationSecondKey                = "operator.breakGlass.durationSecond"
+	freezeWindowsKey                           = "operator.freezeWindows"
+	notificationSinksKey                       = "operator.notifications.sinks"
+	notificationMaxAttemptsKey                 = "operator.notifications.maxAttempts"
+	notificationInitialBackoffSecondKey        = "operator.notifications.initialBackoffSecond"
+	notificationDeadLetterFilePathKey          = "operator.notifications.deadLetterFilePath"
+	notificationExpiryWarningSecondKey         = "operator.notifications.expiryWarningSecond"
+	callbackBindAddressKey                     = "operator.callback.bindAddress"
+	callbackBaseURLKey                         = "operator.callback.baseURL"
+	callbackKeyFromEnvKey                      = "operator.callback.keyFromEnv"
+	callbackTokenTTLSecondKey                  = "operator.callback.tokenTTLSecond"
+	dashboardBindAddressKey                    = "operator.dashboard.bindAddress"
+	dashboardHistoryLimitKey                   = "operator.dashboard.historyLimit"
+	trustedKeysKey                             = "operator.signatures.trustedKeys"
+	changeSetWindowSecondKey                   = "operator.changeSets.windowSecond"
+	approvalOrphanRetentionSecondKey           = "operator.approvals.orphanRetentionSecond"
+	approvalHistoryLimitKey                    = "operator.approvals.historyLimit"
 )
 
 var (
@@ -22,10 +53,23 @@ var (
 	defaultOperatorConfigPathValue                 = "/etc/operator-config/config.yaml"
 	defaultOperatorCalicoNetworkPolicyExcludedList = []string{"kube-system", "calico-system", "calico-apiserver", "kube-node-lease", "ingress-nginx"}
 	defaultLookupRequeueAfterTimeSecond            = int64(30 * time.Second)
+	defaultDriftResyncPeriodSecond                 = int64(300)
+	defaultDriftRemediation                        = DriftRemediationNone
+	defaultBreakGlassDurationSecond                = int64(3600)
+	defaultNotificationMaxAttempts                 = 5
+	defaultNotificationInitialBackoffSecond        = int64(2)
+	defaultNotificationExpiryWarningSecond         = int64(7 * 24 * 3600)
+	defaultCallbackTokenTTLSecond                  = int64(3600)
+	defaultDashboardHistoryLimit                   = 100
+	defaultApprovalOrphanRetentionSecond           = int64(7 * 24 * 3600)
+	defaultApprovalHistoryLimit                    = 10
 )
 
 type Configuration struct {
 	v *viper.Viper
+
+	mu        sync.Mutex
+	listeners []func()
 }
 
 func getOperatorConfigPath() (string, error) {
@@ -38,7 +82,7 @@ func getOperatorConfigPath() (string, error) {
 }
 
 func NewConfiguration() (*Configuration, error) {
-	c := Configuration{
+	c := &Configuration{
 		v: viper.New(),
 	}
 
@@ -46,8 +90,19 @@ func NewConfiguration() (*Configuration, error) {
 	c.v.SetDefault(logLevelKey, defaultLogLevel)
 	c.v.SetDefault(operatorCalicoNetworkPolicyExcludedListKey, defaultOperatorCalicoNetworkPolicyExcludedList)
 	c.v.SetDefault(lookupRequeueAfterTimeSecond, defaultLookupRequeueAfterTimeSecond)
+	c.v.SetDefault(driftResyncPeriodSecondKey, defaultDriftResyncPeriodSecond)
+	c.v.SetDefault(driftRemediationKey, defaultDriftRemediation)
+	c.v.SetDefault(autoApprovalTighteningKey, true)
+	c.v.SetDefault(breakGlassDurationSecondKey, defaultBreakGlassDurationSecond)
+	c.v.SetDefault(notificationMaxAttemptsKey, defaultNotificationMaxAttempts)
+	c.v.SetDefault(notificationInitialBackoffSecondKey, defaultNotificationInitialBackoffSecond)
+	c.v.SetDefault(notificationExpiryWarningSecondKey, defaultNotificationExpiryWarningSecond)
+	c.v.SetDefault(callbackTokenTTLSecondKey, defaultCallbackTokenTTLSecond)
+	c.v.SetDefault(dashboardHistoryLimitKey, defaultDashboardHistoryLimit)
+	c.v.SetDefault(approvalOrphanRetentionSecondKey, defaultApprovalOrphanRetentionSecond)
+	c.v.SetDefault(approvalHistoryLimitKey, defaultApprovalHistoryLimit)
 	c.v.SetDefault(operatorConfigPathKey, defaultOperatorConfigPathValue)
-	if operatorConfigPath, err := getOperatorConfigPath(); err != nil {
+	if operatorConfigPath, err := getOperatorConfigPath(); err == nil {
 		c.v.SetDefault(operatorConfigPathKey, operatorConfigPath)
 	}
 	c.v.AutomaticEnv()
@@ -61,12 +116,45 @@ func NewConfiguration() (*Configuration, error) {
 		return nil, fmt.Errorf("fatal error while reading the config file: %s", err)
 	}
 	setLogLevel(c.GetLogLevel())
+	// Fail early on invalid expressions instead of when the first NetworkPolicy is validated
+	if _, err := c.GetCELRules(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", c.GetPathToConfig(), err)
+	}
+	if _, err := c.GetFreezeWindows(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", c.GetPathToConfig(), err)
+	}
+	if _, err := c.GetNotificationSinks(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", c.GetPathToConfig(), err)
+	}
+	if _, err := c.GetCallback(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", c.GetPathToConfig(), err)
+	}
+	if _, err := c.GetTrustedKeys(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", c.GetPathToConfig(), err)
+	}
 	c.v.WatchConfig()
 	c.v.OnConfigChange(func(e fsnotify.Event) {
 		logrus.WithField("file", e.Name).Warn("Config file changed")
 		setLogLevel(c.GetLogLevel())
+		c.notify()
 	})
-	return &c, nil
+	return c, nil
+}
+
+// OnChange registers fn to be called after the config file was reloaded
+func (c *Configuration) OnChange(fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listeners = append(c.listeners, fn)
+}
+
+func (c *Configuration) notify() {
+	c.mu.Lock()
+	listeners := append([]func(){}, c.listeners...)
+	c.mu.Unlock()
+	for _, fn := range listeners {
+		fn()
+	}
 }
 
 // GetLogLevel returns the log level
@@ -89,6 +177,191 @@ func (c *Configuration) GetOperatorCalicoNetworkPolicyExcludedList() []string {
 	return c.v.GetStringSlice(operatorCalicoNetworkPolicyExcludedListKey)
 }
 
+// GetDriftResyncPeriod returns how often live NetworkPolicies are compared with their approval
+func (c *Configuration) GetDriftResyncPeriod() time.Duration {
+	return time.Duration(c.v.GetInt64(driftResyncPeriodSecondKey)) * time.Second
+}
+
+// GetDriftRemediation returns what to do with a NetworkPolicy that drifted from its approval
+func (c *Configuration) GetDriftRemediation() (DriftRemediation, error) {
+	remediation := DriftRemediation(c.v.GetString(driftRemediationKey))
+	switch remediation {
+	case DriftRemediationNone, DriftRemediationRevert, DriftRemediationDelete:
+		return remediation, nil
+	}
+	return "", fmt.Errorf("unknown drift remediation %q, expected one of %s, %s or %s",
+		remediation, DriftRemediationNone, DriftRemediationRevert, DriftRemediationDelete)
+}
+
+// GetAuditFilePath returns the path of the JSON lines audit trail, empty if auditing is disabled
+func (c *Configuration) GetAuditFilePath() string {
+	return c.v.GetString(auditFilePathKey)
+}
+
+// GetAutoApprovalRules returns the rules under which requests are approved without a human
+func (c *Configuration) GetAutoApprovalRules() ([]autoapprove.Rule, error) {
+	rules := []autoapprove.Rule{}
+	if err := c.v.UnmarshalKey(autoApprovalRulesKey, &rules); err != nil {
+		return nil, fmt.Errorf("invalid auto-approval rules: %w", err)
+	}
+	names := map[string]bool{}
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("duplicate auto-approval rule %s", rule.Name)
+		}
+		names[rule.Name] = true
+	}
+	return rules, nil
+}
+
+// GetAutoApproveTightening returns whether changes that only tighten an approved NetworkPolicy are approved automatically
+func (c *Configuration) GetAutoApproveTightening() bool {
+	return c.v.GetBool(autoApprovalTighteningKey)
+}
+
+// GetCELRules returns the CEL approval rules, it fails if any expression does not compile
+func (c *Configuration) GetCELRules() ([]celrules.Rule, error) {
+	rules := []celrules.Rule{}
+	if err := c.v.UnmarshalKey(celRulesKey, &rules); err != nil {
+		return nil, fmt.Errorf("invalid CEL rules: %w", err)
+	}
+	if err := celrules.Compile(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// GetBreakGlassGroups returns the groups whose members may admit NetworkPolicies without approval, none by default
+func (c *Configuration) GetBreakGlassGroups() []string {
+	return c.v.GetStringSlice(breakGlassGroupsKey)
+}
+
+// GetBreakGlassDuration returns how long a break-glass change may stay unapproved before it is rolled back
+func (c *Configuration) GetBreakGlassDuration() time.Duration {
+	return time.Duration(c.v.GetInt64(breakGlassDurationSecondKey)) * time.Second
+}
+
+// GetFreezeWindows returns the change freezes during which NetworkPolicy changes are rejected or escalated
+func (c *Configuration) GetFreezeWindows() ([]freeze.Window, error) {
+	windows := []freeze.Window{}
+	if err := c.v.UnmarshalKey(freezeWindowsKey, &windows); err != nil {
+		return nil, fmt.Errorf("invalid freeze windows: %w", err)
+	}
+	if err := freeze.Validate(windows); err != nil {
+		return nil, err
+	}
+	return windows, nil
+}
+
+// GetNotificationSinks returns the sinks notified about approval requests, none by default
+func (c *Configuration) GetNotificationSinks() ([]notify.SinkConfig, error) {
+	sinks := []notify.SinkConfig{}
+	if err := c.v.UnmarshalKey(notificationSinksKey, &sinks); err != nil {
+		return nil, fmt.Errorf("invalid notification sinks: %w", err)
+	}
+	if err := notify.Validate(sinks); err != nil {
+		return nil, err
+	}
+	return sinks, nil
+}
+
+// GetNotificationOptions returns how notifications are retried, read once at startup
+func (c *Configuration) GetNotificationOptions() notify.Options {
+	return notify.Options{
+		MaxAttempts:    c.v.GetInt(notificationMaxAttemptsKey),
+		InitialBackoff: time.Duration(c.v.GetInt64(notificationInitialBackoffSecondKey)) * time.Second,
+	}
+}
+
+// GetNotificationDeadLetterFilePath returns the file undeliverable notifications are appended to, empty to only log them
+func (c *Configuration) GetNotificationDeadLetterFilePath() string {
+	return c.v.GetString(notificationDeadLetterFilePathKey)
+}
+
+// GetNotificationExpiryWarning returns how long before an approval expires approvers are warned
+func (c *Configuration) GetNotificationExpiryWarning() time.Duration {
+	return time.Duration(c.v.GetInt64(notificationExpiryWarningSecondKey)) * time.Second
+}
+
+// Callback configures the endpoint deciding requests from signed notification links
+type Callback struct {
+	// BindAddress is where the endpoint is served, empty if callbacks are disabled
+	BindAddress string
+	// BaseURL is the external URL of the endpoint the links point to
+	BaseURL string
+	// Key signs the tokens of the links
+	Key []byte
+	// TokenTTL is how long a link can be used
+	TokenTTL time.Duration
+}
+
+// GetCallback returns the callback endpoint configuration, read once at startup. It fails if callbacks are
+// enabled without a base URL or signing key
+func (c *Configuration) GetCallback() (Callback, error) {
+	callback := Callback{
+		BindAddress: c.v.GetString(callbackBindAddressKey),
+		BaseURL:     c.v.GetString(callbackBaseURLKey),
+		TokenTTL:    time.Duration(c.v.GetInt64(callbackTokenTTLSecondKey)) * time.Second,
+	}
+	if callback.BindAddress == "" {
+		return callback, nil
+	}
+	if parsed, err := url.Parse(callback.BaseURL); err != nil || parsed.Host == "" {
+		return callback, fmt.Errorf("callbacks need an absolute baseURL")
+	}
+	if callback.TokenTTL <= 0 {
+		return callback, fmt.Errorf("callback tokenTTLSecond has to be positive")
+	}
+	keyFromEnv := c.v.GetString(callbackKeyFromEnvKey)
+	key, ok := os.LookupEnv(keyFromEnv)
+	if keyFromEnv == "" || !ok || len(key) < 32 {
+		return callback, fmt.Errorf("callbacks need keyFromEnv naming an environment variable with a key of at least 32 bytes")
+	}
+	callback.Key = []byte(key)
+	return callback, nil
+}
+
+// GetDashboardBindAddress returns where the read-only dashboard is served, empty if it is disabled
+func (c *Configuration) GetDashboardBindAddress() string {
+	return c.v.GetString(dashboardBindAddressKey)
+}
+
+// GetDashboardHistoryLimit returns how many audit records the dashboard shows per NetworkPolicy
+func (c *Configuration) GetDashboardHistoryLimit() int {
+	return c.v.GetInt(dashboardHistoryLimitKey)
+}
+
+// GetApprovalHistoryLimit returns how many approved versions of a NetworkPolicy are kept for rollbacks, at least 1
+func (c *Configuration) GetApprovalHistoryLimit() int {
+	return max(c.v.GetInt(approvalHistoryLimitKey), 1)
+}
+
+// GetTrustedKeys returns the keys whose signatures pre-approve NetworkPolicies, none by default
+func (c *Configuration) GetTrustedKeys() ([]signature.TrustedKey, error) {
+	keys := []signature.TrustedKey{}
+	if err := c.v.UnmarshalKey(trustedKeysKey, &keys); err != nil {
+		return nil, fmt.Errorf("invalid trusted signing keys: %w", err)
+	}
+	if err := signature.Validate(keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// GetChangeSetWindow returns how long requests of a requester in a namespace join the same change-set, 0 groups
+// only requests with a change-id annotation
+func (c *Configuration) GetChangeSetWindow() time.Duration {
+	return time.Duration(c.v.GetInt64(changeSetWindowSecondKey)) * time.Second
+}
+
+// GetApprovalOrphanRetention returns how long the approval of a missing NetworkPolicy is kept, 0 keeps it forever
+func (c *Configuration) GetApprovalOrphanRetention() time.Duration {
+	return time.Duration(c.v.GetInt64(approvalOrphanRetentionSecondKey)) * time.Second
+}
+
 func setLogLevel(logLevel string) {
 	logrus.WithField("level", logLevel).Warn("setting log level")
 	level, err := logrus.ParseLevel(logLevel)
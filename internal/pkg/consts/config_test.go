@@ -0,0 +1,30 @@
+package consts
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewConfigurationReadsTheConfigFileFromTheEnvironment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("operator:\n  drift:\n    remediation: revert\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("OPERATOR_CONFIG_PATH", path)
+
+	c, err := NewConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.GetPathToConfig(); got != path {
+		t.Errorf("config path = %q, want %q", got, path)
+	}
+	remediation, err := c.GetDriftRemediation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remediation != DriftRemediationRevert {
+		t.Errorf("drift remediation = %q, want %q", remediation, DriftRemediationRevert)
+	}
+}
@@ -21,6 +21,18 @@ const (
 
 )
 
+// DriftRemediation defines how the controller reacts to a NetworkPolicy that drifted from its approval
+type DriftRemediation string
+
+const (
+	// DriftRemediationNone only reports the drift
+	DriftRemediationNone DriftRemediation = "none"
+	// DriftRemediationRevert restores the approved spec, or deletes the policy if it was never approved
+	DriftRemediationRevert DriftRemediation = "revert"
+	// DriftRemediationDelete deletes the unapproved policy
+	DriftRemediationDelete DriftRemediation = "delete"
+)
+
 var (
 	CalicoOwnerKey = ".metadata.ownerReferences"
 	ApiGVStr       = "hadiazad.local/v1alpha1"
@@ -0,0 +1,69 @@
+// Package crossnamespace finds the namespaces other than its own that a NetworkPolicy affects,
+// whose owners have to approve it as well.
+package crossnamespace
+
+import (
+	"context"
+	"slices"
+
+	"github.com/hadi2f244/approve-controller/internal/pkg/approval"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Affected resolves the namespaceSelectors of the peers of the NetworkPolicy against the live Namespaces and
+// returns the sorted names of the selected namespaces other than its own. A selector matching every namespace,
+// including ones created later, yields approval.AllNamespaces
+func Affected(ctx context.Context, reader client.Reader, np *networkingv1.NetworkPolicy) ([]string, error) {
+	var selectors []labels.Selector
+	for _, peer := range peers(&np.Spec) {
+		if peer.NamespaceSelector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(peer.NamespaceSelector)
+		if err != nil {
+			return nil, err
+		}
+		if selector.Empty() {
+			return []string{approval.AllNamespaces}, nil
+		}
+		selectors = append(selectors, selector)
+	}
+	if len(selectors) == 0 {
+		return nil, nil
+	}
+
+	namespaceList := &corev1.NamespaceList{}
+	if err := reader.List(ctx, namespaceList); err != nil {
+		return nil, err
+	}
+	var affected []string
+	for _, namespace := range namespaceList.Items {
+		if namespace.Name == np.Namespace {
+			continue
+		}
+		for _, selector := range selectors {
+			if selector.Matches(labels.Set(namespace.Labels)) {
+				affected = append(affected, namespace.Name)
+				break
+			}
+		}
+	}
+	slices.Sort(affected)
+	return affected, nil
+}
+
+// peers returns the peers of every ingress and egress rule
+func peers(spec *networkingv1.NetworkPolicySpec) []networkingv1.NetworkPolicyPeer {
+	var all []networkingv1.NetworkPolicyPeer
+	for _, rule := range spec.Ingress {
+		all = append(all, rule.From...)
+	}
+	for _, rule := range spec.Egress {
+		all = append(all, rule.To...)
+	}
+	return all
+}
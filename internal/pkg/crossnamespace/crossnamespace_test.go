@@ -0,0 +1,76 @@
+package crossnamespace
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/hadi2f244/approve-controller/internal/pkg/approval"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestAffected(t *testing.T) {
+	namespace := func(name, team string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"team": team}}}
+	}
+	reader := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		namespace("team-a", "a"), namespace("team-b", "b"), namespace("team-b-staging", "b"), namespace("team-c", "c"),
+	).Build()
+
+	teams := func(teams ...string) networkingv1.NetworkPolicyPeer {
+		return networkingv1.NetworkPolicyPeer{NamespaceSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: "team", Operator: metav1.LabelSelectorOpIn, Values: teams},
+		}}}
+	}
+	policy := func(ingress, egress []networkingv1.NetworkPolicyPeer) *networkingv1.NetworkPolicy {
+		return &networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "np", Namespace: "team-a"},
+			Spec: networkingv1.NetworkPolicySpec{
+				Ingress: []networkingv1.NetworkPolicyIngressRule{{From: ingress}},
+				Egress:  []networkingv1.NetworkPolicyEgressRule{{To: egress}},
+			},
+		}
+	}
+
+	tests := map[string]struct {
+		policy *networkingv1.NetworkPolicy
+		want   []string
+	}{
+		"same namespace only": {
+			policy: policy([]networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}}, nil),
+		},
+		"own namespace selected": {
+			policy: policy([]networkingv1.NetworkPolicyPeer{teams("a")}, nil),
+		},
+		"egress to another team": {
+			policy: policy(nil, []networkingv1.NetworkPolicyPeer{teams("b")}),
+			want:   []string{"team-b", "team-b-staging"},
+		},
+		"ingress and egress": {
+			policy: policy([]networkingv1.NetworkPolicyPeer{teams("c")}, []networkingv1.NetworkPolicyPeer{teams("a", "b")}),
+			want:   []string{"team-b", "team-b-staging", "team-c"},
+		},
+		"all namespaces": {
+			policy: policy(nil, []networkingv1.NetworkPolicyPeer{{NamespaceSelector: &metav1.LabelSelector{}}}),
+			want:   []string{approval.AllNamespaces},
+		},
+		"no namespace matches": {
+			policy: policy(nil, []networkingv1.NetworkPolicyPeer{teams("d")}),
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := Affected(context.Background(), reader, test.policy)
+			if err != nil {
+				t.Fatalf("Affected() error = %v", err)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("Affected() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hadi2f244/approve-controller/internal/pkg/approval"
+	"github.com/hadi2f244/approve-controller/internal/pkg/audit"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var now = time.Date(2025, 3, 7, 10, 0, 0, 0, time.UTC)
+
+func encodedSpec(t *testing.T, port int32) string {
+	t.Helper()
+	target := intstr.FromInt32(port)
+	spec, err := approval.EncodeSpec(networkingv1.NetworkPolicySpec{
+		PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		Ingress:     []networkingv1.NetworkPolicyIngressRule{{Ports: []networkingv1.NetworkPolicyPort{{Port: &target}}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+func request(name, namespace, hash string, conditions ...certificatesv1.CertificateSigningRequestCondition) *certificatesv1.CertificateSigningRequest {
+	return &certificatesv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              approval.Name(namespace, name),
+			Labels:            map[string]string{approval.LabelNetworkPolicyApproval: "true"},
+			CreationTimestamp: metav1.NewTime(now.Add(-time.Hour)),
+			Annotations: map[string]string{
+				approval.AnnotationNamespace:    namespace,
+				approval.AnnotationName:         name,
+				approval.AnnotationApprovalHash: hash,
+				approval.AnnotationRequester:    "alice",
+			},
+		},
+		Status: certificatesv1.CertificateSigningRequestStatus{Conditions: conditions},
+	}
+}
+
+func approvalSecret(name, namespace, hash string, annotations map[string]string) *corev1.Secret {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      approval.Name(namespace, name),
+			Namespace: namespace,
+			Labels: map[string]string{
+				approval.LabelNetworkPolicyApproval: "true",
+				approval.LabelNetworkPolicyName:     name,
+			},
+			Annotations: map[string]string{approval.AnnotationNPName: name, approval.AnnotationNPNamespace: namespace},
+		},
+		Type: approval.SecretTypeNetworkPolicyApproval,
+		Data: map[string][]byte{approval.SecretKeyHash: []byte(hash)},
+	}
+	for key, value := range annotations {
+		secret.Annotations[key] = value
+	}
+	return secret
+}
+
+// newStore returns a store with a pending change of shop/web, a denied request of shop/db, an expired approval
+// of shop/cache, an approval of bank/ledger whose request still exists and an approved request of bank/vault
+// that was not written to a Secret yet
+func newStore(t *testing.T) *Store {
+	t.Helper()
+	pending := request("web", "shop", "new")
+	pending.Annotations[approval.AnnotationSpec] = encodedSpec(t, 8080)
+	pending.Annotations[approval.AnnotationRiskScore] = "40"
+	pending.Annotations[approval.AnnotationRiskFindings] = `[{"id":"wide-port","severity":"medium","message":"opens a port"}]`
+	webApproval := approvalSecret("web", "shop", "old", nil)
+	webApproval.Data[approval.SecretKeySpec] = []byte(encodedSpec(t, 80))
+	for _, version := range []approval.Version{
+		{Hash: "older", Spec: encodedSpec(t, 22), Approver: "bob", ApprovedAt: now.Add(-48 * time.Hour)},
+		{Hash: "old", Spec: encodedSpec(t, 80), Approver: "bob", ApprovedAt: now.Add(-24 * time.Hour)},
+	} {
+		if err := approval.RecordVersion(webApproval.Data, version, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	objects := []client.Object{
+		pending,
+		webApproval,
+		request("db", "shop", "db", certificatesv1.CertificateSigningRequestCondition{
+			Type: certificatesv1.CertificateDenied, Status: corev1.ConditionTrue, Message: "too broad"}),
+		approvalSecret("cache", "shop", "cache", map[string]string{approval.AnnotationNotAfter: now.Add(-time.Minute).Format(time.RFC3339)}),
+		approvalSecret("ledger", "bank", "ledger", nil),
+		request("ledger", "bank", "ledger", certificatesv1.CertificateSigningRequestCondition{
+			Type: certificatesv1.CertificateApproved, Status: corev1.ConditionTrue}),
+		request("vault", "bank", "vault", certificatesv1.CertificateSigningRequestCondition{
+			Type: certificatesv1.CertificateApproved, Status: corev1.ConditionTrue}),
+	}
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := audit.NewFileSink(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range []audit.Record{
+		{Action: audit.ActionApproval, Namespace: "shop", Name: "web", Approver: "bob"},
+		{Action: audit.ActionRequest, Namespace: "shop", Name: "db", Requester: "alice"},
+		{Action: audit.ActionRequest, Namespace: "shop", Name: "web", Requester: "alice"},
+	} {
+		if err := sink.Write(context.Background(), record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = sink.Close()
+	return &Store{
+		Client:        fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objects...).Build(),
+		AuditFilePath: auditPath,
+		now:           func() time.Time { return now },
+	}
+}
+
+func TestStoreListsEveryState(t *testing.T) {
+	entries, err := newStore(t).List(context.Background(), func(string) bool { return true })
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	got := map[string]State{}
+	for _, entry := range entries {
+		key := entry.Namespace + "/" + entry.Name + "/" + entry.Hash
+		if _, duplicate := got[key]; duplicate {
+			t.Errorf("%s is listed twice", key)
+		}
+		got[key] = entry.State
+	}
+	want := map[string]State{
+		"shop/web/new":       StatePending,
+		"shop/web/old":       StateApproved,
+		"shop/db/db":         StateDenied,
+		"shop/cache/cache":   StateExpired,
+		"bank/ledger/ledger": StateApproved,
+		"bank/vault/vault":   StateApproved,
+	}
+	if len(got) != len(want) {
+		t.Errorf("List() = %v, want %v", got, want)
+	}
+	for key, state := range want {
+		if got[key] != state {
+			t.Errorf("%s is %q, want %q", key, got[key], state)
+		}
+	}
+	if entries[0].Namespace != "bank" {
+		t.Errorf("entries are not grouped by namespace: %+v", entries)
+	}
+}
+
+func TestStoreDetail(t *testing.T) {
+	detail, err := newStore(t).Get(context.Background(), "shop", "web")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if len(detail.Entries) != 2 || !strings.Contains(detail.Requested, "kind: NetworkPolicy") || detail.Approved == "" {
+		t.Errorf("unexpected detail %+v", detail)
+	}
+	if !strings.Contains(detail.Diff, `-          "port": 80`) || !strings.Contains(detail.Diff, `+          "port": 8080`) {
+		t.Errorf("unexpected diff:\n%s", detail.Diff)
+	}
+	if len(detail.Findings) != 1 || detail.Findings[0].ID != "wide-port" {
+		t.Errorf("unexpected findings %+v", detail.Findings)
+	}
+	if len(detail.History) != 2 || detail.History[0].Approver != "bob" {
+		t.Errorf("unexpected history %+v", detail.History)
+	}
+	if len(detail.Versions) != 2 || detail.Versions[0].Hash != "old" || detail.Versions[1].Hash != "older" {
+		t.Errorf("unexpected versions %+v, want the newest first", detail.Versions)
+	}
+	if detail, err := newStore(t).Get(context.Background(), "shop", "missing"); err != nil || detail != nil {
+		t.Errorf("Get() of an unknown NetworkPolicy = %+v, %v", detail, err)
+	}
+}
+
+// newHandler authenticates the token "shop-lead" as a viewer of namespace shop
+func newHandler(t *testing.T) http.Handler {
+	return Mux(&Handler{
+		Store: newStore(t),
+		Authenticator: authenticator.RequestFunc(func(r *http.Request) (*authenticator.Response, bool, error) {
+			if r.Header.Get("Authorization") != "Bearer shop-lead" {
+				return nil, false, nil
+			}
+			return &authenticator.Response{User: &user.DefaultInfo{Name: "carol"}}, true, nil
+		}),
+		Authorizer: authorizer.AuthorizerFunc(func(_ context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+			if a.GetUser().GetName() == "carol" && a.GetNamespace() == "shop" && a.GetVerb() == VerbView &&
+				a.GetResource() == "networkpolicyapprovals" {
+				return authorizer.DecisionAllow, "", nil
+			}
+			return authorizer.DecisionNoOpinion, "", nil
+		}),
+	})
+}
+
+func get(handler http.Handler, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandlerAuthenticatesAndAuthorizes(t *testing.T) {
+	handler := newHandler(t)
+	if rec := get(handler, "/api/v1/approvals", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous request responded %d", rec.Code)
+	}
+	if rec := get(handler, "/api/v1/approvals/bank/ledger", "shop-lead"); rec.Code != http.StatusForbidden {
+		t.Errorf("detail of another namespace responded %d", rec.Code)
+	}
+
+	rec := get(handler, "/api/v1/approvals?state=pending", "shop-lead")
+	entries := []Entry{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("list responded %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(entries) != 1 || entries[0].Namespace != "shop" || entries[0].Name != "web" {
+		t.Errorf("list returned %+v, want the pending request of shop/web", entries)
+	}
+
+	rec = get(handler, "/api/v1/approvals/shop/web/versions", "shop-lead")
+	versions := []approval.Version{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &versions); err != nil || len(versions) != 2 {
+		t.Errorf("versions responded %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = get(handler, "/api/v1/approvals", "shop-lead")
+	_ = json.Unmarshal(rec.Body.Bytes(), &entries)
+	for _, entry := range entries {
+		if entry.Namespace != "shop" {
+			t.Errorf("list shows namespace %s the user may not view", entry.Namespace)
+		}
+	}
+}
+
+func TestHandlerRendersPages(t *testing.T) {
+	handler := newHandler(t)
+	rec := get(handler, "/", "shop-lead")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `href="/namespaces/shop/web"`) ||
+		strings.Contains(rec.Body.String(), "ledger") {
+		t.Errorf("list page responded %d:\n%s", rec.Code, rec.Body.String())
+	}
+	rec = get(handler, "/namespaces/shop/web", "shop-lead")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Diff against the approved version") ||
+		!strings.Contains(rec.Body.String(), "opens a port") {
+		t.Errorf("detail page responded %d:\n%s", rec.Code, rec.Body.String())
+	}
+	if rec := get(handler, "/namespaces/shop/missing", "shop-lead"); rec.Code != http.StatusNotFound {
+		t.Errorf("detail of an unknown NetworkPolicy responded %d", rec.Code)
+	}
+}
@@ -0,0 +1,229 @@
+package dashboard
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/hadi2f244/approve-controller/internal/pkg/approval"
+	"github.com/hadi2f244/approve-controller/internal/pkg/authz"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// VerbView is checked on networkpolicyapprovals in a namespace before its approval state is shown
+const VerbView = "get"
+
+var log = logf.Log.WithName("dashboard")
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"time": func(t time.Time) string { return t.UTC().Format(time.RFC3339) },
+}).ParseFS(templateFiles, "templates/*.html"))
+
+// Handler serves the dashboard and its JSON API:
+//
+//	GET /                                  HTML list of requests and approvals, ?namespace= and ?state= filter it
+//	GET /namespaces/{namespace}/{name}     HTML detail of a NetworkPolicy
+//	GET /api/v1/approvals                  JSON list, filtered like the HTML one
+//	GET /api/v1/approvals/{namespace}/{name} JSON detail
+//	GET /api/v1/approvals/{namespace}/{name}/versions JSON approved versions, newest first
+type Handler struct {
+	Store *Store
+	// Authenticator validates the bearer token of a request, e.g. with TokenReviews
+	Authenticator authenticator.Request
+	// Authorizer checks VerbView per namespace, e.g. with SubjectAccessReviews
+	Authorizer authorizer.Authorizer
+}
+
+// Mux routes the dashboard requests to the handler
+func Mux(h *Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", h.authenticated(h.listPage))
+	mux.HandleFunc("GET /namespaces/{namespace}/{name}", h.authenticated(h.detailPage))
+	mux.HandleFunc("GET /api/v1/approvals", h.authenticated(h.listAPI))
+	mux.HandleFunc("GET /api/v1/approvals/{namespace}/{name}", h.authenticated(h.detailAPI))
+	mux.HandleFunc("GET /api/v1/approvals/{namespace}/{name}/versions", h.authenticated(h.versionsAPI))
+	return mux
+}
+
+// authenticated rejects requests without a valid bearer token and passes the user on to next
+func (h *Handler) authenticated(next func(w http.ResponseWriter, r *http.Request, u user.Info)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response, ok, err := h.Authenticator.AuthenticateRequest(r)
+		if err != nil {
+			log.Error(err, "Authentication failed")
+			http.Error(w, "Authentication failed", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		next(w, r, response.User)
+	}
+}
+
+// visible returns whether u may view the namespaces, checking the whole cluster first so cluster-wide
+// viewers need a single review
+func (h *Handler) visible(ctx context.Context, u user.Info) (func(namespace string) bool, error) {
+	allowed, err := h.authorized(ctx, u, "")
+	if err != nil || allowed {
+		return func(string) bool { return allowed }, err
+	}
+	decisions := map[string]bool{}
+	return func(namespace string) bool {
+		if allowed, ok := decisions[namespace]; ok {
+			return allowed
+		}
+		allowed, err := h.authorized(ctx, u, namespace)
+		if err != nil {
+			log.Error(err, "Authorization failed", "user", u.GetName(), "namespace", namespace)
+		}
+		decisions[namespace] = allowed
+		return allowed
+	}, nil
+}
+
+// authorized reports whether u may view namespace, every namespace if it is empty
+func (h *Handler) authorized(ctx context.Context, u user.Info, namespace string) (bool, error) {
+	decision, _, err := h.Authorizer.Authorize(ctx, authorizer.AttributesRecord{
+		User:            u,
+		Verb:            VerbView,
+		Namespace:       namespace,
+		APIGroup:        authz.Group,
+		Resource:        authz.Resource,
+		ResourceRequest: true,
+	})
+	if err != nil {
+		return false, err
+	}
+	return decision == authorizer.DecisionAllow, nil
+}
+
+// list returns the entries visible to u, filtered by the namespace and state query parameters
+func (h *Handler) list(r *http.Request, u user.Info) ([]Entry, int, error) {
+	visible, err := h.visible(r.Context(), u)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("authorization failed")
+	}
+	namespace, state := r.URL.Query().Get("namespace"), State(r.URL.Query().Get("state"))
+	entries, err := h.Store.List(r.Context(), func(candidate string) bool {
+		return (namespace == "" || candidate == namespace) && visible(candidate)
+	})
+	if err != nil {
+		log.Error(err, "Failed to list approval state")
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to list approval state")
+	}
+	if state == "" {
+		return entries, http.StatusOK, nil
+	}
+	filtered := []Entry{}
+	for _, entry := range entries {
+		if entry.State == state {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered, http.StatusOK, nil
+}
+
+// detail returns the detail of the NetworkPolicy of the request path if u may view its namespace
+func (h *Handler) detail(r *http.Request, u user.Info) (*Detail, int, error) {
+	namespace, name := r.PathValue("namespace"), r.PathValue("name")
+	allowed, err := h.authorized(r.Context(), u, namespace)
+	if err != nil {
+		log.Error(err, "Authorization failed", "user", u.GetName(), "namespace", namespace)
+		return nil, http.StatusInternalServerError, fmt.Errorf("authorization failed")
+	}
+	if !allowed {
+		return nil, http.StatusForbidden, fmt.Errorf("%s may not view approvals in namespace %s, it needs the %s verb on %s.%s",
+			u.GetName(), namespace, VerbView, authz.Resource, authz.Group)
+	}
+	detail, err := h.Store.Get(r.Context(), namespace, name)
+	if err != nil {
+		log.Error(err, "Failed to get approval state", "namespace", namespace, "name", name)
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to get approval state")
+	}
+	if detail == nil {
+		return nil, http.StatusNotFound, fmt.Errorf("no request or approval for NetworkPolicy %s/%s", namespace, name)
+	}
+	return detail, http.StatusOK, nil
+}
+
+func (h *Handler) listAPI(w http.ResponseWriter, r *http.Request, u user.Info) {
+	entries, status, err := h.list(r, u)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	writeJSON(w, entries)
+}
+
+func (h *Handler) detailAPI(w http.ResponseWriter, r *http.Request, u user.Info) {
+	detail, status, err := h.detail(r, u)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	writeJSON(w, detail)
+}
+
+func (h *Handler) versionsAPI(w http.ResponseWriter, r *http.Request, u user.Info) {
+	detail, status, err := h.detail(r, u)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	versions := detail.Versions
+	if versions == nil {
+		versions = []approval.Version{}
+	}
+	writeJSON(w, versions)
+}
+
+func (h *Handler) listPage(w http.ResponseWriter, r *http.Request, u user.Info) {
+	entries, status, err := h.list(r, u)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	render(w, "list.html", map[string]any{
+		"User":      u.GetName(),
+		"Entries":   entries,
+		"Namespace": r.URL.Query().Get("namespace"),
+		"State":     r.URL.Query().Get("state"),
+		"States":    []State{StatePending, StateApproved, StateDenied, StateExpired},
+	})
+}
+
+func (h *Handler) detailPage(w http.ResponseWriter, r *http.Request, u user.Info) {
+	detail, status, err := h.detail(r, u)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	render(w, "detail.html", detail)
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Error(err, "Failed to write response")
+	}
+}
+
+func render(w http.ResponseWriter, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := templates.ExecuteTemplate(w, name, data); err != nil {
+		log.Error(err, "Failed to render dashboard page", "template", name)
+	}
+}
@@ -0,0 +1,305 @@
+// Package dashboard serves a read-only view of the approval state: a JSON API and an HTML UI listing the
+// pending, approved, denied and expired requests per namespace with the requested policy, its diff against
+// the approved version, the risk findings and the audit history. Callers authenticate with a Kubernetes
+// bearer token and only see the namespaces they may get networkpolicyapprovals in.
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/hadi2f244/approve-controller/internal/pkg/analyzer"
+	"github.com/hadi2f244/approve-controller/internal/pkg/approval"
+	"github.com/hadi2f244/approve-controller/internal/pkg/audit"
+	"github.com/hadi2f244/approve-controller/internal/pkg/decision"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// State is where a request or approval is in its lifecycle
+type State string
+
+const (
+	// StatePending requests wait for a decision
+	StatePending State = "pending"
+	// StateApproved approvals admit their NetworkPolicy, possibly only from a scheduled time
+	StateApproved State = "approved"
+	// StateDenied requests were refused
+	StateDenied State = "denied"
+	// StateExpired approvals no longer admit changes, their certificate or window ended
+	StateExpired State = "expired"
+)
+
+// Entry is a request or approval of a NetworkPolicy
+type Entry struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	State     State  `json:"state"`
+	// CSRName is the request, it is empty for approvals whose request was garbage collected
+	CSRName   string    `json:"csrName,omitempty"`
+	Requester string    `json:"requester,omitempty"`
+	Hash      string    `json:"hash,omitempty"`
+	RiskScore string    `json:"riskScore,omitempty"`
+	Created   time.Time `json:"created"`
+	// Expires is the end of an approval, the earlier of its certificate and window
+	Expires *time.Time `json:"expires,omitempty"`
+	// Message is the decision of a request or a note about an approval, e.g. its schedule
+	Message string `json:"message,omitempty"`
+}
+
+// Detail is everything reviewers see about one NetworkPolicy
+type Detail struct {
+	Namespace string  `json:"namespace"`
+	Name      string  `json:"name"`
+	Entries   []Entry `json:"entries"`
+	// Requested is the YAML of the NetworkPolicy of the newest request, Approved the approved version
+	Requested string `json:"requested,omitempty"`
+	Approved  string `json:"approved,omitempty"`
+	// Diff is the change of the newest request against the approved version
+	Diff     string             `json:"diff,omitempty"`
+	Findings []analyzer.Finding `json:"findings,omitempty"`
+	// Versions are the approved versions kept for rollbacks, newest first
+	Versions []approval.Version `json:"versions,omitempty"`
+	// History is the audit trail of the NetworkPolicy, oldest first
+	History []audit.Record `json:"history,omitempty"`
+}
+
+// defaultHistoryLimit bounds the audit records of a Detail if the Store has no limit
+const defaultHistoryLimit = 100
+
+// Store reads the approval state from CSRs, approval Secrets and the audit trail
+type Store struct {
+	Client client.Reader
+	// AuditFilePath is the audit trail the history is read from, there is none if empty
+	AuditFilePath string
+	// HistoryLimit bounds the records of Detail.History
+	HistoryLimit int
+	now          func() time.Time
+}
+
+// List returns the entries of the namespaces visible reports true for, grouped by namespace and newest first
+func (s *Store) List(ctx context.Context, visible func(namespace string) bool) ([]Entry, error) {
+	csrList := &certificatesv1.CertificateSigningRequestList{}
+	if err := s.Client.List(ctx, csrList, client.MatchingLabels{approval.LabelNetworkPolicyApproval: "true"}); err != nil {
+		return nil, fmt.Errorf("failed to list approval requests: %w", err)
+	}
+	secretList := &corev1.SecretList{}
+	if err := s.Client.List(ctx, secretList, client.HasLabels{approval.LabelNetworkPolicyApproval}); err != nil {
+		return nil, fmt.Errorf("failed to list approvals: %w", err)
+	}
+
+	entries := []Entry{}
+	approved := map[string]bool{}
+	for i := range secretList.Items {
+		secret := &secretList.Items[i]
+		if secret.Type != approval.SecretTypeNetworkPolicyApproval || !visible(secret.Namespace) {
+			continue
+		}
+		entry := s.approvalEntry(secret)
+		approved[entry.Namespace+"/"+entry.Name+"/"+entry.Hash] = true
+		entries = append(entries, entry)
+	}
+	for i := range csrList.Items {
+		csr := &csrList.Items[i]
+		if !visible(csr.Annotations[approval.AnnotationNamespace]) {
+			continue
+		}
+		entry := requestEntry(csr)
+		// An approved request is listed until its approval Secret was written
+		if entry.State == StateApproved && approved[entry.Namespace+"/"+entry.Name+"/"+entry.Hash] {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Namespace != entries[j].Namespace {
+			return entries[i].Namespace < entries[j].Namespace
+		}
+		return entries[i].Created.After(entries[j].Created)
+	})
+	return entries, nil
+}
+
+// Get returns the detail of the NetworkPolicy, nil if there is neither a request nor an approval for it
+func (s *Store) Get(ctx context.Context, namespace, name string) (*Detail, error) {
+	entries, err := s.List(ctx, func(candidate string) bool { return candidate == namespace })
+	if err != nil {
+		return nil, err
+	}
+	detail := &Detail{Namespace: namespace, Name: name, Entries: []Entry{}}
+	for _, entry := range entries {
+		if entry.Name == name {
+			detail.Entries = append(detail.Entries, entry)
+		}
+	}
+	if len(detail.Entries) == 0 {
+		return nil, nil
+	}
+
+	approvedSpec, err := s.approvedSpec(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	if approvedSpec != nil {
+		rendered, err := approval.RenderPolicy(namespace, name, approvedSpec)
+		if err != nil {
+			return nil, err
+		}
+		detail.Approved = string(rendered)
+	}
+	if err := s.addNewestRequest(ctx, detail, approvedSpec); err != nil {
+		return nil, err
+	}
+	if detail.Versions, err = s.versions(ctx, namespace, name); err != nil {
+		return nil, err
+	}
+
+	if s.AuditFilePath != "" {
+		limit := s.HistoryLimit
+		if limit <= 0 {
+			limit = defaultHistoryLimit
+		}
+		detail.History, err = audit.ReadFile(s.AuditFilePath, func(record audit.Record) bool {
+			return record.Namespace == namespace && record.Name == name
+		}, limit)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return detail, nil
+}
+
+// addNewestRequest adds the policy, diff and findings of the newest request that has them to the detail
+func (s *Store) addNewestRequest(ctx context.Context, detail *Detail, approvedSpec *networkingv1.NetworkPolicySpec) error {
+	for _, entry := range detail.Entries {
+		if entry.CSRName == "" {
+			continue
+		}
+		csr := &certificatesv1.CertificateSigningRequest{}
+		if err := s.Client.Get(ctx, client.ObjectKey{Name: entry.CSRName}, csr); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		specData, ok := csr.Annotations[approval.AnnotationSpec]
+		if !ok {
+			return nil
+		}
+		requested, err := approval.DecodeSpec([]byte(specData))
+		if err != nil {
+			return err
+		}
+		rendered, err := approval.RenderPolicy(detail.Namespace, detail.Name, requested)
+		if err != nil {
+			return err
+		}
+		detail.Requested = string(rendered)
+		detail.Diff = approval.DiffSpecs(approvedSpec, requested)
+		if findings, ok := csr.Annotations[approval.AnnotationRiskFindings]; ok {
+			if err := json.Unmarshal([]byte(findings), &detail.Findings); err != nil {
+				return fmt.Errorf("failed to parse risk findings of %s: %w", csr.Name, err)
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+// approvedSpec returns the spec stored in the approval Secret, nil if there is no approved version
+func (s *Store) approvedSpec(ctx context.Context, namespace, name string) (*networkingv1.NetworkPolicySpec, error) {
+	secret := &corev1.Secret{}
+	if err := s.Client.Get(ctx, client.ObjectKey{Name: approval.Name(namespace, name), Namespace: namespace}, secret); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	specData, ok := secret.Data[approval.SecretKeySpec]
+	if secret.Type != approval.SecretTypeNetworkPolicyApproval || !ok {
+		return nil, nil
+	}
+	return approval.DecodeSpec(specData)
+}
+
+// versions returns the approved versions in the history of the approval Secret, newest first
+func (s *Store) versions(ctx context.Context, namespace, name string) ([]approval.Version, error) {
+	secret := &corev1.Secret{}
+	if err := s.Client.Get(ctx, client.ObjectKey{Name: approval.Name(namespace, name), Namespace: namespace}, secret); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	if secret.Type != approval.SecretTypeNetworkPolicyApproval {
+		return nil, nil
+	}
+	versions, err := approval.History(secret.Data)
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(versions)
+	return versions, nil
+}
+
+// approvalEntry describes an approval Secret
+func (s *Store) approvalEntry(secret *corev1.Secret) Entry {
+	now := time.Now()
+	if s.now != nil {
+		now = s.now()
+	}
+	entry := Entry{
+		Namespace: secret.Namespace,
+		Name:      secret.Annotations[approval.AnnotationNPName],
+		State:     StateApproved,
+		CSRName:   string(secret.Data[approval.SecretKeyCSRName]),
+		Requester: string(secret.Data[approval.SecretKeyRequester]),
+		Hash:      string(secret.Data[approval.SecretKeyHash]),
+		Created:   secret.CreationTimestamp.Time,
+		Message:   string(secret.Data[approval.SecretKeyApprovalMessage]),
+	}
+	if entry.Name == "" {
+		entry.Name = secret.Labels[approval.LabelNetworkPolicyName]
+	}
+	var expires time.Time
+	if notAfter, ok := approval.CertificateNotAfter(secret.Data[approval.SecretKeyCertificate]); ok {
+		expires = notAfter
+	}
+	window, err := approval.AnnotatedWindow(secret.Annotations)
+	if err == nil && !window.NotAfter.IsZero() && (expires.IsZero() || window.NotAfter.Before(expires)) {
+		expires = window.NotAfter
+	}
+	if !expires.IsZero() {
+		entry.Expires = &expires
+		if !now.Before(expires) {
+			entry.State = StateExpired
+		}
+	}
+	if pending, err := approval.PendingWindow(secret.Data); err == nil && len(secret.Data[approval.SecretKeyPendingPrefix+approval.SecretKeyHash]) > 0 {
+		entry.Message = fmt.Sprintf("A new version is approved from %s", pending.NotBefore.UTC().Format(time.RFC3339))
+	}
+	return entry
+}
+
+// requestEntry describes an approval request
+func requestEntry(csr *certificatesv1.CertificateSigningRequest) Entry {
+	entry := Entry{
+		Namespace: csr.Annotations[approval.AnnotationNamespace],
+		Name:      csr.Annotations[approval.AnnotationName],
+		State:     StatePending,
+		CSRName:   csr.Name,
+		Requester: csr.Annotations[approval.AnnotationRequester],
+		Hash:      csr.Annotations[approval.AnnotationApprovalHash],
+		RiskScore: csr.Annotations[approval.AnnotationRiskScore],
+		Created:   csr.CreationTimestamp.Time,
+	}
+	for _, condition := range csr.Status.Conditions {
+		switch condition.Type {
+		case certificatesv1.CertificateApproved:
+			entry.State = StateApproved
+		case certificatesv1.CertificateDenied, certificatesv1.CertificateFailed:
+			entry.State = StateDenied
+		}
+	}
+	if entry.State != StatePending {
+		entry.Message = decision.Status(csr)
+	}
+	return entry
+}
@@ -0,0 +1,199 @@
+// Package decision records approvals and denials of NetworkPolicy approval requests the way approvers make
+// them through the Kubernetes API. The client acts as the approver, so the API server and the
+// CertificateSigningRequest webhook authorize every change as theirs, or as the controller recording the
+// decision of an approver it authorized itself, see package callback.
+package decision
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/hadi2f244/approve-controller/internal/pkg/approval"
+	"github.com/hadi2f244/approve-controller/internal/pkg/authz"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CanApproveFunc reports whether the approver may approve requests for namespace
+type CanApproveFunc func(ctx context.Context, namespace string) (bool, error)
+
+// Decide approves or denies a pending request as user, recording conditionReason on the condition. Requests that
+// need several approvers or approvals for other namespaces only record the approval of user, for the namespaces
+// canApprove allows, until enough were given, progress is written to out. It reports whether the request was decided
+func Decide(ctx context.Context, c client.Client, csr *certificatesv1.CertificateSigningRequest,
+	decision certificatesv1.RequestConditionType, reason, user, conditionReason string, canApprove CanApproveFunc, out io.Writer) (bool, error) {
+	if strings.TrimSpace(reason) == "" {
+		return false, errors.New("a reason is required")
+	}
+	if len(csr.Status.Conditions) > 0 {
+		return false, fmt.Errorf("request %s is already %s", csr.Name, Status(csr))
+	}
+
+	if decision == certificatesv1.CertificateApproved {
+		done, err := recordNamespaceApprovals(ctx, c, csr, user, canApprove, out)
+		if err != nil || !done {
+			return false, err
+		}
+		done, err = recordApprover(ctx, c, csr, user, out)
+		if err != nil || !done {
+			return false, err
+		}
+	}
+
+	message := reason
+	if user != "" {
+		message = fmt.Sprintf("%s (by %s)", reason, user)
+	}
+	csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+		Type:           decision,
+		Status:         corev1.ConditionTrue,
+		Reason:         conditionReason,
+		Message:        message,
+		LastUpdateTime: metav1.Now(),
+	})
+	if err := c.SubResource("approval").Update(ctx, csr); err != nil {
+		return false, fmt.Errorf("failed to update approval of %s: %w", csr.Name, err)
+	}
+	fmt.Fprintf(out, "%s %s (CSR %s)\n", strings.ToLower(string(decision)), Subject(csr), csr.Name)
+	return true, nil
+}
+
+// Subject names what a request asks approval for: the NetworkPolicy as <namespace>/<name>, or the change-set
+func Subject(csr *certificatesv1.CertificateSigningRequest) string {
+	if csr.Labels[approval.LabelNetworkPolicyApproval] == approval.LabelValueChangeSet {
+		return fmt.Sprintf("change-set %s with %d NetworkPolicies", csr.Name, len(approval.ChangeSetMembers(csr.Annotations)))
+	}
+	return fmt.Sprintf("%s/%s", csr.Annotations[approval.AnnotationNamespace], csr.Annotations[approval.AnnotationName])
+}
+
+// recordApprover adds the user to the approvers of a request that needs several approvers.
+// It returns true once enough approvers are recorded for the CSR to be approved.
+func recordApprover(ctx context.Context, c client.Client, csr *certificatesv1.CertificateSigningRequest, user string, out io.Writer) (bool, error) {
+	required := approval.RequiredApprovers(csr.Annotations)
+	if required < 2 {
+		return true, nil
+	}
+	if user == "" {
+		return false, fmt.Errorf("request %s needs %d approvers but your user name cannot be determined", csr.Name, required)
+	}
+	approvers := approval.Approvers(csr.Annotations)
+	if slices.Contains(approvers, user) {
+		return false, fmt.Errorf("%s already approved request %s, it needs %d distinct approvers", user, csr.Name, required)
+	}
+
+	patch := client.MergeFrom(csr.DeepCopy())
+	approvers = append(approvers, user)
+	csr.Annotations[approval.AnnotationApprovers] = strings.Join(approvers, ",")
+	if err := c.Patch(ctx, csr, patch); err != nil {
+		return false, fmt.Errorf("failed to record approver: %w", err)
+	}
+	if len(approvers) < required {
+		fmt.Fprintf(out, "recorded approval of %s (%d/%d), waiting for more approvers\n", user, len(approvers), required)
+		return false, nil
+	}
+	return true, nil
+}
+
+// recordNamespaceApprovals approves a request affecting other namespaces for those the user may approve in.
+// It returns true once every affected namespace was approved for and the user may approve the request itself.
+func recordNamespaceApprovals(ctx context.Context, c client.Client, csr *certificatesv1.CertificateSigningRequest, user string,
+	canApprove CanApproveFunc, out io.Writer) (bool, error) {
+	if len(approval.AffectedNamespaces(csr.Annotations)) == 0 {
+		return true, nil
+	}
+	pending := approval.PendingNamespaces(csr.Annotations)
+	if user == "" {
+		return false, fmt.Errorf("request %s affects other namespaces but your user name cannot be determined", csr.Name)
+	}
+
+	approvals := approval.NamespaceApprovals(csr.Annotations)
+	var recorded []string
+	for _, namespace := range pending {
+		allowed, err := canApprove(ctx, namespace)
+		if err != nil {
+			return false, err
+		}
+		if allowed {
+			approvals[namespace] = user
+			recorded = append(recorded, namespace)
+		}
+	}
+	if len(recorded) > 0 {
+		patch := client.MergeFrom(csr.DeepCopy())
+		csr.Annotations[approval.AnnotationNamespaceApprovals] = approval.EncodeNamespaceApprovals(approvals)
+		if err := c.Patch(ctx, csr, patch); err != nil {
+			return false, fmt.Errorf("failed to record namespace approvals: %w", err)
+		}
+		fmt.Fprintf(out, "recorded approval of %s for namespaces %s\n", user, strings.Join(recorded, ", "))
+	}
+
+	if pending = approval.PendingNamespaces(csr.Annotations); len(pending) > 0 {
+		if len(recorded) == 0 {
+			return false, fmt.Errorf("%s may not approve requests for namespaces %s", user, strings.Join(pending, ", "))
+		}
+		fmt.Fprintf(out, "waiting for approvals for namespaces %s\n", strings.Join(pending, ", "))
+		return false, nil
+	}
+	namespace := csr.Annotations[approval.AnnotationNamespace]
+	allowed, err := canApprove(ctx, namespace)
+	if err != nil {
+		return false, err
+	}
+	if !allowed {
+		if len(recorded) == 0 {
+			return false, fmt.Errorf("%s may not approve requests of namespace %s", user, namespace)
+		}
+		fmt.Fprintf(out, "waiting for an approver of namespace %s\n", namespace)
+		return false, nil
+	}
+	return true, nil
+}
+
+// SelfCanApprove returns a CanApproveFunc checking the permissions of the user of c
+func SelfCanApprove(c client.Client) CanApproveFunc {
+	return func(ctx context.Context, namespace string) (bool, error) {
+		return CanApprove(ctx, c, namespace)
+	}
+}
+
+// CanApprove reports whether the user of c may approve requests for namespace
+func CanApprove(ctx context.Context, c client.Client, namespace string) (bool, error) {
+	if namespace == approval.AllNamespaces {
+		namespace = ""
+	}
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      authz.VerbApprove,
+				Group:     authz.Group,
+				Resource:  authz.Resource,
+			},
+		},
+	}
+	if err := c.Create(ctx, review); err != nil {
+		return false, fmt.Errorf("failed to check the permissions of the approver: %w", err)
+	}
+	return review.Status.Allowed, nil
+}
+
+// Status describes the decision of a request, Pending if there is none
+func Status(csr *certificatesv1.CertificateSigningRequest) string {
+	for _, condition := range csr.Status.Conditions {
+		switch condition.Type {
+		case certificatesv1.CertificateApproved, certificatesv1.CertificateDenied, certificatesv1.CertificateFailed:
+			if condition.Message != "" {
+				return fmt.Sprintf("%s: %s", condition.Type, condition.Message)
+			}
+			return string(condition.Type)
+		}
+	}
+	return "Pending"
+}
@@ -0,0 +1,200 @@
+// Package events emits Kubernetes Events about approval requests on the objects developers look at:
+// the NetworkPolicy itself, or its namespace when the policy was rejected and does not exist.
+package events
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hadi2f244/approve-controller/internal/pkg/notify"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Event reasons of the approval lifecycle
+const (
+	ReasonRequestFiled      = "ApprovalRequested"
+	ReasonApproved          = "ApprovalGranted"
+	ReasonDenied            = "ApprovalDenied"
+	ReasonExpired           = "ApprovalExpired"
+	ReasonRevoked           = "ApprovalRevoked"
+	ReasonBreakGlass        = "BreakGlassUsed"
+	ReasonBreakGlassExpired = "BreakGlassExpired"
+	ReasonScheduled         = "ApprovalScheduled"
+	ReasonActivated         = "ApprovalActivated"
+	ReasonExpiring          = "ApprovalExpiring"
+	ReasonRolledBack        = "RolledBack"
+	ReasonRollbackFailed    = "RollbackFailed"
+	ReasonDriftDetected     = "DriftDetected"
+	ReasonDriftReverted     = "DriftReverted"
+)
+
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+
+// Emitter emits approval lifecycle Events
+type Emitter struct {
+	Client   client.Reader
+	Recorder record.EventRecorder
+	// Notifier is told about filed, approved, denied and expiring requests, rollbacks and drift, if set
+	Notifier *notify.Dispatcher
+}
+
+// NewEmitter returns an Emitter that looks up NetworkPolicies with reader
+func NewEmitter(reader client.Reader, recorder record.EventRecorder) *Emitter {
+	return &Emitter{Client: reader, Recorder: recorder}
+}
+
+// RequestFiled reports that an approval request was created for the version of the NetworkPolicy with hash
+func (e *Emitter) RequestFiled(ctx context.Context, namespace, name, csrName, hash string) {
+	e.emit(ctx, namespace, name, corev1.EventTypeNormal, ReasonRequestFiled,
+		"Approval requested with CSR %s, ask an administrator to approve it", csrName)
+	if e == nil {
+		return
+	}
+	e.Notifier.Notify(ctx, notify.Notification{
+		Type:      notify.TypeCreated,
+		Namespace: namespace,
+		Name:      name,
+		CSRName:   csrName,
+		Hash:      hash,
+		Message:   fmt.Sprintf("Approval was requested with CSR %s", csrName),
+	})
+}
+
+// Approved reports that the approval request of the NetworkPolicy was approved
+func (e *Emitter) Approved(ctx context.Context, namespace, name, csrName string) {
+	e.emit(ctx, namespace, name, corev1.EventTypeNormal, ReasonApproved,
+		"CSR %s was approved, the NetworkPolicy can be applied", csrName)
+	e.notify(ctx, notify.TypeApproved, namespace, name, csrName, "CSR %s was approved, the NetworkPolicy can be applied", csrName)
+}
+
+// Scheduled reports that the approval request of the NetworkPolicy was approved to take effect at notBefore
+func (e *Emitter) Scheduled(ctx context.Context, namespace, name, csrName string, notBefore time.Time) {
+	e.emit(ctx, namespace, name, corev1.EventTypeNormal, ReasonScheduled,
+		"CSR %s was approved for %s, the NetworkPolicy is applied then", csrName, notBefore.UTC().Format(time.RFC3339))
+	e.notify(ctx, notify.TypeApproved, namespace, name, csrName,
+		"CSR %s was approved for %s, the NetworkPolicy is applied then", csrName, notBefore.UTC().Format(time.RFC3339))
+}
+
+// Activated reports that a scheduled approval took effect and its NetworkPolicy was applied
+func (e *Emitter) Activated(ctx context.Context, namespace, name, csrName string) {
+	e.emit(ctx, namespace, name, corev1.EventTypeNormal, ReasonActivated,
+		"Scheduled approval of CSR %s took effect, the approved NetworkPolicy was applied", csrName)
+}
+
+// Denied reports that the approval request of the NetworkPolicy was denied
+func (e *Emitter) Denied(ctx context.Context, namespace, name, csrName, message string) {
+	e.emit(ctx, namespace, name, corev1.EventTypeWarning, ReasonDenied,
+		"CSR %s was denied: %s", csrName, message)
+	e.notify(ctx, notify.TypeDenied, namespace, name, csrName, "CSR %s was denied: %s", csrName, message)
+}
+
+// Expired reports that the approval of the NetworkPolicy is no longer valid
+func (e *Emitter) Expired(ctx context.Context, namespace, name, reason string) {
+	e.emit(ctx, namespace, name, corev1.EventTypeWarning, ReasonExpired,
+		"Approval expired: %s, changes require a new approval", reason)
+}
+
+// Expiring reports that the approval of the NetworkPolicy expires at the given time
+func (e *Emitter) Expiring(ctx context.Context, namespace, name, csrName string, at time.Time) {
+	e.emit(ctx, namespace, name, corev1.EventTypeWarning, ReasonExpiring,
+		"Approval expires at %s, request a new one to change the NetworkPolicy afterwards", at.UTC().Format(time.RFC3339))
+	e.notify(ctx, notify.TypeExpiring, namespace, name, csrName,
+		"Approval expires at %s, request a new one to change the NetworkPolicy afterwards", at.UTC().Format(time.RFC3339))
+}
+
+// Revoked reports that the approval of the NetworkPolicy was removed
+func (e *Emitter) Revoked(ctx context.Context, namespace, name, reason string) {
+	e.emit(ctx, namespace, name, corev1.EventTypeWarning, ReasonRevoked,
+		"Approval revoked: %s", reason)
+}
+
+// RolledBack reports that the NetworkPolicy was rolled back from the approved version previous to the one with
+// hash approved at approvedAt, for incident
+func (e *Emitter) RolledBack(ctx context.Context, namespace, name, previous, hash string, approvedAt time.Time, incident string) {
+	e.emit(ctx, namespace, name, corev1.EventTypeWarning, ReasonRolledBack,
+		"Rolled back for incident %s from hash %s to hash %s, approved at %s", incident, previous, hash, approvedAt.UTC().Format(time.RFC3339))
+	e.notify(ctx, notify.TypeRollback, namespace, name, "",
+		"Rolled back for incident %s from hash %s to hash %s, approved at %s", incident, previous, hash, approvedAt.UTC().Format(time.RFC3339))
+}
+
+// RollbackFailed reports that the NetworkPolicy could not be rolled back to the approved version with hash
+func (e *Emitter) RollbackFailed(ctx context.Context, namespace, name, hash, reason string) {
+	e.emit(ctx, namespace, name, corev1.EventTypeWarning, ReasonRollbackFailed,
+		"Rollback to hash %s failed: %s", hash, reason)
+	e.notify(ctx, notify.TypeRollback, namespace, name, "", "Rollback to hash %s failed: %s", hash, reason)
+}
+
+// DriftDetected reports that the NetworkPolicy with hash does not match the approved hash, empty if it has
+// no valid approval
+func (e *Emitter) DriftDetected(ctx context.Context, namespace, name, hash, approvedHash string) {
+	message := fmt.Sprintf("NetworkPolicy hash %s does not match the approved hash %s", hash, approvedHash)
+	if approvedHash == "" {
+		message = fmt.Sprintf("NetworkPolicy with hash %s has no valid approval", hash)
+	}
+	e.emit(ctx, namespace, name, corev1.EventTypeWarning, ReasonDriftDetected, "%s", message)
+	e.notify(ctx, notify.TypeDrift, namespace, name, "", "%s", message)
+}
+
+// DriftReverted reports that the drifted NetworkPolicy was reverted to its approved spec
+func (e *Emitter) DriftReverted(ctx context.Context, namespace, name string) {
+	e.emit(ctx, namespace, name, corev1.EventTypeNormal, ReasonDriftReverted, "NetworkPolicy was reverted to its approved spec")
+	e.notify(ctx, notify.TypeDrift, namespace, name, "", "NetworkPolicy was reverted to its approved spec")
+}
+
+// BreakGlass reports that the NetworkPolicy was admitted without approval until expires
+func (e *Emitter) BreakGlass(ctx context.Context, namespace, name, csrName, user, justification string, expires time.Time) {
+	e.emit(ctx, namespace, name, corev1.EventTypeWarning, ReasonBreakGlass,
+		"%s admitted the NetworkPolicy without approval: %s. CSR %s has to be approved by %s or the change is rolled back",
+		user, justification, csrName, expires.UTC().Format(time.RFC3339))
+}
+
+// BreakGlassExpired reports that a break-glass change was rolled back
+func (e *Emitter) BreakGlassExpired(ctx context.Context, namespace, name, csrName, action string) {
+	e.emit(ctx, namespace, name, corev1.EventTypeWarning, ReasonBreakGlassExpired,
+		"CSR %s was not approved within the break-glass window, the NetworkPolicy was %s", csrName, action)
+}
+
+// notify hands the event to the Notifier
+func (e *Emitter) notify(ctx context.Context, t notify.Type, namespace, name, csrName, messageFmt string, args ...interface{}) {
+	if e == nil {
+		return
+	}
+	e.Notifier.Notify(ctx, notify.Notification{
+		Type:      t,
+		Namespace: namespace,
+		Name:      name,
+		CSRName:   csrName,
+		Message:   fmt.Sprintf(messageFmt, args...),
+	})
+}
+
+// emit records the Event on the NetworkPolicy if it exists and on its namespace otherwise
+func (e *Emitter) emit(ctx context.Context, namespace, name, eventType, reason, messageFmt string, args ...interface{}) {
+	if e == nil || e.Recorder == nil {
+		return
+	}
+	message := fmt.Sprintf(messageFmt, args...)
+
+	np := &networkingv1.NetworkPolicy{}
+	err := e.Client.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, np)
+	if err == nil {
+		e.Recorder.Event(np, eventType, reason, message)
+		return
+	}
+	if client.IgnoreNotFound(err) != nil {
+		logf.FromContext(ctx).Error(err, "Failed to get NetworkPolicy for event", "networkpolicy", name, "namespace", namespace)
+	}
+
+	ns := &corev1.Namespace{}
+	if err := e.Client.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		logf.FromContext(ctx).Error(err, "Failed to get namespace for event", "namespace", namespace)
+		return
+	}
+	e.Recorder.Eventf(ns, eventType, reason, "NetworkPolicy %s: %s", name, message)
+}
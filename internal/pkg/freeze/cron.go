@@ -0,0 +1,118 @@
+package freeze
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule is a parsed five field cron expression: minute hour day-of-month month day-of-week
+type schedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny record a * field, cron matches either day field when both are restricted
+	domAny, dowAny bool
+}
+
+// cronField is the range of a cron field
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	// 7 is Sunday as well
+	{"day of week", 0, 7},
+}
+
+// parseSchedule parses a cron expression with *, lists, ranges and steps, e.g. "0 18 * * 5" or "*/15 9-17 * * 1-5"
+func parseSchedule(expression string) (*schedule, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression %q has %d fields, expected minute hour day-of-month month day-of-week",
+			expression, len(fields))
+	}
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		parsed, err := parseField(field, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %w", expression, err)
+		}
+		bits[i] = parsed
+	}
+	s := &schedule{
+		minute: bits[0], hour: bits[1], dom: bits[2], month: bits[3], dow: bits[4],
+		domAny: fields[2] == "*", dowAny: fields[4] == "*",
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+// parseField returns the values of a cron field as a bit set
+func parseField(field string, spec cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if before, after, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.Atoi(after)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q in %s field", after, spec.name)
+			}
+			rangePart, step = before, n
+		}
+		low, high := spec.min, spec.max
+		if rangePart != "*" {
+			lowText, highText, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = strconv.Atoi(lowText); err != nil {
+				return 0, fmt.Errorf("invalid value %q in %s field", lowText, spec.name)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(highText); err != nil {
+					return 0, fmt.Errorf("invalid value %q in %s field", highText, spec.name)
+				}
+			} else if step > 1 {
+				// "5/15" starts at 5 and runs to the end of the range
+				high = spec.max
+			}
+		}
+		if low < spec.min || high > spec.max || low > high {
+			return 0, fmt.Errorf("%s field %q is outside %d-%d", spec.name, rangePart, spec.min, spec.max)
+		}
+		for value := low; value <= high; value += step {
+			bits |= 1 << value
+		}
+	}
+	return bits, nil
+}
+
+// matches reports whether the schedule fires at the minute of t, in t's location
+func (s *schedule) matches(t time.Time) bool {
+	if s.minute&(1<<t.Minute()) == 0 || s.hour&(1<<t.Hour()) == 0 || s.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+	domMatch := s.dom&(1<<t.Day()) != 0
+	dowMatch := s.dow&(1<<int(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// lastStart returns the latest time in (now-lookback, now] the schedule fired at, false if it did not
+func (s *schedule) lastStart(now time.Time, lookback time.Duration) (time.Time, bool) {
+	earliest := now.Add(-lookback)
+	for t := now.Truncate(time.Minute); t.After(earliest); t = t.Add(-time.Minute) {
+		if s.matches(t) {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,220 @@
+// Package freeze blocks or escalates NetworkPolicy changes during change freezes, e.g. release weekends
+// or holidays, configured as recurring cron schedules or one-off periods in the operator configuration.
+package freeze
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Action is what happens to NetworkPolicy changes during a freeze
+type Action string
+
+const (
+	// ActionReject rejects every change that is not approved yet
+	ActionReject Action = "reject"
+	// ActionEscalate files requests that only members of the window's approver groups may approve
+	ActionEscalate Action = "escalate"
+)
+
+// dateLayouts are accepted for one-off freezes besides RFC3339
+var dateLayouts = []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"}
+
+// Window is a recurring or one-off change freeze
+type Window struct {
+	// Name identifies the freeze in messages and approval requests
+	Name string `mapstructure:"name"`
+	// Schedule is a cron expression (minute hour day-of-month month day-of-week) at which a recurring freeze starts
+	Schedule string `mapstructure:"schedule"`
+	// Duration is how long each occurrence of Schedule lasts, e.g. 60h
+	Duration time.Duration `mapstructure:"duration"`
+	// Start and End delimit a one-off freeze as RFC3339 or 2006-01-02[ 15:04]; a date-only End includes the whole day
+	Start string `mapstructure:"start"`
+	End   string `mapstructure:"end"`
+	// Timezone is the IANA time zone of Schedule, Start and End, UTC if empty
+	Timezone string `mapstructure:"timezone"`
+	// Namespaces the freeze applies to, every namespace if empty
+	Namespaces []string `mapstructure:"namespaces"`
+	// Action taken on changes during the freeze, reject if empty
+	Action Action `mapstructure:"action"`
+	// ApproverGroups may approve requests filed during an escalating freeze
+	ApproverGroups []string `mapstructure:"approverGroups"`
+	// Message is shown to requesters during the freeze
+	Message string `mapstructure:"message"`
+}
+
+// Occurrence is a freeze that is in effect
+type Occurrence struct {
+	Window
+	// Until is the end of the occurrence
+	Until time.Time
+}
+
+// String describes the occurrence for rejection messages
+func (o Occurrence) String() string {
+	description := fmt.Sprintf("change freeze %s is active until %s", o.Name, o.Until.UTC().Format(time.RFC3339))
+	if o.Message != "" {
+		description += ": " + o.Message
+	}
+	return description
+}
+
+type compiledWindow struct {
+	Window
+	location   *time.Location
+	schedule   *schedule
+	start, end time.Time
+}
+
+// compile validates the window and parses its schedule and dates
+func compile(w Window) (compiledWindow, error) {
+	c := compiledWindow{Window: w}
+	if w.Name == "" {
+		return c, fmt.Errorf("freeze window has no name")
+	}
+	switch w.Action {
+	case "":
+		c.Action = ActionReject
+	case ActionReject:
+	case ActionEscalate:
+		if len(w.ApproverGroups) == 0 {
+			return c, fmt.Errorf("freeze window %s escalates but has no approverGroups", w.Name)
+		}
+	default:
+		return c, fmt.Errorf("freeze window %s: unknown action %q, expected %s or %s", w.Name, w.Action, ActionReject, ActionEscalate)
+	}
+
+	var err error
+	if c.location, err = time.LoadLocation(w.Timezone); err != nil {
+		return c, fmt.Errorf("freeze window %s: %w", w.Name, err)
+	}
+
+	switch {
+	case w.Schedule != "" && (w.Start != "" || w.End != ""):
+		return c, fmt.Errorf("freeze window %s has both a schedule and start or end, use separate windows", w.Name)
+	case w.Schedule != "":
+		if w.Duration <= 0 {
+			return c, fmt.Errorf("freeze window %s has a schedule but no duration", w.Name)
+		}
+		if c.schedule, err = parseSchedule(w.Schedule); err != nil {
+			return c, fmt.Errorf("freeze window %s: %w", w.Name, err)
+		}
+	case w.Start != "" && w.End != "":
+		if c.start, err = parseDate(w.Start, c.location, false); err != nil {
+			return c, fmt.Errorf("freeze window %s: %w", w.Name, err)
+		}
+		if c.end, err = parseDate(w.End, c.location, true); err != nil {
+			return c, fmt.Errorf("freeze window %s: %w", w.Name, err)
+		}
+		if !c.end.After(c.start) {
+			return c, fmt.Errorf("freeze window %s ends before it starts", w.Name)
+		}
+	default:
+		return c, fmt.Errorf("freeze window %s needs either a schedule and duration or a start and end", w.Name)
+	}
+	return c, nil
+}
+
+// parseDate parses a one-off freeze date, a date without a time of day ends at midnight of the next day if end is set
+func parseDate(value string, location *time.Location, end bool) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		t, err := time.ParseInLocation(layout, value, location)
+		if err != nil {
+			continue
+		}
+		if end && layout == "2006-01-02" {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q, expected RFC3339 or 2006-01-02[ 15:04]", value)
+}
+
+// occurrence returns the occurrence of the window in effect at now, false if there is none
+func (c compiledWindow) occurrence(now time.Time) (Occurrence, bool) {
+	if c.schedule != nil {
+		start, ok := c.schedule.lastStart(now.In(c.location), c.Duration)
+		return Occurrence{Window: c.Window, Until: start.Add(c.Duration)}, ok
+	}
+	if !now.Before(c.start) && now.Before(c.end) {
+		return Occurrence{Window: c.Window, Until: c.end}, true
+	}
+	return Occurrence{}, false
+}
+
+// Validate checks every window
+func Validate(windows []Window) error {
+	names := map[string]bool{}
+	for _, window := range windows {
+		if _, err := compile(window); err != nil {
+			return err
+		}
+		if names[window.Name] {
+			return fmt.Errorf("duplicate freeze window %s", window.Name)
+		}
+		names[window.Name] = true
+	}
+	return nil
+}
+
+// Calendar holds the freeze windows, they can be replaced while the calendar is in use
+type Calendar struct {
+	mu      sync.RWMutex
+	windows []compiledWindow
+}
+
+// NewCalendar returns a Calendar for the windows, it fails if any window is invalid
+func NewCalendar(windows []Window) (*Calendar, error) {
+	c := &Calendar{}
+	if err := c.SetWindows(windows); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetWindows replaces the windows, e.g. after the configuration was reloaded. The previous windows are
+// kept if any of the new ones is invalid
+func (c *Calendar) SetWindows(windows []Window) error {
+	if err := Validate(windows); err != nil {
+		return err
+	}
+	compiled := make([]compiledWindow, 0, len(windows))
+	for _, window := range windows {
+		w, _ := compile(window)
+		compiled = append(compiled, w)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.windows = compiled
+	return nil
+}
+
+// Active returns the freeze in effect for namespace at now, false if there is none. A rejecting freeze
+// wins over an escalating one, otherwise the first configured window is returned
+func (c *Calendar) Active(namespace string, now time.Time) (Occurrence, bool) {
+	if c == nil {
+		return Occurrence{}, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var active Occurrence
+	found := false
+	for _, window := range c.windows {
+		if len(window.Namespaces) > 0 && !slices.Contains(window.Namespaces, namespace) {
+			continue
+		}
+		occurrence, ok := window.occurrence(now)
+		if !ok {
+			continue
+		}
+		if occurrence.Action == ActionReject {
+			return occurrence, true
+		}
+		if !found {
+			active, found = occurrence, true
+		}
+	}
+	return active, found
+}
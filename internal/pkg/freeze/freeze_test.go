@@ -0,0 +1,119 @@
+package freeze
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	tests := map[string]struct {
+		expression string
+		time       string
+		want       bool
+	}{
+		"every minute":              {expression: "* * * * *", time: "2025-03-07T10:11:00Z", want: true},
+		"friday evening":            {expression: "0 18 * * 5", time: "2025-03-07T18:00:00Z", want: true},
+		"friday other minute":       {expression: "0 18 * * 5", time: "2025-03-07T18:01:00Z"},
+		"sunday as 7":               {expression: "0 0 * * 7", time: "2025-03-09T00:00:00Z", want: true},
+		"step":                      {expression: "*/15 * * * *", time: "2025-03-07T10:45:00Z", want: true},
+		"step off":                  {expression: "*/15 * * * *", time: "2025-03-07T10:46:00Z"},
+		"range and list":            {expression: "0 9-17 * 12 1,3", time: "2025-12-03T12:00:00Z", want: true},
+		"day of month or weekday":   {expression: "0 0 1 * 1", time: "2025-03-10T00:00:00Z", want: true},
+		"restricted day not monday": {expression: "0 0 1 * 1", time: "2025-03-11T00:00:00Z"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s, err := parseSchedule(test.expression)
+			if err != nil {
+				t.Fatalf("parseSchedule() error = %v", err)
+			}
+			at, err := time.Parse(time.RFC3339, test.time)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.matches(at); got != test.want {
+				t.Errorf("matches(%s) = %v, want %v", test.time, got, test.want)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "a * * * *", "5-1 * * * *"} {
+		if _, err := parseSchedule(invalid); err == nil {
+			t.Errorf("parseSchedule(%q) succeeded", invalid)
+		}
+	}
+}
+
+func TestCalendar(t *testing.T) {
+	calendar, err := NewCalendar([]Window{
+		{
+			// Friday 18:00 to Monday 06:00 in Berlin
+			Name: "weekend", Schedule: "0 18 * * 5", Duration: 60 * time.Hour, Timezone: "Europe/Berlin",
+			Action: ActionEscalate, ApproverGroups: []string{"change-board"},
+		},
+		{Name: "holidays", Start: "2025-12-24", End: "2025-12-26", Namespaces: []string{"shop"}, Message: "happy holidays"},
+	})
+	if err != nil {
+		t.Fatalf("NewCalendar() error = %v", err)
+	}
+
+	tests := map[string]struct {
+		namespace string
+		time      string
+		want      string
+		until     string
+	}{
+		"before the weekend":     {namespace: "shop", time: "2025-03-07T16:59:00Z"},
+		"weekend starts":         {namespace: "shop", time: "2025-03-07T17:00:00Z", want: "weekend", until: "2025-03-10T05:00:00Z"},
+		"sunday":                 {namespace: "shop", time: "2025-03-09T12:00:00Z", want: "weekend", until: "2025-03-10T05:00:00Z"},
+		"weekend over":           {namespace: "shop", time: "2025-03-10T05:00:00Z"},
+		"holidays":               {namespace: "shop", time: "2025-12-26T23:59:00Z", want: "holidays", until: "2025-12-27T00:00:00Z"},
+		"holidays win":           {namespace: "shop", time: "2025-12-26T20:00:00Z", want: "holidays", until: "2025-12-27T00:00:00Z"},
+		"holidays other project": {namespace: "billing", time: "2025-12-24T12:00:00Z"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			now, err := time.Parse(time.RFC3339, test.time)
+			if err != nil {
+				t.Fatal(err)
+			}
+			occurrence, ok := calendar.Active(test.namespace, now)
+			if ok != (test.want != "") {
+				t.Fatalf("Active() = %v, want %q", ok, test.want)
+			}
+			if !ok {
+				return
+			}
+			if occurrence.Name != test.want {
+				t.Errorf("Active() = %s, want %s", occurrence.Name, test.want)
+			}
+			if until := occurrence.Until.UTC().Format(time.RFC3339); until != test.until {
+				t.Errorf("Until = %s, want %s", until, test.until)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := map[string]Window{
+		"no name":               {Schedule: "0 18 * * 5", Duration: time.Hour},
+		"no duration":           {Name: "w", Schedule: "0 18 * * 5"},
+		"schedule and dates":    {Name: "w", Schedule: "0 18 * * 5", Duration: time.Hour, Start: "2025-01-01", End: "2025-01-02"},
+		"neither":               {Name: "w"},
+		"ends before start":     {Name: "w", Start: "2025-01-02", End: "2025-01-01 12:00"},
+		"unknown timezone":      {Name: "w", Start: "2025-01-01", End: "2025-01-02", Timezone: "Mars/Olympus"},
+		"unknown action":        {Name: "w", Start: "2025-01-01", End: "2025-01-02", Action: "pause"},
+		"escalate to no groups": {Name: "w", Start: "2025-01-01", End: "2025-01-02", Action: ActionEscalate},
+	}
+	for name, window := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := Validate([]Window{window}); err == nil {
+				t.Error("Validate() succeeded")
+			}
+		})
+	}
+	valid := Window{Name: "w", Start: "2025-01-01", End: "2025-01-02"}
+	if err := Validate([]Window{valid, valid}); err == nil {
+		t.Error("Validate() accepted duplicate windows")
+	}
+}
@@ -0,0 +1,49 @@
+// Package httpserver runs the additional HTTP endpoints of the manager, e.g. approval callbacks and the dashboard.
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// shutdownTimeout bounds how long in-flight requests may take once the manager stops
+const shutdownTimeout = 10 * time.Second
+
+// Server serves Handler on Address until the manager stops. It is a manager Runnable
+type Server struct {
+	// Name identifies the server in logs and errors
+	Name    string
+	Address string
+	Handler http.Handler
+}
+
+// Start serves until ctx is done
+func (s *Server) Start(ctx context.Context) error {
+	server := &http.Server{Addr: s.Address, Handler: s.Handler, ReadHeaderTimeout: 10 * time.Second}
+	errs := make(chan error, 1)
+	go func() {
+		logf.FromContext(ctx).Info("Serving "+s.Name, "address", s.Address)
+		errs <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-errs:
+		return fmt.Errorf("%s server failed: %w", s.Name, err)
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, every replica serves requests
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
@@ -0,0 +1,121 @@
+// Package metrics defines the Prometheus metrics of the approval pipeline. They are registered
+// on the controller-runtime registry and served by the manager's metrics endpoint.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "networkpolicy_approval"
+
+// Admission decisions reported by AdmissionDecisions
+const (
+	DecisionApproved = "approved"
+	DecisionPending  = "pending"
+	DecisionDenied   = "denied"
+	// DecisionBreakGlass is an admission without approval during an incident
+	DecisionBreakGlass = "break-glass"
+)
+
+// Notification delivery results reported by Notifications
+const (
+	NotificationDelivered    = "delivered"
+	NotificationDeadLettered = "dead-lettered"
+)
+
+// Webhook operations reported by WebhookDuration
+const (
+	OperationValidate = "validate"
+	OperationKeyGen   = "keygen"
+)
+
+var (
+	// AdmissionDecisions counts the decisions of the validating webhook
+	AdmissionDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "admission_decisions_total",
+		Help:      "Number of NetworkPolicy admission decisions by namespace and decision.",
+	}, []string{"namespace", "decision"})
+
+	// PendingRequests is the number of approval CSRs that are neither approved nor denied
+	PendingRequests = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pending_requests",
+		Help:      "Number of pending NetworkPolicy approval requests by namespace.",
+	}, []string{"namespace"})
+
+	// OldestPendingRequestAge is the age of the oldest pending approval CSR
+	OldestPendingRequestAge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "oldest_pending_request_age_seconds",
+		Help:      "Age of the oldest pending NetworkPolicy approval request by namespace.",
+	}, []string{"namespace"})
+
+	// TimeToApproval observes the time between filing and approving a request
+	TimeToApproval = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "time_to_approval_seconds",
+		Help:      "Time between the creation and the approval of a NetworkPolicy approval request.",
+		// 1 minute up to ~1 week
+		Buckets: prometheus.ExponentialBuckets(60, 4, 8),
+	}, []string{"namespace"})
+
+	// CertificateExpiry is the expiry of the certificate issued for an approval
+	CertificateExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "certificate_expiry_timestamp_seconds",
+		Help:      "Unix time at which the certificate of a NetworkPolicy approval expires.",
+	}, []string{"namespace", "name"})
+
+	// GCDeletions counts approval secrets removed by the garbage collection
+	GCDeletions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "gc_deletions_total",
+		Help:      "Number of orphaned approval secrets deleted.",
+	}, []string{"namespace"})
+
+	// WebhookDuration observes the latency of the webhook and its expensive steps
+	WebhookDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "webhook_duration_seconds",
+		Help:      "Latency of NetworkPolicy webhook operations, including RSA key generation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	// NetworkPolicyDrift is 1 for every live NetworkPolicy whose hash does not match its approval
+	NetworkPolicyDrift = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "drift",
+		Help:      "Whether a live NetworkPolicy differs from its approved version (1) or not (0).",
+	}, []string{"namespace", "name"})
+
+	// DriftRemediations counts the remediation actions taken on drifted NetworkPolicies
+	DriftRemediations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "drift_remediations_total",
+		Help:      "Number of remediation actions taken on drifted NetworkPolicies.",
+	}, []string{"namespace", "action"})
+
+	// Notifications counts notifications by sink and whether they were delivered or dead-lettered
+	Notifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_total",
+		Help:      "Number of approval notifications by sink and result.",
+	}, []string{"sink", "result"})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(
+		AdmissionDecisions,
+		PendingRequests,
+		OldestPendingRequestAge,
+		TimeToApproval,
+		CertificateExpiry,
+		GCDeletions,
+		WebhookDuration,
+		NetworkPolicyDrift,
+		DriftRemediations,
+		Notifications,
+	)
+}
@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// DeadLetter is a notification that could not be delivered to a sink
+type DeadLetter struct {
+	Time         time.Time    `json:"time"`
+	Sink         string       `json:"sink,omitempty"`
+	Attempts     int          `json:"attempts"`
+	Error        string       `json:"error"`
+	Notification Notification `json:"notification"`
+}
+
+// DeadLetterWriter records dead letters
+type DeadLetterWriter interface {
+	Write(letter DeadLetter) error
+}
+
+// DeadLetterFile appends dead letters as JSON lines to a file
+type DeadLetterFile struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+var _ DeadLetterWriter = &DeadLetterFile{}
+
+// NewDeadLetterFile opens or creates the dead letter file at path
+func NewDeadLetterFile(path string) (*DeadLetterFile, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dead letter file: %w", err)
+	}
+	return &DeadLetterFile{file: file}, nil
+}
+
+// Write implements DeadLetterWriter
+func (f *DeadLetterFile) Write(letter DeadLetter) error {
+	line, err := json.Marshal(letter)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter: %w", err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write dead letter: %w", err)
+	}
+	return nil
+}
+
+// Close closes the underlying file
+func (f *DeadLetterFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
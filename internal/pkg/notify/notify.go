@@ -0,0 +1,243 @@
+// Package notify tells approvers and requesters about approval requests through configurable sinks:
+// signed HTTP webhooks, Slack or Teams incoming webhooks and email. Deliveries are retried with
+// exponential backoff and recorded as dead letters once every attempt failed.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/hadi2f244/approve-controller/internal/pkg/metrics"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Type is the approval lifecycle event a notification is about
+type Type string
+
+const (
+	// TypeCreated is sent when an approval request is filed
+	TypeCreated Type = "created"
+	// TypeApproved is sent when a request is approved
+	TypeApproved Type = "approved"
+	// TypeDenied is sent when a request is denied
+	TypeDenied Type = "denied"
+	// TypeExpiring is sent once when an approval is about to expire
+	TypeExpiring Type = "expiring"
+	// TypeRollback is sent when a NetworkPolicy is rolled back to an approved version or the rollback fails
+	TypeRollback Type = "rollback"
+	// TypeDrift is sent when a NetworkPolicy drifted from its approval or was reverted to it
+	TypeDrift Type = "drift"
+)
+
+// Notification describes an approval lifecycle event of a NetworkPolicy
+type Notification struct {
+	Type      Type      `json:"type"`
+	Time      time.Time `json:"time"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	CSRName   string    `json:"csrName,omitempty"`
+	// Hash identifies the requested version of the NetworkPolicy
+	Hash    string `json:"hash,omitempty"`
+	Message string `json:"message"`
+	// ApproveURL and DenyURL decide a created request with one click, set for sinks that have an approver
+	ApproveURL string `json:"approveURL,omitempty"`
+	DenyURL    string `json:"denyURL,omitempty"`
+}
+
+// Subject summarizes the notification in one line, e.g. for email subjects and chat messages
+func (n Notification) Subject() string {
+	return fmt.Sprintf("NetworkPolicy %s/%s: approval %s", n.Namespace, n.Name, n.Type)
+}
+
+// Sink delivers notifications to one destination
+type Sink interface {
+	Send(ctx context.Context, n Notification) error
+}
+
+const (
+	defaultMaxAttempts    = 5
+	defaultInitialBackoff = 2 * time.Second
+	// queueSize bounds the notifications waiting for delivery, further ones are dead-lettered
+	queueSize = 256
+)
+
+// Options tune the delivery of a Dispatcher
+type Options struct {
+	// MaxAttempts is how often a notification is sent to a sink before it is dead-lettered, 5 if zero
+	MaxAttempts int
+	// InitialBackoff is the wait after the first failed attempt, it doubles after every further one, 2s if zero
+	InitialBackoff time.Duration
+	// DeadLetters records notifications that could not be delivered, they are only logged if nil
+	DeadLetters DeadLetterWriter
+	// Links signs approve and deny links for sinks that have an approver, no links are sent if nil
+	Links LinkIssuer
+}
+
+// LinkIssuer returns links that approve and deny the request of a notification on behalf of approver
+type LinkIssuer interface {
+	Links(n Notification, approver string, groups []string) (approveURL, denyURL string, err error)
+}
+
+// route is a sink, the notification types it receives and the approver its recipients act as
+type route struct {
+	name           string
+	types          []Type
+	sink           Sink
+	approver       string
+	approverGroups []string
+}
+
+// Dispatcher queues notifications and delivers them to every sink subscribed to their type in the background.
+// It is a manager Runnable, notifications are delivered while it is started
+type Dispatcher struct {
+	options Options
+	queue   chan Notification
+
+	mu     sync.RWMutex
+	routes []route
+}
+
+// NewDispatcher returns a Dispatcher for the configured sinks, it fails if any sink is invalid
+func NewDispatcher(sinks []SinkConfig, options Options) (*Dispatcher, error) {
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = defaultMaxAttempts
+	}
+	if options.InitialBackoff <= 0 {
+		options.InitialBackoff = defaultInitialBackoff
+	}
+	d := &Dispatcher{options: options, queue: make(chan Notification, queueSize)}
+	if err := d.SetSinks(sinks); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// SetSinks replaces the sinks, e.g. after the configuration was reloaded. The previous sinks are kept if
+// any of the new ones is invalid
+func (d *Dispatcher) SetSinks(sinks []SinkConfig) error {
+	if err := Validate(sinks); err != nil {
+		return err
+	}
+	routes := make([]route, 0, len(sinks))
+	for _, config := range sinks {
+		sink, err := config.build()
+		if err != nil {
+			return err
+		}
+		routes = append(routes, route{
+			name:           config.Name,
+			types:          config.Events,
+			sink:           sink,
+			approver:       config.Approver,
+			approverGroups: config.ApproverGroups,
+		})
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.routes = routes
+	return nil
+}
+
+// Notify queues the notification for delivery, it never blocks. A nil Dispatcher drops it
+func (d *Dispatcher) Notify(ctx context.Context, n Notification) {
+	if d == nil {
+		return
+	}
+	if n.Time.IsZero() {
+		n.Time = time.Now()
+	}
+	select {
+	case d.queue <- n:
+	default:
+		d.deadLetter(ctx, "", n, 0, fmt.Errorf("notification queue is full"))
+	}
+}
+
+// Start delivers queued notifications until ctx is done
+func (d *Dispatcher) Start(ctx context.Context) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-d.queue:
+			for _, r := range d.subscribers(n.Type) {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					d.deliver(ctx, r, n)
+				}()
+			}
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, every replica delivers the
+// notifications of the webhook requests it serves
+func (d *Dispatcher) NeedLeaderElection() bool {
+	return false
+}
+
+// subscribers returns the routes receiving notifications of type t
+func (d *Dispatcher) subscribers(t Type) []route {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var subscribed []route
+	for _, r := range d.routes {
+		if len(r.types) == 0 || slices.Contains(r.types, t) {
+			subscribed = append(subscribed, r)
+		}
+	}
+	return subscribed
+}
+
+// deliver sends the notification to the sink of r, retrying with exponential backoff, and dead-letters it
+// if every attempt failed
+func (d *Dispatcher) deliver(ctx context.Context, r route, n Notification) {
+	log := logf.FromContext(ctx).WithValues("sink", r.name, "type", n.Type, "namespace", n.Namespace, "name", n.Name)
+	if n.Type == TypeCreated && r.approver != "" && d.options.Links != nil && n.Hash != "" {
+		var err error
+		if n.ApproveURL, n.DenyURL, err = d.options.Links.Links(n, r.approver, r.approverGroups); err != nil {
+			log.Error(err, "Failed to sign approval links, sending the notification without them")
+		}
+	}
+	backoff := d.options.InitialBackoff
+	var err error
+	for attempt := 1; attempt <= d.options.MaxAttempts; attempt++ {
+		if err = r.sink.Send(ctx, n); err == nil {
+			metrics.Notifications.WithLabelValues(r.name, metrics.NotificationDelivered).Inc()
+			return
+		}
+		log.V(1).Info("Notification delivery failed", "attempt", attempt, "error", err.Error())
+		if attempt == d.options.MaxAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			d.deadLetter(ctx, r.name, n, attempt, fmt.Errorf("shutting down: %w", err))
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	d.deadLetter(ctx, r.name, n, d.options.MaxAttempts, err)
+}
+
+// deadLetter records a notification that could not be delivered to sink
+func (d *Dispatcher) deadLetter(ctx context.Context, sink string, n Notification, attempts int, err error) {
+	metrics.Notifications.WithLabelValues(sink, metrics.NotificationDeadLettered).Inc()
+	log := logf.FromContext(ctx)
+	log.Error(err, "Notification was not delivered", "sink", sink, "type", n.Type,
+		"namespace", n.Namespace, "name", n.Name, "attempts", attempts)
+	if d.options.DeadLetters == nil {
+		return
+	}
+	letter := DeadLetter{Time: time.Now().UTC(), Sink: sink, Attempts: attempts, Error: err.Error(), Notification: n}
+	if err := d.options.DeadLetters.Write(letter); err != nil {
+		log.Error(err, "Failed to record dead letter", "sink", sink)
+	}
+}
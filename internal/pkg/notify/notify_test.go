@@ -0,0 +1,290 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var notification = Notification{
+	Type:      TypeCreated,
+	Time:      time.Date(2025, 3, 7, 10, 0, 0, 0, time.UTC),
+	Namespace: "shop",
+	Name:      "allow-web",
+	CSRName:   "np-approval-shop-allow-web",
+	Message:   "alice requested approval",
+}
+
+func TestWebhookSinkSignsTheBody(t *testing.T) {
+	var received Notification
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		signature = r.Header.Get(SignatureHeader)
+		if signature != "sha256="+Sign([]byte("s3cret"), body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.Unmarshal(body, &received)
+	}))
+	defer server.Close()
+
+	sink := &WebhookSink{URL: server.URL, Secret: []byte("s3cret")}
+	if err := sink.Send(context.Background(), notification); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if received != notification {
+		t.Errorf("received %+v, want %+v", received, notification)
+	}
+
+	sink.Secret = []byte("wrong")
+	if err := sink.Send(context.Background(), notification); err == nil {
+		t.Error("Send() succeeded with a wrong signature")
+	}
+}
+
+func TestChatSinkPostsText(t *testing.T) {
+	var message chatMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&message)
+	}))
+	defer server.Close()
+
+	if err := (&ChatSink{URL: server.URL}).Send(context.Background(), notification); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if !strings.Contains(message.Text, "NetworkPolicy shop/allow-web: approval created") ||
+		!strings.Contains(message.Text, notification.Message) {
+		t.Errorf("unexpected chat message %q", message.Text)
+	}
+}
+
+// smtpServer accepts one connection at a time and records the DATA of every message
+func smtpServer(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	messages := make(chan string, 1)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			reader := bufio.NewReader(conn)
+			reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+			reply("220 localhost ready")
+			var data strings.Builder
+			inData := false
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					break
+				}
+				if inData {
+					if line == ".\r\n" {
+						inData = false
+						messages <- data.String()
+						reply("250 queued")
+						continue
+					}
+					data.WriteString(line)
+					continue
+				}
+				switch command := strings.ToUpper(strings.TrimSpace(line)); {
+				case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+					reply("250 localhost")
+				case command == "DATA":
+					inData = true
+					reply("354 go ahead")
+				case command == "QUIT":
+					reply("221 bye")
+					_ = conn.Close()
+				default:
+					reply("250 ok")
+				}
+			}
+			_ = conn.Close()
+		}
+	}()
+	return listener.Addr().String(), messages
+}
+
+func TestEmailSinkSendsMail(t *testing.T) {
+	address, messages := smtpServer(t)
+	sink := &EmailSink{Address: address, From: "approvals@example.com", To: []string{"netsec@example.com"}}
+	if err := sink.Send(context.Background(), notification); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	select {
+	case message := <-messages:
+		for _, want := range []string{"Subject: NetworkPolicy shop/allow-web: approval created", "To: netsec@example.com", notification.Message} {
+			if !strings.Contains(message, want) {
+				t.Errorf("message does not contain %q:\n%s", want, message)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+}
+
+type deadLetters struct {
+	mu      sync.Mutex
+	letters []DeadLetter
+}
+
+func (d *deadLetters) Write(letter DeadLetter) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.letters = append(d.letters, letter)
+	return nil
+}
+
+func (d *deadLetters) get() []DeadLetter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]DeadLetter{}, d.letters...)
+}
+
+func TestDispatcherRetriesAndDeadLetters(t *testing.T) {
+	var flakyCalls, brokenCalls atomic.Int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if flakyCalls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer flaky.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		brokenCalls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+	ignored := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("a sink received an event it did not subscribe to")
+	}))
+	defer ignored.Close()
+
+	letters := &deadLetters{}
+	dispatcher, err := NewDispatcher([]SinkConfig{
+		{Name: "flaky", Type: SinkWebhook, URL: flaky.URL},
+		{Name: "broken", Type: SinkChat, URL: broken.URL, Events: []Type{TypeCreated}},
+		{Name: "denials", Type: SinkWebhook, URL: ignored.URL, Events: []Type{TypeDenied}},
+	}, Options{MaxAttempts: 3, InitialBackoff: time.Millisecond, DeadLetters: letters})
+	if err != nil {
+		t.Fatalf("NewDispatcher() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		_ = dispatcher.Start(ctx)
+		close(done)
+	}()
+	dispatcher.Notify(ctx, notification)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(letters.get()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for flakyCalls.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if got := flakyCalls.Load(); got != 3 {
+		t.Errorf("flaky sink was called %d times, want 3", got)
+	}
+	if got := brokenCalls.Load(); got != 3 {
+		t.Errorf("broken sink was called %d times, want 3", got)
+	}
+	got := letters.get()
+	if len(got) != 1 || got[0].Sink != "broken" || got[0].Attempts != 3 || got[0].Notification != notification {
+		t.Errorf("dead letters = %+v, want one for the broken sink", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Setenv("EMPTY_SECRET", "")
+	tests := map[string]SinkConfig{
+		"no name":         {Type: SinkWebhook, URL: "https://example.com"},
+		"unknown type":    {Name: "s", Type: "pager", URL: "https://example.com"},
+		"relative url":    {Name: "s", Type: SinkChat, URL: "/hooks"},
+		"unknown event":   {Name: "s", Type: SinkWebhook, URL: "https://example.com", Events: []Type{"merged"}},
+		"missing secret":  {Name: "s", Type: SinkWebhook, URL: "https://example.com", SecretFromEnv: "EMPTY_SECRET"},
+		"no smtp port":    {Name: "s", Type: SinkEmail, SMTPAddress: "mail.example.com", From: "a@example.com", To: []string{"b@example.com"}},
+		"no recipients":   {Name: "s", Type: SinkEmail, SMTPAddress: "mail.example.com:25", From: "a@example.com"},
+		"no webhook host": {Name: "s", Type: SinkWebhook},
+	}
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := Validate([]SinkConfig{config}); err == nil {
+				t.Error("Validate() succeeded")
+			}
+		})
+	}
+	valid := SinkConfig{Name: "s", Type: SinkChat, URL: "https://hooks.slack.com/services/x"}
+	if err := Validate([]SinkConfig{valid, valid}); err == nil {
+		t.Error("Validate() accepted duplicate sinks")
+	}
+}
+
+type fakeLinks struct{}
+
+func (fakeLinks) Links(n Notification, approver string, _ []string) (string, string, error) {
+	return "https://a/" + approver + "/" + n.Hash, "https://d/" + approver, nil
+}
+
+func TestDispatcherAttachesLinksForApprovers(t *testing.T) {
+	received := make(chan Notification, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n Notification
+		_ = json.NewDecoder(r.Body).Decode(&n)
+		received <- n
+	}))
+	defer server.Close()
+
+	dispatcher, err := NewDispatcher([]SinkConfig{
+		{Name: "approvers", Type: SinkWebhook, URL: server.URL, Approver: "alice"},
+		{Name: "watchers", Type: SinkWebhook, URL: server.URL},
+	}, Options{Links: fakeLinks{}})
+	if err != nil {
+		t.Fatalf("NewDispatcher() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = dispatcher.Start(ctx) }()
+	created := notification
+	created.Hash = "abc"
+	dispatcher.Notify(ctx, created)
+
+	withLinks := 0
+	for range 2 {
+		select {
+		case n := <-received:
+			if n.ApproveURL != "" {
+				withLinks++
+				if n.ApproveURL != "https://a/alice/abc" || n.DenyURL != "https://d/alice" {
+					t.Errorf("unexpected links %s %s", n.ApproveURL, n.DenyURL)
+				}
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("notification not delivered")
+		}
+	}
+	if withLinks != 1 {
+		t.Errorf("%d notifications carried links, want 1", withLinks)
+	}
+}
@@ -0,0 +1,233 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SinkType selects how a sink delivers notifications
+type SinkType string
+
+const (
+	// SinkWebhook posts the notification as JSON, signed with HMAC-SHA256 if a secret is configured
+	SinkWebhook SinkType = "webhook"
+	// SinkChat posts a message to a Slack or Microsoft Teams incoming webhook
+	SinkChat SinkType = "chat"
+	// SinkEmail sends the notification by SMTP
+	SinkEmail SinkType = "email"
+)
+
+// SignatureHeader carries the hex encoded HMAC-SHA256 of the request body of webhook sinks, prefixed with sha256=
+const SignatureHeader = "X-Approval-Signature"
+
+// requestTimeout bounds a single delivery attempt
+const requestTimeout = 10 * time.Second
+
+// SinkConfig configures a notification sink. Secrets are read from environment variables so they can be
+// mounted from a Secret instead of being stored in the configuration file
+type SinkConfig struct {
+	// Name identifies the sink in logs, metrics and dead letters
+	Name string `mapstructure:"name"`
+	// Type is webhook, chat or email
+	Type SinkType `mapstructure:"type"`
+	// Events the sink receives: created, approved, denied and expiring. Every event if empty
+	Events []Type `mapstructure:"events"`
+	// URL receives the POST requests of webhook and chat sinks
+	URL string `mapstructure:"url"`
+	// SecretFromEnv names the environment variable holding the HMAC key of a webhook sink
+	SecretFromEnv string `mapstructure:"secretFromEnv"`
+	// SMTPAddress is the host:port of the mail server of an email sink
+	SMTPAddress string `mapstructure:"smtpAddress"`
+	// From and To are the sender and recipients of an email sink
+	From string   `mapstructure:"from"`
+	To   []string `mapstructure:"to"`
+	// Username and PasswordFromEnv authenticate to the mail server with PLAIN auth, if set
+	Username        string `mapstructure:"username"`
+	PasswordFromEnv string `mapstructure:"passwordFromEnv"`
+	// Approver and ApproverGroups are the identity the recipients of the sink approve as, created requests
+	// carry signed approve and deny links for it if callbacks are enabled
+	Approver       string   `mapstructure:"approver"`
+	ApproverGroups []string `mapstructure:"approverGroups"`
+}
+
+// Validate checks every sink configuration
+func Validate(sinks []SinkConfig) error {
+	names := map[string]bool{}
+	for _, config := range sinks {
+		if _, err := config.build(); err != nil {
+			return err
+		}
+		if names[config.Name] {
+			return fmt.Errorf("duplicate notification sink %s", config.Name)
+		}
+		names[config.Name] = true
+	}
+	return nil
+}
+
+// build validates the configuration and returns its sink
+func (c SinkConfig) build() (Sink, error) {
+	if c.Name == "" {
+		return nil, fmt.Errorf("notification sink has no name")
+	}
+	for _, t := range c.Events {
+		if !slices.Contains([]Type{TypeCreated, TypeApproved, TypeDenied, TypeExpiring, TypeRollback, TypeDrift}, t) {
+			return nil, fmt.Errorf("notification sink %s: unknown event %q", c.Name, t)
+		}
+	}
+	switch c.Type {
+	case SinkWebhook, SinkChat:
+		if parsed, err := url.Parse(c.URL); err != nil || parsed.Host == "" {
+			return nil, fmt.Errorf("notification sink %s needs an absolute url", c.Name)
+		}
+		if c.Type == SinkChat {
+			return &ChatSink{URL: c.URL}, nil
+		}
+		sink := &WebhookSink{URL: c.URL}
+		if c.SecretFromEnv != "" {
+			secret, ok := os.LookupEnv(c.SecretFromEnv)
+			if !ok || secret == "" {
+				return nil, fmt.Errorf("notification sink %s: environment variable %s is not set", c.Name, c.SecretFromEnv)
+			}
+			sink.Secret = []byte(secret)
+		}
+		return sink, nil
+	case SinkEmail:
+		if _, _, err := net.SplitHostPort(c.SMTPAddress); err != nil {
+			return nil, fmt.Errorf("notification sink %s needs smtpAddress as host:port: %w", c.Name, err)
+		}
+		if c.From == "" || len(c.To) == 0 {
+			return nil, fmt.Errorf("notification sink %s needs from and to", c.Name)
+		}
+		sink := &EmailSink{Address: c.SMTPAddress, From: c.From, To: c.To}
+		if c.Username != "" {
+			host, _, _ := net.SplitHostPort(c.SMTPAddress)
+			sink.Auth = smtp.PlainAuth("", c.Username, os.Getenv(c.PasswordFromEnv), host)
+		}
+		return sink, nil
+	}
+	return nil, fmt.Errorf("notification sink %s: unknown type %q, expected %s, %s or %s", c.Name, c.Type, SinkWebhook, SinkChat, SinkEmail)
+}
+
+// WebhookSink posts notifications as JSON to URL
+type WebhookSink struct {
+	URL string
+	// Secret signs the body with HMAC-SHA256 in SignatureHeader, requests are unsigned if empty
+	Secret []byte
+	Client *http.Client
+}
+
+// Send implements Sink
+func (s *WebhookSink) Send(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+	headers := map[string]string{}
+	if len(s.Secret) > 0 {
+		headers[SignatureHeader] = "sha256=" + Sign(s.Secret, body)
+	}
+	return post(ctx, s.Client, s.URL, body, headers)
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of body, receivers compare it with SignatureHeader
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ChatSink posts notifications to a Slack or Microsoft Teams incoming webhook, both accept a text payload
+type ChatSink struct {
+	URL    string
+	Client *http.Client
+}
+
+// chatMessage is the payload understood by Slack and Teams incoming webhooks
+type chatMessage struct {
+	Text string `json:"text"`
+}
+
+// Send implements Sink
+func (s *ChatSink) Send(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(chatMessage{Text: fmt.Sprintf("*%s*\n%s%s", n.Subject(), n.Message, links(n, "\n"))})
+	if err != nil {
+		return fmt.Errorf("failed to marshal chat message: %w", err)
+	}
+	return post(ctx, s.Client, s.URL, body, nil)
+}
+
+// links renders the approve and deny links of the notification as lines preceded by newline, empty if it has none
+func links(n Notification, newline string) string {
+	if n.ApproveURL == "" {
+		return ""
+	}
+	return fmt.Sprintf("%sApprove: %s%sDeny: %s", newline, n.ApproveURL, newline, n.DenyURL)
+}
+
+// post sends body as JSON and fails unless the response status is 2xx
+func post(ctx context.Context, client *http.Client, target string, body []byte, headers map[string]string) error {
+	if client == nil {
+		client = &http.Client{Timeout: requestTimeout}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s responded %s", target, resp.Status)
+	}
+	return nil
+}
+
+// EmailSink sends notifications by SMTP
+type EmailSink struct {
+	Address string
+	From    string
+	To      []string
+	// Auth authenticates to the server, nil for none
+	Auth smtp.Auth
+}
+
+// Send implements Sink
+func (s *EmailSink) Send(_ context.Context, n Notification) error {
+	var message strings.Builder
+	fmt.Fprintf(&message, "From: %s\r\n", s.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(s.To, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", n.Subject())
+	fmt.Fprintf(&message, "Date: %s\r\n", n.Time.UTC().Format(time.RFC1123Z))
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&message, "%s\r\n\r\nNamespace: %s\r\nNetworkPolicy: %s\r\n", n.Message, n.Namespace, n.Name)
+	if n.CSRName != "" {
+		fmt.Fprintf(&message, "Request: %s\r\n", n.CSRName)
+	}
+	message.WriteString(links(n, "\r\n"))
+	if err := smtp.SendMail(s.Address, s.Auth, s.From, s.To, []byte(message.String())); err != nil {
+		return fmt.Errorf("failed to send email via %s: %w", s.Address, err)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+// Package signature pre-approves NetworkPolicies reviewed outside the cluster, e.g. in pull requests. A policy is
+// admitted without a CSR if its signature annotation holds a detached signature over its hash made with one of the
+// trusted keys of the configuration. Signatures are verified like cosign sign-blob ones: Ed25519 over the hash,
+// ECDSA and RSA PKCS#1 v1.5 over its SHA-256 digest, base64 encoded.
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TrustedKey is a public key whose signatures pre-approve NetworkPolicies
+type TrustedKey struct {
+	// Name identifies the key in audit records and errors
+	Name string `mapstructure:"name" json:"name"`
+	// PublicKey is a PEM encoded PKIX public key (Ed25519, ECDSA or RSA) or an X.509 certificate, whose
+	// validity period is enforced
+	PublicKey string `mapstructure:"publicKey" json:"publicKey"`
+	// Namespaces the key may pre-approve NetworkPolicies in, every namespace if empty
+	Namespaces []string `mapstructure:"namespaces" json:"namespaces,omitempty"`
+}
+
+// key is a parsed TrustedKey
+type key struct {
+	name       string
+	namespaces []string
+	public     crypto.PublicKey
+	// notBefore and notAfter bound the use of keys from certificates
+	notBefore time.Time
+	notAfter  time.Time
+}
+
+// Validate checks every trusted key
+func Validate(keys []TrustedKey) error {
+	_, err := parse(keys)
+	return err
+}
+
+func parse(keys []TrustedKey) ([]key, error) {
+	parsed := make([]key, 0, len(keys))
+	names := map[string]bool{}
+	for _, trusted := range keys {
+		if trusted.Name == "" {
+			return nil, errors.New("trusted signing key has no name")
+		}
+		if names[trusted.Name] {
+			return nil, fmt.Errorf("duplicate trusted signing key %s", trusted.Name)
+		}
+		names[trusted.Name] = true
+		block, _ := pem.Decode([]byte(trusted.PublicKey))
+		if block == nil {
+			return nil, fmt.Errorf("trusted signing key %s: publicKey is not PEM encoded", trusted.Name)
+		}
+		k := key{name: trusted.Name, namespaces: trusted.Namespaces}
+		switch block.Type {
+		case "PUBLIC KEY":
+			public, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("trusted signing key %s: %w", trusted.Name, err)
+			}
+			k.public = public
+		case "CERTIFICATE":
+			certificate, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("trusted signing key %s: %w", trusted.Name, err)
+			}
+			k.public, k.notBefore, k.notAfter = certificate.PublicKey, certificate.NotBefore, certificate.NotAfter
+		default:
+			return nil, fmt.Errorf("trusted signing key %s: unsupported PEM block %q, expected PUBLIC KEY or CERTIFICATE", trusted.Name, block.Type)
+		}
+		switch k.public.(type) {
+		case ed25519.PublicKey, *ecdsa.PublicKey, *rsa.PublicKey:
+		default:
+			return nil, fmt.Errorf("trusted signing key %s: unsupported key type %T", trusted.Name, k.public)
+		}
+		parsed = append(parsed, k)
+	}
+	return parsed, nil
+}
+
+// Verifier checks signatures against the trusted keys, they can be replaced while in use
+type Verifier struct {
+	mu   sync.RWMutex
+	keys []key
+	now  func() time.Time
+}
+
+// NewVerifier returns a Verifier trusting keys, it fails if any key is invalid
+func NewVerifier(keys []TrustedKey) (*Verifier, error) {
+	v := &Verifier{now: time.Now}
+	if err := v.SetKeys(keys); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// SetKeys replaces the trusted keys, e.g. after the configuration was reloaded. The previous keys are kept
+// if any of the new ones is invalid
+func (v *Verifier) SetKeys(keys []TrustedKey) error {
+	parsed, err := parse(keys)
+	if err != nil {
+		return err
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.keys = parsed
+	return nil
+}
+
+// Verify checks the base64 encoded signature over the hash of a NetworkPolicy in namespace and returns the
+// name of the trusted key that made it. A nil Verifier trusts no key
+func (v *Verifier) Verify(namespace, hash, signature string) (string, error) {
+	if v == nil {
+		return "", errors.New("no signing keys are trusted")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(signature))
+	if err != nil {
+		return "", fmt.Errorf("signature is not base64 encoded: %w", err)
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if len(v.keys) == 0 {
+		return "", errors.New("no signing keys are trusted")
+	}
+	now := v.now()
+	for _, k := range v.keys {
+		if len(k.namespaces) > 0 && !slices.Contains(k.namespaces, namespace) {
+			continue
+		}
+		if (!k.notBefore.IsZero() && now.Before(k.notBefore)) || (!k.notAfter.IsZero() && now.After(k.notAfter)) {
+			continue
+		}
+		if verify(k.public, []byte(hash), decoded) {
+			return k.name, nil
+		}
+	}
+	return "", fmt.Errorf("signature was not made by a key trusted for namespace %s over hash %s", namespace, hash)
+}
+
+// Sign signs message with a PEM encoded private key (PKCS#8, or SEC 1 and PKCS#1 for ECDSA and RSA) the way
+// Verify checks signatures, e.g. to sign exports of the approvals
+func Sign(privateKey []byte, message string) (string, error) {
+	block, _ := pem.Decode(privateKey)
+	if block == nil {
+		return "", errors.New("private key is not PEM encoded")
+	}
+	var parsed any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return "", fmt.Errorf("unsupported PEM block %q, expected a private key", block.Type)
+	}
+	if err != nil {
+		return "", fmt.Errorf("invalid private key: %w", err)
+	}
+
+	digest := sha256.Sum256([]byte(message))
+	var signature []byte
+	switch private := parsed.(type) {
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(private, []byte(message))
+	case *ecdsa.PrivateKey:
+		signature, err = ecdsa.SignASN1(rand.Reader, private, digest[:])
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, private, crypto.SHA256, digest[:])
+	default:
+		return "", fmt.Errorf("unsupported key type %T", parsed)
+	}
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// verify checks a signature over message the way cosign sign-blob makes them
+func verify(public crypto.PublicKey, message, signature []byte) bool {
+	digest := sha256.Sum256(message)
+	switch public := public.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(public, message, signature)
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(public, digest[:], signature)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature) == nil
+	}
+	return false
+}
@@ -0,0 +1,334 @@
+// Package templates matches NetworkPolicies against approved PolicyTemplates, which admits
+// them without an approval request of their own.
+package templates
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	approvalv1alpha1 "github.com/hadi2f244/approve-controller/api/v1alpha1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// placeholder matches {{parameter}} in string values of a template
+var placeholder = regexp.MustCompile(`\{\{\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*\}\}`)
+
+// CSRName returns the name of the CSR administrators approve a template with
+func CSRName(name string) string {
+	return fmt.Sprintf("np-template-%s", name)
+}
+
+// Hash returns the hash of a template spec, the approval is bound to it
+func Hash(spec approvalv1alpha1.PolicyTemplateSpec) (string, error) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
+// Approved reports whether the current spec of the template was approved
+func Approved(template *approvalv1alpha1.PolicyTemplate) bool {
+	if template.Status.ApprovedHash == "" {
+		return false
+	}
+	hash, err := Hash(template.Spec)
+	return err == nil && hash == template.Status.ApprovedHash
+}
+
+// Validate checks that the template can be matched, e.g. that it only references declared parameters
+func Validate(spec approvalv1alpha1.PolicyTemplateSpec) error {
+	var tree any
+	if err := json.Unmarshal(spec.Template.Raw, &tree); err != nil {
+		return fmt.Errorf("template is not valid JSON: %w", err)
+	}
+	if _, ok := tree.(map[string]any); !ok {
+		return fmt.Errorf("template must be an object")
+	}
+	declared := map[string]bool{}
+	for _, param := range spec.Parameters {
+		if declared[param.Name] {
+			return fmt.Errorf("parameter %s is declared twice", param.Name)
+		}
+		declared[param.Name] = true
+		if _, err := regexp.Compile(param.Pattern); err != nil {
+			return fmt.Errorf("parameter %s has an invalid pattern: %w", param.Name, err)
+		}
+	}
+	var undeclared []string
+	walkStrings(tree, func(value string) {
+		for _, match := range placeholder.FindAllStringSubmatch(value, -1) {
+			if !declared[match[1]] && !slices.Contains(undeclared, match[1]) {
+				undeclared = append(undeclared, match[1])
+			}
+		}
+	})
+	if len(undeclared) > 0 {
+		return fmt.Errorf("template references undeclared parameters: %s", strings.Join(undeclared, ", "))
+	}
+	return nil
+}
+
+// Match returns the parameters with which the template instantiates the spec of the NetworkPolicy,
+// false if it does not. The approval of the template is not checked
+func Match(template *approvalv1alpha1.PolicyTemplate, np *networkingv1.NetworkPolicy) (map[string]string, bool, error) {
+	if len(template.Spec.Namespaces) > 0 && !slices.Contains(template.Spec.Namespaces, np.Namespace) {
+		return nil, false, nil
+	}
+
+	var tree any
+	if err := json.Unmarshal(template.Spec.Template.Raw, &tree); err != nil {
+		return nil, false, fmt.Errorf("template %s is not valid JSON: %w", template.Name, err)
+	}
+	data, err := json.Marshal(np.Spec)
+	if err != nil {
+		return nil, false, err
+	}
+	var spec any
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, false, err
+	}
+
+	m := &matcher{parameters: map[string]approvalv1alpha1.PolicyTemplateParameter{}, bindings: map[string]string{}}
+	for _, param := range template.Spec.Parameters {
+		m.parameters[param.Name] = param
+	}
+	ok, err := m.match(normalize(tree), normalize(spec))
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return m.bindings, true, nil
+}
+
+// Find returns the first approved template, by name, that the NetworkPolicy instantiates and its parameters,
+// nil if there is none
+func Find(ctx context.Context, reader client.Reader, np *networkingv1.NetworkPolicy) (*approvalv1alpha1.PolicyTemplate, map[string]string, error) {
+	list := &approvalv1alpha1.PolicyTemplateList{}
+	if err := reader.List(ctx, list); err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(list.Items, func(i, j int) bool { return list.Items[i].Name < list.Items[j].Name })
+	for i := range list.Items {
+		template := &list.Items[i]
+		if !Approved(template) {
+			continue
+		}
+		params, ok, err := Match(template, np)
+		if err != nil {
+			// A broken template must not keep the others from matching
+			continue
+		}
+		if ok {
+			return template, params, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// matcher unifies a template with a spec, binding the placeholders to the values of the spec
+type matcher struct {
+	parameters map[string]approvalv1alpha1.PolicyTemplateParameter
+	bindings   map[string]string
+}
+
+func (m *matcher) match(template, value any) (bool, error) {
+	switch t := template.(type) {
+	case map[string]any:
+		v, ok := value.(map[string]any)
+		if !ok || len(t) != len(v) {
+			return false, nil
+		}
+		for key, child := range t {
+			other, ok := v[key]
+			if !ok {
+				return false, nil
+			}
+			if ok, err := m.match(child, other); err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case []any:
+		v, ok := value.([]any)
+		if !ok || len(t) != len(v) {
+			return false, nil
+		}
+		for i := range t {
+			if ok, err := m.match(t[i], v[i]); err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case string:
+		if !placeholder.MatchString(t) {
+			return t == value, nil
+		}
+		return m.matchPlaceholders(t, value)
+	default:
+		return reflect.DeepEqual(template, value), nil
+	}
+}
+
+// matchPlaceholders matches a string with placeholders against a string, or a number or bool if the
+// placeholder is the whole string
+func (m *matcher) matchPlaceholders(template string, value any) (bool, error) {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		text = strconv.FormatBool(v)
+	default:
+		return false, nil
+	}
+	if _, isString := value.(string); !isString && !wholePlaceholder(template) {
+		return false, nil
+	}
+
+	var pattern strings.Builder
+	var names []string
+	last := 0
+	for _, loc := range placeholder.FindAllStringSubmatchIndex(template, -1) {
+		name := template[loc[2]:loc[3]]
+		param, ok := m.parameters[name]
+		if !ok {
+			return false, fmt.Errorf("parameter %s is not declared", name)
+		}
+		paramPattern := param.Pattern
+		if paramPattern == "" {
+			paramPattern = ".+"
+		}
+		pattern.WriteString(regexp.QuoteMeta(template[last:loc[0]]))
+		fmt.Fprintf(&pattern, "(?P<p%d>%s)", len(names), paramPattern)
+		names = append(names, name)
+		last = loc[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(template[last:]))
+
+	re, err := regexp.Compile("^(?:" + pattern.String() + ")$")
+	if err != nil {
+		return false, fmt.Errorf("invalid parameter pattern: %w", err)
+	}
+	groups := re.FindStringSubmatch(text)
+	if groups == nil {
+		return false, nil
+	}
+	for i, name := range names {
+		captured := groups[re.SubexpIndex(fmt.Sprintf("p%d", i))]
+		if values := m.parameters[name].Values; len(values) > 0 && !slices.Contains(values, captured) {
+			return false, nil
+		}
+		if bound, ok := m.bindings[name]; ok && bound != captured {
+			return false, nil
+		}
+		m.bindings[name] = captured
+	}
+	return true, nil
+}
+
+// wholePlaceholder reports whether the string is a single placeholder
+func wholePlaceholder(value string) bool {
+	loc := placeholder.FindStringIndex(value)
+	return loc != nil && loc[0] == 0 && loc[1] == len(value)
+}
+
+// normalize drops empty values and applies the defaults of the API server, so that templates do not have
+// to spell out what the admitted NetworkPolicy will contain anyway
+func normalize(spec any) any {
+	tree := prune(spec)
+	object, ok := tree.(map[string]any)
+	if !ok {
+		return tree
+	}
+	if _, ok := object["podSelector"]; !ok {
+		object["podSelector"] = map[string]any{}
+	}
+	if _, ok := object["policyTypes"]; !ok {
+		policyTypes := []any{string(networkingv1.PolicyTypeIngress)}
+		if _, ok := object["egress"]; ok {
+			policyTypes = append(policyTypes, string(networkingv1.PolicyTypeEgress))
+		}
+		object["policyTypes"] = policyTypes
+	}
+	for _, direction := range []string{"ingress", "egress"} {
+		rules, _ := object[direction].([]any)
+		for _, rule := range rules {
+			rule, _ := rule.(map[string]any)
+			ports, _ := rule["ports"].([]any)
+			for _, port := range ports {
+				if port, ok := port.(map[string]any); ok {
+					if _, ok := port["protocol"]; !ok {
+						port["protocol"] = "TCP"
+					}
+				}
+			}
+		}
+	}
+	return object
+}
+
+// prune removes nulls, empty objects and empty lists from maps, except for selectors where {} selects everything
+func prune(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		out := map[string]any{}
+		for key, child := range v {
+			child = prune(child)
+			if child == nil {
+				continue
+			}
+			if isSelector(key) {
+				out[key] = child
+				continue
+			}
+			if m, ok := child.(map[string]any); ok && len(m) == 0 {
+				continue
+			}
+			if l, ok := child.([]any); ok && len(l) == 0 {
+				continue
+			}
+			out[key] = child
+		}
+		return out
+	case []any:
+		out := make([]any, 0, len(v))
+		for _, child := range v {
+			out = append(out, prune(child))
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// isSelector reports whether the field is a label selector, which means something different when empty
+func isSelector(key string) bool {
+	return key == "podSelector" || key == "namespaceSelector"
+}
+
+// walkStrings calls fn with every string value of the tree
+func walkStrings(value any, fn func(string)) {
+	switch v := value.(type) {
+	case map[string]any:
+		for _, child := range v {
+			walkStrings(child, fn)
+		}
+	case []any:
+		for _, child := range v {
+			walkStrings(child, fn)
+		}
+	case string:
+		fn(v)
+	}
+}
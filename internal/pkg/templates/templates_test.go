@@ -0,0 +1,168 @@
+package templates
+
+import (
+	"testing"
+
+	approvalv1alpha1 "github.com/hadi2f244/approve-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const ingressTemplate = `{
+  "podSelector": {"matchLabels": {"app": "{{app}}"}},
+  "ingress": [{
+    "from": [{"podSelector": {"matchLabels": {"app": "{{from}}"}}}],
+    "ports": [{"port": "{{port}}"}]
+  }]
+}`
+
+func template(raw string, params ...approvalv1alpha1.PolicyTemplateParameter) *approvalv1alpha1.PolicyTemplate {
+	return &approvalv1alpha1.PolicyTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "allow-app"},
+		Spec: approvalv1alpha1.PolicyTemplateSpec{
+			Parameters: params,
+			Template:   runtime.RawExtension{Raw: []byte(raw)},
+		},
+	}
+}
+
+func ingressPolicy(app, from string, port intstr.IntOrString) *networkingv1.NetworkPolicy {
+	tcp := corev1.ProtocolTCP
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "np", Namespace: "team-a"},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": app}},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				From:  []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": from}}}},
+				Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &port}},
+			}},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		},
+	}
+}
+
+func TestMatch(t *testing.T) {
+	app := approvalv1alpha1.PolicyTemplateParameter{Name: "app", Pattern: "[a-z]+"}
+	from := approvalv1alpha1.PolicyTemplateParameter{Name: "from", Values: []string{"frontend", "gateway"}}
+	port := approvalv1alpha1.PolicyTemplateParameter{Name: "port", Pattern: "[0-9]+"}
+
+	tests := map[string]struct {
+		template *approvalv1alpha1.PolicyTemplate
+		policy   *networkingv1.NetworkPolicy
+		want     map[string]string
+	}{
+		"instance": {
+			template: template(ingressTemplate, app, from, port),
+			policy:   ingressPolicy("api", "frontend", intstr.FromInt32(8080)),
+			want:     map[string]string{"app": "api", "from": "frontend", "port": "8080"},
+		},
+		"value not allowed": {
+			template: template(ingressTemplate, app, from, port),
+			policy:   ingressPolicy("api", "backend", intstr.FromInt32(8080)),
+		},
+		"pattern not matched": {
+			template: template(ingressTemplate, app, from, port),
+			policy:   ingressPolicy("api", "frontend", intstr.FromString("http")),
+		},
+		"extra rule": {
+			template: template(ingressTemplate, app, from, port),
+			policy: func() *networkingv1.NetworkPolicy {
+				np := ingressPolicy("api", "frontend", intstr.FromInt32(8080))
+				np.Spec.Ingress = append(np.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{})
+				return np
+			}(),
+		},
+		"partial placeholder": {
+			template: template(`{"podSelector": {"matchLabels": {"app": "{{team}}-api"}}}`,
+				approvalv1alpha1.PolicyTemplateParameter{Name: "team"}),
+			policy: &networkingv1.NetworkPolicy{Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "payments-api"}},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			}},
+			want: map[string]string{"team": "payments"},
+		},
+		"parameter bound twice": {
+			template: template(`{"podSelector": {"matchLabels": {"app": "{{app}}", "tier": "{{app}}"}}}`, app),
+			policy: &networkingv1.NetworkPolicy{Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "api", "tier": "web"}},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			}},
+		},
+		"default deny": {
+			template: template(`{"podSelector": {}}`),
+			policy: &networkingv1.NetworkPolicy{Spec: networkingv1.NetworkPolicySpec{
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			}},
+			want: map[string]string{},
+		},
+		"other namespace": {
+			template: func() *approvalv1alpha1.PolicyTemplate {
+				pt := template(ingressTemplate, app, from, port)
+				pt.Spec.Namespaces = []string{"team-b"}
+				return pt
+			}(),
+			policy: ingressPolicy("api", "frontend", intstr.FromInt32(8080)),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			params, ok, err := Match(test.template, test.policy)
+			if err != nil {
+				t.Fatalf("Match() error = %v", err)
+			}
+			if ok != (test.want != nil) {
+				t.Fatalf("Match() = %v, want %v", ok, test.want != nil)
+			}
+			for key, value := range test.want {
+				if params[key] != value {
+					t.Errorf("parameter %s = %q, want %q", key, params[key], value)
+				}
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := map[string]struct {
+		spec    approvalv1alpha1.PolicyTemplateSpec
+		wantErr bool
+	}{
+		"valid": {spec: template(ingressTemplate,
+			approvalv1alpha1.PolicyTemplateParameter{Name: "app"},
+			approvalv1alpha1.PolicyTemplateParameter{Name: "from"},
+			approvalv1alpha1.PolicyTemplateParameter{Name: "port"}).Spec},
+		"undeclared parameter": {spec: template(ingressTemplate, approvalv1alpha1.PolicyTemplateParameter{Name: "app"}).Spec, wantErr: true},
+		"invalid pattern":      {spec: template(`{}`, approvalv1alpha1.PolicyTemplateParameter{Name: "app", Pattern: "("}).Spec, wantErr: true},
+		"not an object":        {spec: template(`[]`).Spec, wantErr: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := Validate(test.spec); (err != nil) != test.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestApproved(t *testing.T) {
+	pt := template(`{"podSelector": {}}`)
+	if Approved(pt) {
+		t.Fatal("template without approval is approved")
+	}
+	hash, err := Hash(pt.Spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt.Status.ApprovedHash = hash
+	if !Approved(pt) {
+		t.Fatal("template with the approved hash is not approved")
+	}
+	pt.Spec.Description = "changed"
+	if Approved(pt) {
+		t.Fatal("changed template is still approved")
+	}
+}
@@ -0,0 +1,366 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	approvalv1alpha1 "github.com/hadi2f244/approve-controller/api/v1alpha1"
+	"github.com/hadi2f244/approve-controller/internal/pkg/approval"
+	"github.com/hadi2f244/approve-controller/internal/pkg/authz"
+	"github.com/hadi2f244/approve-controller/internal/pkg/templates"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"slices"
+	"strings"
+	"time"
+)
+
+// nolint:unused
+// log is for logging in this package.
+var certificatesigningrequestlog = logf.Log.WithName("certificatesigningrequest-resource")
+
+// SetupCertificateSigningRequestWebhookWithManager registers the webhook authorizing approvals of NetworkPolicy CSRs.
+// The validator's Authorizer defaults to one using the manager's client, its Client to the manager's client.
+func SetupCertificateSigningRequestWebhookWithManager(mgr ctrl.Manager, validator *CertificateSigningRequestCustomValidator) error {
+	if validator.Authorizer == nil {
+		validator.Authorizer = authz.NewAuthorizer(mgr.GetClient())
+	}
+	if validator.Client == nil {
+		validator.Client = mgr.GetClient()
+	}
+	return ctrl.NewWebhookManagedBy(mgr).For(&certificatesv1.CertificateSigningRequest{}).
+		WithValidator(validator).
+		Complete()
+}
+
+// The objectSelectors limiting the webhooks to NetworkPolicy and PolicyTemplate approval CSRs are added in config/webhook
+// +kubebuilder:webhook:path=/validate-certificates-k8s-io-v1-certificatesigningrequest,mutating=false,failurePolicy=fail,sideEffects=None,groups=certificates.k8s.io,resources=certificatesigningrequests;certificatesigningrequests/approval,verbs=update,versions=v1,name=vcertificatesigningrequest-v1.kb.io,admissionReviewVersions=v1
+// +kubebuilder:webhook:path=/validate-certificates-k8s-io-v1-certificatesigningrequest,mutating=false,failurePolicy=fail,sideEffects=None,groups=certificates.k8s.io,resources=certificatesigningrequests;certificatesigningrequests/approval,verbs=update,versions=v1,name=vtemplatecertificatesigningrequest-v1.kb.io,admissionReviewVersions=v1
+
+// The controller approves requests on behalf of auto-approval rules
+// +kubebuilder:rbac:groups=approval.hadiazad.local,resources=networkpolicyapprovals,verbs=approve
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// CertificateSigningRequestCustomValidator only lets users approve or deny NetworkPolicy requests, or add
+// themselves as approvers, in namespaces they were granted the approve verb on networkpolicyapprovals in.
+// Requests selecting peers in other namespaces are only approved once each of them was approved for, and
+// requests filed during a change freeze only by members of its approver groups.
+// The members of a change-set are only decided together with it, by the controller.
+// PolicyTemplate requests are only decided by users allowed to approve in every namespace the template may be used in.
+// The approval condition of a CSR does not record the approver, so this is checked on admission.
+type CertificateSigningRequestCustomValidator struct {
+	Authorizer *authz.Authorizer
+	// Client reads the change-sets of requests and the templates of template requests
+	Client client.Reader
+	// Delegate is the user of the controller if approval callbacks are enabled. It records the decisions of
+	// callback approvers after authorizing them itself, so it may record them as approvers
+	Delegate string
+}
+
+var _ webhook.CustomValidator = &CertificateSigningRequestCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type CertificateSigningRequest.
+func (v *CertificateSigningRequestCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type CertificateSigningRequest.
+func (v *CertificateSigningRequestCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldCSR, ok := oldObj.(*certificatesv1.CertificateSigningRequest)
+	if !ok {
+		return nil, fmt.Errorf("expected a CertificateSigningRequest object for the oldObj but got %T", oldObj)
+	}
+	csr, ok := newObj.(*certificatesv1.CertificateSigningRequest)
+	if !ok {
+		return nil, fmt.Errorf("expected a CertificateSigningRequest object for the newObj but got %T", newObj)
+	}
+	// The labels select the requests this webhook is called for, removing them would let the next update bypass it
+	_, wasTemplateApproval := oldCSR.Labels[approval.LabelTemplateApproval]
+	_, isTemplateApproval := csr.Labels[approval.LabelTemplateApproval]
+	if wasTemplateApproval || isTemplateApproval {
+		if wasTemplateApproval != isTemplateApproval {
+			return nil, fmt.Errorf("label %s is set when the request is filed and cannot be changed", approval.LabelTemplateApproval)
+		}
+		return nil, v.validateTemplateDecision(ctx, oldCSR, csr)
+	}
+	kind, wasNPApproval := oldCSR.Labels[approval.LabelNetworkPolicyApproval]
+	newKind, isNPApproval := csr.Labels[approval.LabelNetworkPolicyApproval]
+	if !wasNPApproval && !isNPApproval {
+		return nil, nil
+	}
+	if wasNPApproval != isNPApproval || kind != newKind {
+		return nil, fmt.Errorf("label %s is set when the request is filed and cannot be changed", approval.LabelNetworkPolicyApproval)
+	}
+
+	for _, key := range protectedAnnotations {
+		if oldCSR.Annotations[key] != csr.Annotations[key] {
+			return nil, fmt.Errorf("annotation %s is set when the request is filed and cannot be changed", key)
+		}
+	}
+
+	if csr.Labels[approval.LabelNetworkPolicyApproval] == approval.LabelValueChangeSet && len(oldCSR.Status.Conditions) > 0 &&
+		oldCSR.Annotations[approval.AnnotationChangeSetMembers] != csr.Annotations[approval.AnnotationChangeSetMembers] {
+		return nil, fmt.Errorf("the members of change-set %s cannot be changed after it was decided", csr.Name)
+	}
+
+	windowChanged := oldCSR.Annotations[approval.AnnotationNotBefore] != csr.Annotations[approval.AnnotationNotBefore] ||
+		oldCSR.Annotations[approval.AnnotationNotAfter] != csr.Annotations[approval.AnnotationNotAfter]
+	if windowChanged {
+		if newDecision(&certificatesv1.CertificateSigningRequest{}, oldCSR) != "" {
+			return nil, fmt.Errorf("the approval window of request %s cannot be changed after it was decided", csr.Name)
+		}
+		window, err := approval.AnnotatedWindow(csr.Annotations)
+		if err != nil {
+			return nil, err
+		}
+		if window.Ended(time.Now()) {
+			return nil, fmt.Errorf("notAfter %s of request %s is in the past", csr.Annotations[approval.AnnotationNotAfter], csr.Name)
+		}
+	}
+
+	decision := newDecision(oldCSR, csr)
+	if _, autoApproved := csr.Annotations[approval.AnnotationAutoApprovedBy]; decision == certificatesv1.CertificateApproved && !autoApproved &&
+		slices.ContainsFunc(csr.Status.Conditions, func(condition certificatesv1.CertificateSigningRequestCondition) bool {
+			return condition.Type == certificatesv1.CertificateApproved && condition.Reason == approval.ConditionReasonAutoApproved
+		}) {
+		return nil, fmt.Errorf("request %s was not filed for auto-approval, approvals cannot use reason %s", csr.Name, approval.ConditionReasonAutoApproved)
+	}
+	added := addedApprovers(oldCSR, csr)
+	namespaceApprovals := addedNamespaceApprovals(oldCSR, csr)
+	if decision == "" && len(added) == 0 && len(namespaceApprovals) == 0 && !windowChanged {
+		return nil, nil
+	}
+
+	if decision != "" {
+		changeSet, err := v.changeSet(ctx, csr)
+		if err != nil {
+			return nil, err
+		}
+		if changeSet != nil {
+			// The change-set decision was authorized, its members follow it
+			if newDecision(&certificatesv1.CertificateSigningRequest{}, changeSet) == decision {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("request %s is part of change-set %s, decide the change-set instead", csr.Name, changeSet.Name)
+		}
+	}
+
+	user := userInfoFromContext(ctx)
+	delegated := v.Delegate != "" && user.Username == v.Delegate
+	for _, approver := range added {
+		if approver != user.Username && !delegated {
+			return nil, fmt.Errorf("%s cannot record %s as an approver, approvers have to add themselves", user.Username, approver)
+		}
+	}
+
+	affected := approval.AffectedNamespaces(csr.Annotations)
+	for namespace, approver := range namespaceApprovals {
+		if approver != user.Username && !delegated {
+			return nil, fmt.Errorf("%s cannot record %s as the approver of namespace %s, approvers have to add themselves", user.Username, approver, namespace)
+		}
+		if !slices.Contains(affected, namespace) {
+			return nil, fmt.Errorf("request %s does not affect namespace %s", csr.Name, namespace)
+		}
+		if err := v.authorize(ctx, user, namespace); err != nil {
+			return nil, err
+		}
+	}
+
+	namespace := csr.Annotations[approval.AnnotationNamespace]
+	switch {
+	case decision == certificatesv1.CertificateDenied:
+		// The owners of the affected namespaces may refuse the request as well
+		for _, candidate := range append([]string{namespace}, affected...) {
+			if v.authorize(ctx, user, candidate) == nil {
+				return nil, nil
+			}
+		}
+		return nil, v.authorize(ctx, user, namespace)
+	case decision != "" || len(added) > 0 || windowChanged:
+		// Scheduling an approval is part of approving it
+		if err := v.authorize(ctx, user, namespace); err != nil {
+			return nil, err
+		}
+		if groups := approval.ApproverGroups(csr.Annotations); len(groups) > 0 && !delegated && !slices.ContainsFunc(groups, func(group string) bool {
+			return slices.Contains(user.Groups, group)
+		}) {
+			return nil, fmt.Errorf("request %s was filed during change freeze %s and has to be approved by a member of [%s]",
+				csr.Name, csr.Annotations[approval.AnnotationFreeze], strings.Join(groups, ", "))
+		}
+	}
+	if decision == certificatesv1.CertificateApproved && !approval.ApprovalsComplete(csr.Annotations) {
+		if pending := approval.PendingNamespaces(csr.Annotations); len(pending) > 0 {
+			return nil, fmt.Errorf("request %s affects other namespaces and still needs approvals for %s",
+				csr.Name, strings.Join(pending, ", "))
+		}
+		return nil, fmt.Errorf("request %s needs %d approvers but %d were recorded, approve it with kubectl npapprove approve",
+			csr.Name, approval.RequiredApprovers(csr.Annotations), len(approval.Approvers(csr.Annotations)))
+	}
+	return nil, nil
+}
+
+// validateTemplateDecision only lets users decide the request of a PolicyTemplate if they may approve
+// NetworkPolicies in every namespace the template may be used in, cluster-wide if it is not restricted
+func (v *CertificateSigningRequestCustomValidator) validateTemplateDecision(ctx context.Context, oldCSR, csr *certificatesv1.CertificateSigningRequest) error {
+	for _, key := range []string{approval.AnnotationTemplateName, approval.AnnotationApprovalHash} {
+		if oldCSR.Annotations[key] != csr.Annotations[key] {
+			return fmt.Errorf("annotation %s is set when the request is filed and cannot be changed", key)
+		}
+	}
+	if newDecision(oldCSR, csr) == "" {
+		return nil
+	}
+
+	template := &approvalv1alpha1.PolicyTemplate{}
+	if err := v.Client.Get(ctx, types.NamespacedName{Name: csr.Annotations[approval.AnnotationTemplateName]}, template); err != nil {
+		return fmt.Errorf("failed to get the template of request %s: %w", csr.Name, err)
+	}
+	hash, err := templates.Hash(template.Spec)
+	if err != nil {
+		return err
+	}
+	if hash != csr.Annotations[approval.AnnotationApprovalHash] {
+		return fmt.Errorf("request %s was filed for another version of template %s", csr.Name, template.Name)
+	}
+
+	user := userInfoFromContext(ctx)
+	clusterWide := v.authorize(ctx, user, approval.AllNamespaces)
+	if clusterWide == nil || len(template.Spec.Namespaces) == 0 {
+		return clusterWide
+	}
+	for _, namespace := range template.Spec.Namespaces {
+		if err := v.authorize(ctx, user, namespace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// protectedAnnotations identify the requested NetworkPolicy, decide who has to approve it and how long it is
+// admitted without approval, approvers cannot change them
+var protectedAnnotations = []string{
+	approval.AnnotationNamespace,
+	approval.AnnotationName,
+	approval.AnnotationApprovalHash,
+	approval.AnnotationSpec,
+	approval.AnnotationBreakGlass,
+	approval.AnnotationBreakGlassExpires,
+	approval.AnnotationChangeSet,
+	approval.AnnotationAutoApprovedBy,
+	approval.AnnotationAffectedNamespaces,
+	approval.AnnotationRequiredApprovers,
+	approval.AnnotationFreeze,
+	approval.AnnotationApproverGroups,
+}
+
+// authorize returns an error unless the user may approve requests for namespace
+func (v *CertificateSigningRequestCustomValidator) authorize(ctx context.Context, user authenticationv1.UserInfo, namespace string) error {
+	scope := namespace
+	if namespace == approval.AllNamespaces {
+		// Selectors matching every namespace need an approver for the whole cluster
+		scope = ""
+	}
+	allowed, reason, err := v.Authorizer.CanApprove(ctx, user, scope)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		certificatesigningrequestlog.Info("Rejected unauthorized approval", "user", user.Username, "namespace", namespace, "reason", reason)
+		if scope == "" {
+			return fmt.Errorf("%s is not allowed to approve NetworkPolicies affecting all namespaces, it needs the %s verb on %s.%s cluster-wide",
+				user.Username, authz.VerbApprove, authz.Resource, authz.Group)
+		}
+		return fmt.Errorf("%s is not allowed to approve NetworkPolicies in namespace %s, it needs the %s verb on %s.%s",
+			user.Username, namespace, authz.VerbApprove, authz.Resource, authz.Group)
+	}
+	return nil
+}
+
+// changeSet returns the change-set listing the request with the hash it was filed for, nil if there is none
+func (v *CertificateSigningRequestCustomValidator) changeSet(ctx context.Context, csr *certificatesv1.CertificateSigningRequest) (*certificatesv1.CertificateSigningRequest, error) {
+	name, ok := csr.Annotations[approval.AnnotationChangeSet]
+	if !ok {
+		return nil, nil
+	}
+	changeSet := &certificatesv1.CertificateSigningRequest{}
+	if err := v.Client.Get(ctx, types.NamespacedName{Name: name}, changeSet); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get change-set %s: %w", name, err)
+	}
+	if approval.ChangeSetMembers(changeSet.Annotations)[csr.Annotations[approval.AnnotationName]] != csr.Annotations[approval.AnnotationApprovalHash] {
+		return nil, nil
+	}
+	return changeSet, nil
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type CertificateSigningRequest.
+func (v *CertificateSigningRequestCustomValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// newDecision returns the Approved or Denied condition type the update adds to the CSR, empty if none
+func newDecision(oldCSR, csr *certificatesv1.CertificateSigningRequest) certificatesv1.RequestConditionType {
+	has := func(csr *certificatesv1.CertificateSigningRequest, conditionType certificatesv1.RequestConditionType) bool {
+		for _, condition := range csr.Status.Conditions {
+			if condition.Type == conditionType {
+				return true
+			}
+		}
+		return false
+	}
+	for _, conditionType := range []certificatesv1.RequestConditionType{certificatesv1.CertificateApproved, certificatesv1.CertificateDenied} {
+		if has(csr, conditionType) && !has(oldCSR, conditionType) {
+			return conditionType
+		}
+	}
+	return ""
+}
+
+// addedApprovers returns the approvers the update records on the CSR
+func addedApprovers(oldCSR, csr *certificatesv1.CertificateSigningRequest) []string {
+	previous := approval.Approvers(oldCSR.Annotations)
+	var added []string
+	for _, approver := range approval.Approvers(csr.Annotations) {
+		if !slices.Contains(previous, approver) {
+			added = append(added, approver)
+		}
+	}
+	return added
+}
+
+// addedNamespaceApprovals returns the namespace approvals the update records on the CSR
+func addedNamespaceApprovals(oldCSR, csr *certificatesv1.CertificateSigningRequest) map[string]string {
+	previous := approval.NamespaceApprovals(oldCSR.Annotations)
+	added := map[string]string{}
+	for namespace, approver := range approval.NamespaceApprovals(csr.Annotations) {
+		if previous[namespace] != approver {
+			added[namespace] = approver
+		}
+	}
+	return added
+}
@@ -0,0 +1,403 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	approvalv1alpha1 "github.com/hadi2f244/approve-controller/api/v1alpha1"
+	"github.com/hadi2f244/approve-controller/internal/pkg/approval"
+	"github.com/hadi2f244/approve-controller/internal/pkg/authz"
+	"github.com/hadi2f244/approve-controller/internal/pkg/templates"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("CertificateSigningRequest Webhook", func() {
+	var (
+		validator  CertificateSigningRequestCustomValidator
+		fakeClient client.Client
+		oldCSR     *certificatesv1.CertificateSigningRequest
+		reviews    []authorizationv1.SubjectAccessReviewSpec
+		// approvers maps users to the namespaces they may approve in
+		approvers map[string][]string
+	)
+
+	// asUser returns a context of an admission request sent by username
+	asUser := func(username string) context.Context {
+		return admission.NewContextWithRequest(context.Background(), admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{UserInfo: authenticationv1.UserInfo{Username: username}},
+		})
+	}
+	approved := func(csr *certificatesv1.CertificateSigningRequest) *certificatesv1.CertificateSigningRequest {
+		csr = csr.DeepCopy()
+		csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+			Type:   certificatesv1.CertificateApproved,
+			Status: corev1.ConditionTrue,
+		})
+		return csr
+	}
+
+	BeforeEach(func() {
+		reviews = nil
+		approvers = map[string][]string{"tenant-lead": {"team-a"}}
+
+		scheme := runtime.NewScheme()
+		Expect(authorizationv1.AddToScheme(scheme)).To(Succeed())
+		Expect(certificatesv1.AddToScheme(scheme)).To(Succeed())
+		Expect(approvalv1alpha1.AddToScheme(scheme)).To(Succeed())
+		fakeClient = fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				review, ok := obj.(*authorizationv1.SubjectAccessReview)
+				if !ok {
+					return c.Create(ctx, obj, opts...)
+				}
+				reviews = append(reviews, review.Spec)
+				for _, namespace := range approvers[review.Spec.User] {
+					review.Status.Allowed = review.Status.Allowed || namespace == review.Spec.ResourceAttributes.Namespace
+				}
+				return nil
+			},
+		}).Build()
+		validator = CertificateSigningRequestCustomValidator{Authorizer: authz.NewAuthorizer(fakeClient), Client: fakeClient}
+
+		oldCSR = &certificatesv1.CertificateSigningRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   approval.Name("team-a", "allow-web"),
+				Labels: map[string]string{approval.LabelNetworkPolicyApproval: "true"},
+				Annotations: map[string]string{
+					approval.AnnotationNamespace: "team-a",
+					approval.AnnotationName:      "allow-web",
+				},
+			},
+		}
+	})
+
+	It("Should let an approver of the namespace approve the request", func() {
+		_, err := validator.ValidateUpdate(asUser("tenant-lead"), oldCSR, approved(oldCSR))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(reviews).To(HaveLen(1))
+		Expect(reviews[0].ResourceAttributes.Verb).To(Equal(authz.VerbApprove))
+		Expect(reviews[0].ResourceAttributes.Resource).To(Equal(authz.Resource))
+		Expect(reviews[0].ResourceAttributes.Namespace).To(Equal("team-a"))
+	})
+
+	It("Should reject approvals of users without the approve verb in the namespace", func() {
+		oldCSR.Annotations[approval.AnnotationNamespace] = "team-b"
+
+		_, err := validator.ValidateUpdate(asUser("tenant-lead"), oldCSR, approved(oldCSR))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("not allowed to approve NetworkPolicies in namespace team-b"))
+	})
+
+	It("Should only let approvers record themselves", func() {
+		csr := oldCSR.DeepCopy()
+		csr.Annotations[approval.AnnotationApprovers] = "someone-else"
+
+		_, err := validator.ValidateUpdate(asUser("tenant-lead"), oldCSR, csr)
+		Expect(err).To(HaveOccurred())
+
+		csr.Annotations[approval.AnnotationApprovers] = "tenant-lead"
+		_, err = validator.ValidateUpdate(asUser("tenant-lead"), oldCSR, csr)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should let the controller record the approvals of callback approvers", func() {
+		controller := "system:serviceaccount:approve-controller-system:approve-controller-controller-manager"
+		approvers[controller] = []string{"team-a"}
+		oldCSR.Annotations[approval.AnnotationFreeze] = "weekend"
+		oldCSR.Annotations[approval.AnnotationApproverGroups] = "change-board"
+		csr := approved(oldCSR)
+		csr.Annotations[approval.AnnotationApprovers] = "tenant-lead"
+
+		_, err := validator.ValidateUpdate(asUser(controller), oldCSR, csr)
+		Expect(err).To(MatchError(ContainSubstring("approvers have to add themselves")))
+
+		validator.Delegate = controller
+		_, err = validator.ValidateUpdate(asUser(controller), oldCSR, csr)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = validator.ValidateUpdate(asUser("tenant-lead"), oldCSR, csr)
+		Expect(err).To(MatchError(ContainSubstring("filed during change freeze weekend")))
+	})
+
+	It("Should not approve requests before enough approvers were recorded", func() {
+		oldCSR.Annotations[approval.AnnotationRequiredApprovers] = "2"
+		oldCSR.Annotations[approval.AnnotationApprovers] = "bob"
+
+		_, err := validator.ValidateUpdate(asUser("tenant-lead"), oldCSR, approved(oldCSR))
+		Expect(err).To(MatchError(ContainSubstring("needs 2 approvers but 1 were recorded")))
+
+		csr := approved(oldCSR)
+		csr.Annotations[approval.AnnotationApprovers] = "bob,tenant-lead"
+		_, err = validator.ValidateUpdate(asUser("tenant-lead"), oldCSR, csr)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should only let requests filed for auto-approval be approved as auto-approved", func() {
+		csr := approved(oldCSR)
+		csr.Status.Conditions[0].Reason = approval.ConditionReasonAutoApproved
+		_, err := validator.ValidateUpdate(asUser("tenant-lead"), oldCSR, csr)
+		Expect(err).To(MatchError(ContainSubstring("was not filed for auto-approval")))
+
+		oldCSR.Annotations[approval.AnnotationAutoApprovedBy] = "same-namespace"
+		csr = approved(oldCSR)
+		csr.Status.Conditions[0].Reason = approval.ConditionReasonAutoApproved
+		_, err = validator.ValidateUpdate(asUser("tenant-lead"), oldCSR, csr)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should only let approvers of an affected namespace record its approval", func() {
+		oldCSR.Annotations[approval.AnnotationAffectedNamespaces] = "team-b"
+		approvers["team-b-lead"] = []string{"team-b"}
+		csr := oldCSR.DeepCopy()
+		csr.Annotations[approval.AnnotationNamespaceApprovals] = "team-b=tenant-lead"
+
+		_, err := validator.ValidateUpdate(asUser("tenant-lead"), oldCSR, csr)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("not allowed to approve NetworkPolicies in namespace team-b"))
+
+		csr.Annotations[approval.AnnotationNamespaceApprovals] = "team-b=team-b-lead"
+		_, err = validator.ValidateUpdate(asUser("team-b-lead"), oldCSR, csr)
+		Expect(err).NotTo(HaveOccurred())
+
+		csr.Annotations[approval.AnnotationNamespaceApprovals] = "team-c=team-b-lead"
+		_, err = validator.ValidateUpdate(asUser("team-b-lead"), oldCSR, csr)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("does not affect namespace team-c"))
+	})
+
+	It("Should not approve requests before every affected namespace was approved for", func() {
+		oldCSR.Annotations[approval.AnnotationAffectedNamespaces] = "team-b"
+
+		_, err := validator.ValidateUpdate(asUser("tenant-lead"), oldCSR, approved(oldCSR))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("still needs approvals for team-b"))
+
+		oldCSR.Annotations[approval.AnnotationNamespaceApprovals] = "team-b=team-b-lead"
+		_, err = validator.ValidateUpdate(asUser("tenant-lead"), oldCSR, approved(oldCSR))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should only let members of the freeze approver groups approve requests filed during a freeze", func() {
+		oldCSR.Annotations[approval.AnnotationFreeze] = "weekend"
+		oldCSR.Annotations[approval.AnnotationApproverGroups] = "change-board"
+
+		_, err := validator.ValidateUpdate(asUser("tenant-lead"), oldCSR, approved(oldCSR))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("filed during change freeze weekend"))
+
+		ctx := admission.NewContextWithRequest(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			UserInfo: authenticationv1.UserInfo{Username: "tenant-lead", Groups: []string{"change-board"}},
+		}})
+		_, err = validator.ValidateUpdate(ctx, oldCSR, approved(oldCSR))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should not let approvers change who has to approve", func() {
+		oldCSR.Annotations[approval.AnnotationApproverGroups] = "change-board"
+		csr := oldCSR.DeepCopy()
+		delete(csr.Annotations, approval.AnnotationApproverGroups)
+
+		_, err := validator.ValidateUpdate(asUser("tenant-lead"), oldCSR, csr)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("cannot be changed"))
+	})
+
+	It("Should not let approvers change which NetworkPolicy is requested", func() {
+		oldCSR.Annotations[approval.AnnotationApprovalHash] = "abc"
+		oldCSR.Annotations[approval.AnnotationSpec] = "{}"
+		for _, key := range []string{approval.AnnotationNamespace, approval.AnnotationName, approval.AnnotationApprovalHash, approval.AnnotationSpec} {
+			csr := oldCSR.DeepCopy()
+			csr.Annotations[key] = "changed"
+
+			_, err := validator.ValidateUpdate(asUser("tenant-lead"), oldCSR, csr)
+			Expect(err).To(MatchError(ContainSubstring(key)), key)
+		}
+	})
+
+	It("Should not let the break-glass window of a retroactive request be extended", func() {
+		oldCSR.Annotations[approval.AnnotationBreakGlass] = "INC-7 outage"
+		oldCSR.Annotations[approval.AnnotationBreakGlassExpires] = time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		csr := oldCSR.DeepCopy()
+		csr.Annotations[approval.AnnotationBreakGlassExpires] = time.Now().Add(365 * 24 * time.Hour).UTC().Format(time.RFC3339)
+
+		_, err := validator.ValidateUpdate(asUser("anyone"), oldCSR, csr)
+		Expect(err).To(MatchError(ContainSubstring(approval.AnnotationBreakGlassExpires)))
+	})
+
+	It("Should not let the request label be removed, changed or added", func() {
+		By("Removing the label")
+		csr := oldCSR.DeepCopy()
+		delete(csr.Labels, approval.LabelNetworkPolicyApproval)
+		_, err := validator.ValidateUpdate(asUser("tenant-lead"), oldCSR, csr)
+		Expect(err).To(MatchError(ContainSubstring("cannot be changed")))
+
+		By("Changing the label")
+		csr.Labels[approval.LabelNetworkPolicyApproval] = approval.LabelValueChangeSet
+		_, err = validator.ValidateUpdate(asUser("tenant-lead"), oldCSR, csr)
+		Expect(err).To(MatchError(ContainSubstring("cannot be changed")))
+
+		By("Adding the label to an approved request")
+		unlabeled := approved(oldCSR)
+		unlabeled.Labels = nil
+		_, err = validator.ValidateUpdate(asUser("tenant-lead"), unlabeled, approved(oldCSR))
+		Expect(err).To(MatchError(ContainSubstring("cannot be changed")))
+		Expect(reviews).To(BeEmpty())
+	})
+
+	It("Should only let approvers schedule a valid approval window before the request is decided", func() {
+		csr := oldCSR.DeepCopy()
+		csr.Annotations[approval.AnnotationNotBefore] = time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+		_, err := validator.ValidateUpdate(asUser("developer"), oldCSR, csr)
+		Expect(err).To(HaveOccurred())
+		_, err = validator.ValidateUpdate(asUser("tenant-lead"), oldCSR, csr)
+		Expect(err).NotTo(HaveOccurred())
+
+		csr.Annotations[approval.AnnotationNotAfter] = time.Now().UTC().Format(time.RFC3339)
+		_, err = validator.ValidateUpdate(asUser("tenant-lead"), oldCSR, csr)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("is not after notBefore"))
+
+		delete(csr.Annotations, approval.AnnotationNotAfter)
+		_, err = validator.ValidateUpdate(asUser("tenant-lead"), approved(oldCSR), approved(csr))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("cannot be changed after it was decided"))
+	})
+
+	It("Should only let requests of a change-set be decided like the change-set", func() {
+		oldCSR.Annotations[approval.AnnotationChangeSet] = approval.ChangeSetName("team-a", "rel-1")
+		oldCSR.Annotations[approval.AnnotationApprovalHash] = "abc"
+		changeSet := &certificatesv1.CertificateSigningRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   approval.ChangeSetName("team-a", "rel-1"),
+				Labels: map[string]string{approval.LabelNetworkPolicyApproval: approval.LabelValueChangeSet},
+				Annotations: map[string]string{
+					approval.AnnotationNamespace:        "team-a",
+					approval.AnnotationChangeSetMembers: "allow-web=abc",
+				},
+			},
+		}
+		Expect(fakeClient.Create(context.Background(), changeSet)).To(Succeed())
+
+		_, err := validator.ValidateUpdate(asUser("tenant-lead"), oldCSR, approved(oldCSR))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("decide the change-set instead"))
+
+		By("Following the approved change-set without checking the approver")
+		changeSet = approved(changeSet)
+		Expect(fakeClient.SubResource("approval").Update(context.Background(), changeSet)).To(Succeed())
+		_, err = validator.ValidateUpdate(asUser("controller"), oldCSR, approved(oldCSR))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reviews).To(BeEmpty())
+
+		By("Keeping the members of the decided change-set")
+		decided := changeSet.DeepCopy()
+		decided.Annotations[approval.AnnotationChangeSetMembers] = "allow-web=abc,allow-db=def"
+		_, err = validator.ValidateUpdate(asUser("tenant-lead"), changeSet, decided)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("cannot be changed after it was decided"))
+
+		By("Deciding requests that changed since they joined on their own")
+		oldCSR.Annotations[approval.AnnotationApprovalHash] = "changed"
+		_, err = validator.ValidateUpdate(asUser("tenant-lead"), oldCSR, approved(oldCSR))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reviews).To(HaveLen(1))
+	})
+
+	It("Should not check updates that do not decide the request", func() {
+		csr := oldCSR.DeepCopy()
+		csr.Annotations[approval.AnnotationDenialRecorded] = "true"
+
+		_, err := validator.ValidateUpdate(asUser("anyone"), oldCSR, csr)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reviews).To(BeEmpty())
+	})
+
+	It("Should only let approvers of every namespace a template may be used in decide its request", func() {
+		template := &approvalv1alpha1.PolicyTemplate{
+			ObjectMeta: metav1.ObjectMeta{Name: "allow-dns"},
+			Spec:       approvalv1alpha1.PolicyTemplateSpec{Namespaces: []string{"team-a", "team-b"}},
+		}
+		Expect(fakeClient.Create(context.Background(), template)).To(Succeed())
+		hash, err := templates.Hash(template.Spec)
+		Expect(err).NotTo(HaveOccurred())
+		oldCSR = &certificatesv1.CertificateSigningRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   templates.CSRName(template.Name),
+				Labels: map[string]string{approval.LabelTemplateApproval: "true"},
+				Annotations: map[string]string{
+					approval.AnnotationTemplateName: template.Name,
+					approval.AnnotationApprovalHash: hash,
+				},
+			},
+		}
+
+		_, err = validator.ValidateUpdate(asUser("tenant-lead"), oldCSR, approved(oldCSR))
+		Expect(err).To(MatchError(ContainSubstring("not allowed to approve NetworkPolicies in namespace team-b")))
+
+		approvers["team-lead"] = []string{"team-a", "team-b"}
+		_, err = validator.ValidateUpdate(asUser("team-lead"), oldCSR, approved(oldCSR))
+		Expect(err).NotTo(HaveOccurred())
+
+		approvers["cluster-admin"] = []string{""}
+		_, err = validator.ValidateUpdate(asUser("cluster-admin"), oldCSR, approved(oldCSR))
+		Expect(err).NotTo(HaveOccurred())
+
+		By("Requiring cluster-wide approvers for templates usable in every namespace")
+		template.Spec.Namespaces = nil
+		Expect(fakeClient.Update(context.Background(), template)).To(Succeed())
+		hash, err = templates.Hash(template.Spec)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = validator.ValidateUpdate(asUser("team-lead"), oldCSR, approved(oldCSR))
+		Expect(err).To(MatchError(ContainSubstring("was filed for another version of template allow-dns")))
+
+		oldCSR.Annotations[approval.AnnotationApprovalHash] = hash
+		_, err = validator.ValidateUpdate(asUser("team-lead"), oldCSR, approved(oldCSR))
+		Expect(err).To(MatchError(ContainSubstring("affecting all namespaces")))
+		_, err = validator.ValidateUpdate(asUser("cluster-admin"), oldCSR, approved(oldCSR))
+		Expect(err).NotTo(HaveOccurred())
+
+		By("Not letting the label be removed")
+		csr := approved(oldCSR)
+		csr.Labels = nil
+		_, err = validator.ValidateUpdate(asUser("cluster-admin"), oldCSR, csr)
+		Expect(err).To(MatchError(ContainSubstring("cannot be changed")))
+	})
+
+	It("Should ignore CSRs that are not NetworkPolicy requests", func() {
+		oldCSR.Labels = nil
+
+		_, err := validator.ValidateUpdate(asUser("anyone"), oldCSR, approved(oldCSR))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reviews).To(BeEmpty())
+	})
+})
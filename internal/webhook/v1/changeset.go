@@ -0,0 +1,185 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"github.com/hadi2f244/approve-controller/internal/pkg/approval"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// changeSet returns the pending change-set the new request of np joins, filing it if needed. Requests are
+// grouped by the change-id annotation of the NetworkPolicy, or by requester and namespace within
+// ChangeSetWindow. It returns nil for requests that stay on their own: those needing several approvers or
+// approvals for other namespaces, and those whose change-set was decided already or has other approver groups
+func (v *NetworkPolicyCustomValidator) changeSet(ctx context.Context, np *networkingv1.NetworkPolicy, annotations map[string]string) (*certificatesv1.CertificateSigningRequest, error) {
+	if approval.RequiredApprovers(annotations) > 1 || len(approval.AffectedNamespaces(annotations)) > 0 {
+		return nil, nil
+	}
+	requester := requesterFromContext(ctx)
+	changeID := np.Annotations[approval.AnnotationChangeID]
+
+	var name string
+	switch {
+	case approval.ChangeSetID(changeID) != "":
+		name = approval.ChangeSetName(np.Namespace, approval.ChangeSetID(changeID))
+	case v.ChangeSetWindow > 0:
+		open, err := v.openChangeSet(ctx, np.Namespace, requester, annotations)
+		if err != nil || open != nil {
+			return open, err
+		}
+		// Requests of the same requester are told apart by the time their change-set was filed
+		digest := sha256.Sum256([]byte(requester))
+		name = approval.ChangeSetName(np.Namespace, fmt.Sprintf("%x-%d", digest[:4], time.Now().Unix()))
+	default:
+		return nil, nil
+	}
+
+	changeSet := &certificatesv1.CertificateSigningRequest{}
+	err := v.Client.Get(ctx, types.NamespacedName{Name: name}, changeSet)
+	if errors.IsNotFound(err) {
+		return v.createChangeSet(ctx, np.Namespace, name, changeID, requester, annotations)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(changeSet.Status.Conditions) > 0 || changeSet.Annotations[approval.AnnotationApproverGroups] != annotations[approval.AnnotationApproverGroups] {
+		networkpolicylog.Info("Filing the request outside its decided or differently approved change-set", "changeSet", name, "name", np.Name)
+		return nil, nil
+	}
+	return changeSet, nil
+}
+
+// openChangeSet returns the pending change-set without change-id that requester filed in namespace within
+// ChangeSetWindow, nil if there is none
+func (v *NetworkPolicyCustomValidator) openChangeSet(ctx context.Context, namespace, requester string, annotations map[string]string) (*certificatesv1.CertificateSigningRequest, error) {
+	list := &certificatesv1.CertificateSigningRequestList{}
+	if err := v.Client.List(ctx, list, client.MatchingLabels{approval.LabelNetworkPolicyApproval: approval.LabelValueChangeSet}); err != nil {
+		return nil, err
+	}
+	since := time.Now().Add(-v.ChangeSetWindow)
+	var open *certificatesv1.CertificateSigningRequest
+	for i := range list.Items {
+		candidate := &list.Items[i]
+		if candidate.Annotations[approval.AnnotationNamespace] != namespace || candidate.Annotations[approval.AnnotationRequester] != requester ||
+			candidate.Annotations[approval.AnnotationChangeID] != "" || len(candidate.Status.Conditions) > 0 ||
+			candidate.Annotations[approval.AnnotationApproverGroups] != annotations[approval.AnnotationApproverGroups] ||
+			candidate.CreationTimestamp.Time.Before(since) {
+			continue
+		}
+		if open == nil || open.CreationTimestamp.Before(&candidate.CreationTimestamp) {
+			open = candidate
+		}
+	}
+	return open, nil
+}
+
+// createChangeSet files a change-set CSR, it carries the approver groups of a change freeze like its members
+func (v *NetworkPolicyCustomValidator) createChangeSet(ctx context.Context, namespace, name, changeID, requester string, annotations map[string]string) (*certificatesv1.CertificateSigningRequest, error) {
+	request, err := approval.NewCertificateRequest(name)
+	if err != nil {
+		return nil, err
+	}
+	changeSet := &certificatesv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{approval.LabelNetworkPolicyApproval: approval.LabelValueChangeSet},
+			Annotations: map[string]string{
+				approval.AnnotationNamespace: namespace,
+				approval.AnnotationRequester: requester,
+			},
+		},
+		Spec: certificatesv1.CertificateSigningRequestSpec{
+			Request: request,
+			Usages: []certificatesv1.KeyUsage{
+				certificatesv1.UsageDigitalSignature,
+				certificatesv1.UsageKeyEncipherment,
+				certificatesv1.UsageClientAuth,
+			},
+			SignerName: approval.SignerName,
+		},
+	}
+	if changeID != "" {
+		changeSet.Annotations[approval.AnnotationChangeID] = changeID
+	}
+	for _, key := range []string{approval.AnnotationFreeze, approval.AnnotationApproverGroups} {
+		if value, ok := annotations[key]; ok {
+			changeSet.Annotations[key] = value
+		}
+	}
+	if err := v.Client.Create(ctx, changeSet); err != nil {
+		if errors.IsAlreadyExists(err) {
+			// Another request of the release filed it first
+			err = v.Client.Get(ctx, types.NamespacedName{Name: name}, changeSet)
+		}
+		return changeSet, err
+	}
+	networkpolicylog.Info("Created change-set", "changeSet", name, "namespace", namespace, "requester", requester)
+	return changeSet, nil
+}
+
+// addChangeSetMember records the NetworkPolicy and the hash it was requested with on the change-set
+func (v *NetworkPolicyCustomValidator) addChangeSetMember(ctx context.Context, changeSet *certificatesv1.CertificateSigningRequest, name, hash string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := v.Client.Get(ctx, types.NamespacedName{Name: changeSet.Name}, changeSet); err != nil {
+			return err
+		}
+		if len(changeSet.Status.Conditions) > 0 {
+			return fmt.Errorf("change-set %s was decided while the request was filed, apply the NetworkPolicy again", changeSet.Name)
+		}
+		members := approval.ChangeSetMembers(changeSet.Annotations)
+		if members[name] == hash {
+			return nil
+		}
+		members[name] = hash
+		changeSet.Annotations[approval.AnnotationChangeSetMembers] = approval.EncodeChangeSetMembers(members)
+		return v.Client.Update(ctx, changeSet)
+	})
+}
+
+// approvedByChangeSet reports whether the change-set of a request was approved with the hash it was filed for
+func (v *NetworkPolicyCustomValidator) approvedByChangeSet(ctx context.Context, csr *certificatesv1.CertificateSigningRequest) (bool, error) {
+	name, ok := csr.Annotations[approval.AnnotationChangeSet]
+	if !ok {
+		return false, nil
+	}
+	changeSet := &certificatesv1.CertificateSigningRequest{}
+	if err := v.Client.Get(ctx, types.NamespacedName{Name: name}, changeSet); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return isCSRApproved(changeSet) &&
+		approval.ChangeSetMembers(changeSet.Annotations)[csr.Annotations[approval.AnnotationName]] == csr.Annotations[AnnotationApprovalHash], nil
+}
+
+// changeSetNote tells the requester that approving the change-set of the request admits it
+func changeSetNote(annotations map[string]string) string {
+	name, ok := annotations[approval.AnnotationChangeSet]
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf(" It is part of change-set %s, approving the change-set admits all of its NetworkPolicies", name)
+}
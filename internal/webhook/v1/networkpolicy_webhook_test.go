@@ -18,11 +18,32 @@ package v1
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
 	"fmt"
+	"os"
+	"path/filepath"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	approvalv1alpha1 "github.com/hadi2f244/approve-controller/api/v1alpha1"
+	"github.com/hadi2f244/approve-controller/internal/pkg/analyzer"
+	"github.com/hadi2f244/approve-controller/internal/pkg/approval"
+	"github.com/hadi2f244/approve-controller/internal/pkg/audit"
+	"github.com/hadi2f244/approve-controller/internal/pkg/autoapprove"
+	"github.com/hadi2f244/approve-controller/internal/pkg/breakglass"
+	"github.com/hadi2f244/approve-controller/internal/pkg/celrules"
+	"github.com/hadi2f244/approve-controller/internal/pkg/freeze"
+	"github.com/hadi2f244/approve-controller/internal/pkg/signature"
+	"github.com/hadi2f244/approve-controller/internal/pkg/templates"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
 	certificatesv1 "k8s.io/api/certificates/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
@@ -31,6 +52,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
 var _ = Describe("NetworkPolicy Webhook", func() {
@@ -60,6 +82,7 @@ var _ = Describe("NetworkPolicy Webhook", func() {
 		Expect(corev1.AddToScheme(scheme)).To(Succeed())
 		Expect(networkingv1.AddToScheme(scheme)).To(Succeed())
 		Expect(certificatesv1.AddToScheme(scheme)).To(Succeed())
+		Expect(approvalv1alpha1.AddToScheme(scheme)).To(Succeed())
 
 		// Initialize fake client with the namespace
 		fakeClient = fake.NewClientBuilder().
@@ -110,6 +133,21 @@ var _ = Describe("NetworkPolicy Webhook", func() {
 		// Clean up resources if needed
 	})
 
+	// createApprovedTemplate stores an approved template allowing ingress from any single app
+	createApprovedTemplate := func() {
+		template := &approvalv1alpha1.PolicyTemplate{
+			ObjectMeta: metav1.ObjectMeta{Name: "allow-from-app"},
+			Spec: approvalv1alpha1.PolicyTemplateSpec{
+				Parameters: []approvalv1alpha1.PolicyTemplateParameter{{Name: "app", Pattern: "[a-z]+"}},
+				Template:   runtime.RawExtension{Raw: []byte(`{"ingress": [{"from": [{"podSelector": {"matchLabels": {"app": "{{app}}"}}}]}]}`)},
+			},
+		}
+		hash, err := templates.Hash(template.Spec)
+		Expect(err).NotTo(HaveOccurred())
+		template.Status.ApprovedHash = hash
+		Expect(fakeClient.Create(ctx, template)).To(Succeed())
+	}
+
 	Context("When creating NetworkPolicy under Defaulting Webhook", func() {
 		It("Should not modify the NetworkPolicy as no defaults are implemented", func() {
 			By("Creating a copy of the original NetworkPolicy")
@@ -122,6 +160,15 @@ var _ = Describe("NetworkPolicy Webhook", func() {
 			By("Verifying the NetworkPolicy was not modified")
 			Expect(obj).To(Equal(original))
 		})
+
+		It("Should record the approved template the NetworkPolicy instantiates", func() {
+			createApprovedTemplate()
+			defaulter.Client = fakeClient
+
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Annotations[approval.AnnotationTemplate]).To(Equal("allow-from-app"))
+			Expect(obj.Annotations[approval.AnnotationTemplateParameters]).To(MatchJSON(`{"app": "test"}`))
+		})
 	})
 
 	Context("When creating or updating NetworkPolicy under Validating Webhook", func() {
@@ -219,6 +266,558 @@ var _ = Describe("NetworkPolicy Webhook", func() {
 			Expect(warnings).To(BeNil())
 		})
 
+		It("Should deny creation if the approval CSR was denied", func() {
+			By("Filing a request for the NetworkPolicy")
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+
+			By("Denying the CSR")
+			csr := &certificatesv1.CertificateSigningRequest{}
+			csrName := fmt.Sprintf("np-approval-%s-%s", namespace, obj.Name)
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Name: csrName}, csr)).To(Succeed())
+			csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+				Type:   certificatesv1.CertificateDenied,
+				Status: corev1.ConditionTrue,
+				Reason: "Denied",
+			})
+			Expect(fakeClient.Status().Update(ctx, csr)).To(Succeed())
+
+			By("Validating the NetworkPolicy again")
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("NetworkPolicy approval was denied"))
+		})
+
+		It("Should replace a CSR that was filed for another version of the NetworkPolicy", func() {
+			By("Filing a request for the NetworkPolicy")
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+
+			By("Modifying the NetworkPolicy and validating the update")
+			obj.Spec.Ingress[0].From[0].PodSelector.MatchLabels["app"] = "modified"
+			_, err = validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(err).To(HaveOccurred())
+
+			By("Verifying the CSR carries the hash of the modified NetworkPolicy")
+			hash, err := generateNetworkPolicyHash(obj)
+			Expect(err).NotTo(HaveOccurred())
+			csr := &certificatesv1.CertificateSigningRequest{}
+			csrName := fmt.Sprintf("np-approval-%s-%s", namespace, obj.Name)
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Name: csrName}, csr)).To(Succeed())
+			Expect(csr.Annotations[AnnotationApprovalHash]).To(Equal(hash))
+		})
+
+		It("Should reject a NetworkPolicy whose approval takes effect later and admit none after its window", func() {
+			hash, err := generateNetworkPolicyHash(obj)
+			Expect(err).NotTo(HaveOccurred())
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      approval.Name(namespace, obj.Name),
+					Namespace: namespace,
+				},
+				Type: SecretTypeNetworkPolicyApproval,
+				Data: map[string][]byte{
+					approval.SecretKeyPendingPrefix + approval.SecretKeyHash: []byte(hash),
+					approval.SecretKeyPendingNotBefore:                       []byte(time.Now().Add(time.Hour).UTC().Format(time.RFC3339)),
+				},
+			}
+			Expect(fakeClient.Create(ctx, secret)).To(Succeed())
+
+			By("Validating before notBefore")
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("NetworkPolicy is approved from"))
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Name: approval.Name(namespace, obj.Name)}, &certificatesv1.CertificateSigningRequest{})).NotTo(Succeed())
+
+			By("Validating after notAfter")
+			secret.Data[approval.SecretKeyPendingNotBefore] = []byte(time.Now().Add(-time.Hour).UTC().Format(time.RFC3339))
+			secret.Data[approval.SecretKeyPendingNotAfter] = []byte(time.Now().Add(-time.Minute).UTC().Format(time.RFC3339))
+			Expect(fakeClient.Update(ctx, secret)).To(Succeed())
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("NetworkPolicy has not been approved yet"))
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Name: approval.Name(namespace, obj.Name)}, &certificatesv1.CertificateSigningRequest{})).To(Succeed())
+		})
+
+		It("Should record the request and the admission decision in the audit trail", func() {
+			By("Configuring a file audit sink")
+			auditPath := filepath.Join(GinkgoT().TempDir(), "audit.jsonl")
+			sink, err := audit.NewFileSink(auditPath)
+			Expect(err).NotTo(HaveOccurred())
+			defer sink.Close()
+			validator.Audit = sink
+
+			By("Validating a NetworkPolicy without approval")
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+
+			By("Verifying the trail")
+			file, err := os.Open(auditPath)
+			Expect(err).NotTo(HaveOccurred())
+			defer file.Close()
+			last, err := audit.Verify(file)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(last.Sequence).To(Equal(uint64(2)))
+			Expect(last.Action).To(Equal(audit.ActionAdmission))
+			Expect(last.Decision).To(Equal("pending"))
+		})
+
+		It("Should admit a NetworkPolicy matching an auto-approval rule and approve its CSR", func() {
+			By("Configuring an auto-approval rule")
+			validator.AutoApproval = autoapprove.NewEngine([]autoapprove.Rule{
+				{Name: "same-namespace", Shapes: []autoapprove.Shape{autoapprove.ShapeIngressSameNamespaceOnly}},
+			})
+
+			By("Validating the NetworkPolicy")
+			warnings, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ContainElement(ContainSubstring("same-namespace")))
+
+			By("Verifying the CSR was approved by the rule")
+			csr := &certificatesv1.CertificateSigningRequest{}
+			csrName := fmt.Sprintf("np-approval-%s-%s", namespace, obj.Name)
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Name: csrName}, csr)).To(Succeed())
+			Expect(csr.Annotations[approval.AnnotationAutoApprovedBy]).To(Equal("same-namespace"))
+			Expect(csr.Status.Conditions).To(HaveLen(1))
+			Expect(csr.Status.Conditions[0].Type).To(Equal(certificatesv1.CertificateApproved))
+			Expect(csr.Status.Conditions[0].Reason).To(Equal(approval.ConditionReasonAutoApproved))
+
+			By("Admitting the NetworkPolicy again before the approval Secret exists")
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should not admit a NetworkPolicy whose request was not filed for auto-approval", func() {
+			By("Filing a request for the NetworkPolicy")
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+
+			By("Approving the CSR with the auto-approval reason")
+			csr := &certificatesv1.CertificateSigningRequest{}
+			csrName := fmt.Sprintf("np-approval-%s-%s", namespace, obj.Name)
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Name: csrName}, csr)).To(Succeed())
+			csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+				Type:   certificatesv1.CertificateApproved,
+				Status: corev1.ConditionTrue,
+				Reason: approval.ConditionReasonAutoApproved,
+			})
+			Expect(fakeClient.Status().Update(ctx, csr)).To(Succeed())
+
+			By("Validating the NetworkPolicy again")
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("has not been approved yet"))
+		})
+
+		It("Should file a request when no auto-approval rule matches", func() {
+			validator.AutoApproval = autoapprove.NewEngine([]autoapprove.Rule{
+				{Name: "platform", RequesterGroups: []string{"platform-team"}},
+			})
+
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("has not been approved yet"))
+		})
+
+		It("Should record the other namespaces a NetworkPolicy affects and not auto-approve it", func() {
+			Expect(fakeClient.Create(ctx, &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: "team-b", Labels: map[string]string{"team": "b"}},
+			})).To(Succeed())
+			validator.AutoApproval = autoapprove.NewEngine([]autoapprove.Rule{
+				{Name: "test-namespace", Namespaces: []string{namespace}},
+			})
+			obj.Spec.Ingress[0].From[0].NamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"team": "b"}}
+
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("has not been approved yet"))
+
+			csr := &certificatesv1.CertificateSigningRequest{}
+			csrName := fmt.Sprintf("np-approval-%s-%s", namespace, obj.Name)
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Name: csrName}, csr)).To(Succeed())
+			Expect(csr.Annotations[approval.AnnotationAffectedNamespaces]).To(Equal("team-b"))
+			Expect(csr.Annotations).NotTo(HaveKey(approval.AnnotationAutoApprovedBy))
+			Expect(csr.Status.Conditions).To(BeEmpty())
+		})
+
+		It("Should auto-approve a change that only tightens the approved NetworkPolicy", func() {
+			By("Approving a NetworkPolicy with two peers")
+			broader := obj.DeepCopy()
+			broader.Spec.Ingress[0].From = append(broader.Spec.Ingress[0].From, networkingv1.NetworkPolicyPeer{
+				PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "monitoring"}},
+			})
+			hash, err := generateNetworkPolicyHash(broader)
+			Expect(err).NotTo(HaveOccurred())
+			spec, err := approval.EncodeSpec(broader.Spec)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeClient.Create(ctx, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("np-approval-%s-%s", namespace, obj.Name), Namespace: namespace},
+				Type:       SecretTypeNetworkPolicyApproval,
+				Data: map[string][]byte{
+					"hash":    []byte(hash),
+					"tls-crt": []byte("-----BEGIN CERTIFICATE-----\n-----END CERTIFICATE-----"),
+					"spec":    []byte(spec),
+				},
+			})).To(Succeed())
+			validator.AutoApproveTightening = true
+
+			By("Removing a peer")
+			warnings, err := validator.ValidateUpdate(ctx, broader, obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ContainElement(ContainSubstring(autoapprove.RuleTightening)))
+
+			By("Widening the NetworkPolicy instead")
+			widened := broader.DeepCopy()
+			widened.Spec.Ingress[0].From = nil
+			_, err = validator.ValidateUpdate(ctx, broader, widened)
+			Expect(err).To(MatchError(ContainSubstring("has not been approved yet")))
+		})
+
+		It("Should admit a rollback to a version in the approval history without filing a request", func() {
+			By("Approving a newer version after the current one")
+			previous, err := generateNetworkPolicyHash(obj)
+			Expect(err).NotTo(HaveOccurred())
+			spec, err := approval.EncodeSpec(obj.Spec)
+			Expect(err).NotTo(HaveOccurred())
+			newer := obj.DeepCopy()
+			newer.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeEgress}
+			hash, err := generateNetworkPolicyHash(newer)
+			Expect(err).NotTo(HaveOccurred())
+			data := map[string][]byte{
+				"hash":    []byte(hash),
+				"tls-crt": []byte("-----BEGIN CERTIFICATE-----\n-----END CERTIFICATE-----"),
+			}
+			Expect(approval.RecordVersion(data, approval.Version{Hash: previous, Spec: spec, Approver: "alice"}, 10)).To(Succeed())
+			Expect(approval.RecordVersion(data, approval.Version{Hash: hash}, 10)).To(Succeed())
+			Expect(fakeClient.Create(ctx, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: approval.Name(namespace, obj.Name), Namespace: namespace},
+				Type:       SecretTypeNetworkPolicyApproval,
+				Data:       data,
+			})).To(Succeed())
+
+			By("Rejecting a rollback without an incident")
+			obj.Annotations = map[string]string{approval.AnnotationRollbackTo: previous}
+			_, err = validator.ValidateUpdate(ctx, newer, obj)
+			Expect(err).To(MatchError(ContainSubstring(approval.AnnotationIncident)))
+
+			By("Rolling back to the previous version")
+			obj.Annotations[approval.AnnotationIncident] = "INC-7"
+			warnings, err := validator.ValidateUpdate(ctx, newer, obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ContainElement(And(ContainSubstring("rolled back to the version approved at"), ContainSubstring("INC-7"))))
+			err = fakeClient.Get(ctx, types.NamespacedName{Name: approval.Name(namespace, obj.Name)}, &certificatesv1.CertificateSigningRequest{})
+			Expect(client.IgnoreNotFound(err)).NotTo(HaveOccurred())
+			Expect(err).To(HaveOccurred())
+
+			By("Rejecting a rollback to a version that was never approved")
+			obj.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress}
+			unapproved, err := generateNetworkPolicyHash(obj)
+			Expect(err).NotTo(HaveOccurred())
+			obj.Annotations[approval.AnnotationRollbackTo] = unapproved
+			_, err = validator.ValidateUpdate(ctx, newer, obj)
+			Expect(err).To(MatchError(ContainSubstring("not in the approval history")))
+		})
+
+		It("Should attach the risk analysis to the approval request", func() {
+			obj.Spec.Ingress[0].From = append(obj.Spec.Ingress[0].From,
+				networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: "0.0.0.0/0"}})
+
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+
+			csr := &certificatesv1.CertificateSigningRequest{}
+			csrName := fmt.Sprintf("np-approval-%s-%s", namespace, obj.Name)
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Name: csrName}, csr)).To(Succeed())
+			Expect(csr.Annotations[approval.AnnotationRiskScore]).To(Equal("40"))
+			Expect(csr.Annotations[approval.AnnotationRiskFindings]).To(ContainSubstring(analyzer.FindingWorldIPBlock))
+		})
+
+		It("Should reject a NetworkPolicy denied by a CEL rule without filing a request", func() {
+			evaluator, err := celrules.NewEvaluator([]celrules.Rule{{
+				Name:       "protected-name",
+				Expression: "object.metadata.name == 'test-policy'",
+				Action:     celrules.ActionDeny,
+				Message:    "this name is reserved",
+			}})
+			Expect(err).NotTo(HaveOccurred())
+			validator.CELRules = evaluator
+
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("rejected by rule protected-name: this name is reserved")))
+
+			csrName := fmt.Sprintf("np-approval-%s-%s", namespace, obj.Name)
+			err = fakeClient.Get(ctx, types.NamespacedName{Name: csrName}, &certificatesv1.CertificateSigningRequest{})
+			Expect(client.IgnoreNotFound(err)).NotTo(HaveOccurred())
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should record the approvers required by a CEL rule on the CSR", func() {
+			evaluator, err := celrules.NewEvaluator([]celrules.Rule{
+				{Name: "new-policies", Expression: "oldObject == null", Action: celrules.ActionRequireApprovers, Approvers: 2},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			validator.CELRules = evaluator
+			// CEL rules take precedence over auto-approval
+			validator.AutoApproval = autoapprove.NewEngine([]autoapprove.Rule{
+				{Name: "same-namespace", Shapes: []autoapprove.Shape{autoapprove.ShapeIngressSameNamespaceOnly}},
+			})
+
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("has not been approved yet")))
+
+			csr := &certificatesv1.CertificateSigningRequest{}
+			csrName := fmt.Sprintf("np-approval-%s-%s", namespace, obj.Name)
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Name: csrName}, csr)).To(Succeed())
+			Expect(csr.Annotations[approval.AnnotationRequiredApprovers]).To(Equal("2"))
+			Expect(csr.Status.Conditions).To(BeEmpty())
+		})
+
+		It("Should admit a NetworkPolicy instantiating an approved template without filing a request", func() {
+			createApprovedTemplate()
+
+			warnings, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ContainElement(ContainSubstring("allow-from-app")))
+
+			err = fakeClient.Get(ctx, types.NamespacedName{Name: approval.Name(namespace, obj.Name)}, &certificatesv1.CertificateSigningRequest{})
+			Expect(client.IgnoreNotFound(err)).NotTo(HaveOccurred())
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should not admit a NetworkPolicy instantiating an approved template during a rejecting change freeze", func() {
+			createApprovedTemplate()
+			calendar, err := freeze.NewCalendar([]freeze.Window{{
+				Name: "year-end", Start: time.Now().Add(-time.Hour).Format(time.RFC3339), End: time.Now().Add(time.Hour).Format(time.RFC3339),
+			}})
+			Expect(err).NotTo(HaveOccurred())
+			validator.Freezes = calendar
+
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("change freeze year-end is active until")))
+		})
+
+		It("Should file a request for a NetworkPolicy that does not instantiate the template", func() {
+			createApprovedTemplate()
+			obj.Spec.Ingress[0].From[0].PodSelector.MatchLabels["app"] = "Test"
+
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("has not been approved yet"))
+		})
+
+		It("Should admit a break-glass change of an on-call member and file a retroactive request", func() {
+			auditPath := filepath.Join(GinkgoT().TempDir(), "audit.jsonl")
+			sink, err := audit.NewFileSink(auditPath)
+			Expect(err).NotTo(HaveOccurred())
+			defer sink.Close()
+			validator.Audit = sink
+			validator.BreakGlass = breakglass.NewPolicy([]string{"oncall"}, time.Hour)
+			asUser := func(username string, groups ...string) context.Context {
+				return admission.NewContextWithRequest(ctx, admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+					UserInfo: authenticationv1.UserInfo{Username: username, Groups: groups},
+				}})
+			}
+			obj.Annotations = map[string]string{approval.AnnotationBreakGlass: "INC-42 database outage"}
+
+			By("Rejecting users outside the break-glass groups")
+			_, err = validator.ValidateCreate(asUser("developer"), obj)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("not allowed to bypass approval"))
+
+			By("Admitting an on-call member")
+			warnings, err := validator.ValidateCreate(asUser("alice", "oncall"), obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ContainElement(ContainSubstring("admitted by break-glass")))
+
+			csr := &certificatesv1.CertificateSigningRequest{}
+			csrName := fmt.Sprintf("np-approval-%s-%s", namespace, obj.Name)
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Name: csrName}, csr)).To(Succeed())
+			Expect(csr.Annotations[approval.AnnotationBreakGlass]).To(Equal("INC-42 database outage"))
+			expires, ok := approval.BreakGlassExpiry(csr.Annotations)
+			Expect(ok).To(BeTrue())
+			Expect(expires).To(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+			Expect(csr.Status.Conditions).To(BeEmpty())
+
+			file, err := os.Open(auditPath)
+			Expect(err).NotTo(HaveOccurred())
+			defer file.Close()
+			last, err := audit.Verify(file)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(last.Action).To(Equal(audit.ActionBreakGlass))
+			Expect(last.Severity).To(Equal(audit.SeverityHigh))
+			Expect(last.Requester).To(Equal("alice"))
+
+			By("Admitting the same NetworkPolicy for anyone while the window is open")
+			delete(obj.Annotations, approval.AnnotationBreakGlass)
+			_, err = validator.ValidateUpdate(asUser("gitops-controller"), obj, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Rejecting other changes of users outside the break-glass groups")
+			obj.Annotations[approval.AnnotationBreakGlass] = "INC-42 database outage"
+			obj.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeEgress}
+			_, err = validator.ValidateUpdate(asUser("developer"), oldObj, obj)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should reject break-glass without a justification", func() {
+			validator.BreakGlass = breakglass.NewPolicy([]string{"oncall"}, time.Hour)
+			obj.Annotations = map[string]string{approval.AnnotationBreakGlass: " "}
+
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("justification"))
+		})
+
+		It("Should admit a NetworkPolicy signed with a trusted key without filing a request", func() {
+			public, private, err := ed25519.GenerateKey(rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			der, err := x509.MarshalPKIXPublicKey(public)
+			Expect(err).NotTo(HaveOccurred())
+			validator.Signatures, err = signature.NewVerifier([]signature.TrustedKey{{
+				Name: "gitops-ci", PublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+			}})
+			Expect(err).NotTo(HaveOccurred())
+			hash, err := generateNetworkPolicyHash(obj)
+			Expect(err).NotTo(HaveOccurred())
+			obj.Annotations = map[string]string{
+				approval.AnnotationSignature: base64.StdEncoding.EncodeToString(ed25519.Sign(private, []byte(hash))),
+			}
+
+			warnings, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ContainElement(ContainSubstring("trusted key gitops-ci")))
+			csrName := approval.Name(namespace, obj.Name)
+			err = fakeClient.Get(ctx, types.NamespacedName{Name: csrName}, &certificatesv1.CertificateSigningRequest{})
+			Expect(client.IgnoreNotFound(err)).NotTo(HaveOccurred())
+			Expect(err).To(HaveOccurred())
+
+			By("Rejecting the signature for a changed NetworkPolicy")
+			obj.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeEgress}
+			_, err = validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("does not verify"))
+
+			By("Ignoring the signature during a change freeze")
+			validator.Freezes, err = freeze.NewCalendar([]freeze.Window{{
+				Name: "year-end", Start: time.Now().Add(-time.Hour).Format(time.RFC3339), End: time.Now().Add(time.Hour).Format(time.RFC3339),
+			}})
+			Expect(err).NotTo(HaveOccurred())
+			obj.Spec.PolicyTypes = nil
+			_, err = validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("change freeze year-end"))
+		})
+
+		It("Should reject changes during a rejecting change freeze", func() {
+			calendar, err := freeze.NewCalendar([]freeze.Window{{
+				Name: "year-end", Start: time.Now().Add(-time.Hour).Format(time.RFC3339), End: time.Now().Add(time.Hour).Format(time.RFC3339),
+				Message: "use break-glass for incidents",
+			}})
+			Expect(err).NotTo(HaveOccurred())
+			validator.Freezes = calendar
+
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("change freeze year-end is active until"))
+			Expect(err.Error()).To(ContainSubstring("use break-glass for incidents"))
+
+			csrName := fmt.Sprintf("np-approval-%s-%s", namespace, obj.Name)
+			err = fakeClient.Get(ctx, types.NamespacedName{Name: csrName}, &certificatesv1.CertificateSigningRequest{})
+			Expect(client.IgnoreNotFound(err)).NotTo(HaveOccurred())
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should only let the freeze approver groups approve requests filed during an escalating freeze", func() {
+			calendar, err := freeze.NewCalendar([]freeze.Window{{
+				Name: "weekend", Schedule: "* * * * *", Duration: time.Hour,
+				Action: freeze.ActionEscalate, ApproverGroups: []string{"change-board"},
+			}})
+			Expect(err).NotTo(HaveOccurred())
+			validator.Freezes = calendar
+			validator.AutoApproval = autoapprove.NewEngine([]autoapprove.Rule{
+				{Name: "test-namespace", Namespaces: []string{namespace}},
+			})
+
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("change freeze weekend is active"))
+			Expect(err.Error()).To(ContainSubstring("[change-board]"))
+
+			csr := &certificatesv1.CertificateSigningRequest{}
+			csrName := fmt.Sprintf("np-approval-%s-%s", namespace, obj.Name)
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Name: csrName}, csr)).To(Succeed())
+			Expect(csr.Annotations[approval.AnnotationFreeze]).To(Equal("weekend"))
+			Expect(csr.Annotations[approval.AnnotationApproverGroups]).To(Equal("change-board"))
+			Expect(csr.Status.Conditions).To(BeEmpty())
+
+			By("Reminding the requester on the next attempt")
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("filed during change freeze weekend"))
+		})
+
+		It("Should group requests sharing a change-id and admit them once the change-set is approved", func() {
+			other := obj.DeepCopy()
+			other.Name = "other-policy"
+			for _, np := range []*networkingv1.NetworkPolicy{obj, other} {
+				np.Annotations = map[string]string{approval.AnnotationChangeID: "REL-1.4"}
+				_, err := validator.ValidateCreate(ctx, np)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("part of change-set np-changeset-test-namespace-rel-1-4"))
+			}
+
+			changeSet := &certificatesv1.CertificateSigningRequest{}
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Name: approval.ChangeSetName(namespace, "rel-1-4")}, changeSet)).To(Succeed())
+			Expect(changeSet.Labels[approval.LabelNetworkPolicyApproval]).To(Equal(approval.LabelValueChangeSet))
+			Expect(changeSet.Annotations[approval.AnnotationChangeID]).To(Equal("REL-1.4"))
+			hash, err := generateNetworkPolicyHash(obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(approval.ChangeSetMembers(changeSet.Annotations)).To(HaveKeyWithValue(obj.Name, hash))
+			Expect(approval.ChangeSetMembers(changeSet.Annotations)).To(HaveKey(other.Name))
+			csr := &certificatesv1.CertificateSigningRequest{}
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Name: approval.Name(namespace, obj.Name)}, csr)).To(Succeed())
+			Expect(csr.Annotations[approval.AnnotationChangeSet]).To(Equal(changeSet.Name))
+
+			By("Admitting the members once the change-set is approved")
+			changeSet.Status.Conditions = append(changeSet.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+				Type: certificatesv1.CertificateApproved, Status: corev1.ConditionTrue,
+			})
+			Expect(fakeClient.SubResource("approval").Update(ctx, changeSet)).To(Succeed())
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Not admitting a member changed after it joined")
+			other.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeEgress}
+			_, err = validator.ValidateCreate(ctx, other)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).NotTo(ContainSubstring("part of change-set"))
+		})
+
+		It("Should group requests of a requester within the change-set window", func() {
+			validator.ChangeSetWindow = time.Hour
+			other := obj.DeepCopy()
+			other.Name = "other-policy"
+			changeSets := &certificatesv1.CertificateSigningRequestList{}
+			for _, np := range []*networkingv1.NetworkPolicy{obj, other} {
+				_, err := validator.ValidateCreate(ctx, np)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("part of change-set"))
+
+				// The fake client does not set creation timestamps like the API server does
+				Expect(fakeClient.List(ctx, changeSets, client.MatchingLabels{approval.LabelNetworkPolicyApproval: approval.LabelValueChangeSet})).To(Succeed())
+				for i := range changeSets.Items {
+					if changeSets.Items[i].CreationTimestamp.IsZero() {
+						changeSets.Items[i].CreationTimestamp = metav1.Now()
+						Expect(fakeClient.Update(ctx, &changeSets.Items[i])).To(Succeed())
+					}
+				}
+			}
+
+			Expect(fakeClient.List(ctx, changeSets, client.MatchingLabels{approval.LabelNetworkPolicyApproval: approval.LabelValueChangeSet})).To(Succeed())
+			Expect(changeSets.Items).To(HaveLen(1))
+			Expect(approval.ChangeSetMembers(changeSets.Items[0].Annotations)).To(HaveLen(2))
+		})
+
 		It("Should allow deletion without approval check", func() {
 			By("Validating deletion")
 			warnings, err := validator.ValidateDelete(ctx, obj)
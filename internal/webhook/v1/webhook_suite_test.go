@@ -29,6 +29,7 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	approvalv1alpha1 "github.com/hadi2f244/approve-controller/api/v1alpha1"
 	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
@@ -67,6 +68,8 @@ var _ = BeforeSuite(func() {
 	var err error
 	err = networkingv1.AddToScheme(scheme.Scheme)
 	Expect(err).NotTo(HaveOccurred())
+	err = approvalv1alpha1.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
 
 	// +kubebuilder:scaffold:scheme
 
@@ -108,7 +111,10 @@ var _ = BeforeSuite(func() {
 	})
 	Expect(err).NotTo(HaveOccurred())
 
-	err = SetupNetworkPolicyWebhookWithManager(mgr)
+	err = SetupNetworkPolicyWebhookWithManager(mgr, &NetworkPolicyCustomValidator{})
+	Expect(err).NotTo(HaveOccurred())
+
+	err = SetupCertificateSigningRequestWebhookWithManager(mgr, &CertificateSigningRequestCustomValidator{})
 	Expect(err).NotTo(HaveOccurred())
 
 	// +kubebuilder:scaffold:webhook